@@ -2,6 +2,7 @@ package beat
 
 import (
 	"fmt"
+	"net"
 	"os"
 
 	"github.com/elastic/libbeat/beat"
@@ -22,6 +23,8 @@ type Filebeat struct {
 	publisherChan chan []*FileEvent
 	Spooler       *Spooler
 	registrar     *Registrar
+	crawler       *Crawler
+	metrics       net.Listener // serves harvester metrics, if metrics_listen is set
 }
 
 func New() *Filebeat {
@@ -41,6 +44,20 @@ func (fb *Filebeat) Config(b *beat.Beat) error {
 	// Check if optional config_dir is set to fetch additional prospector config files
 	fb.FbConfig.FetchConfigs()
 
+	for _, prospector := range fb.FbConfig.Filebeat.Prospectors {
+		if err := prospector.Validate(); err != nil {
+			return fmt.Errorf("Error in prospector config: %v", err)
+		}
+
+		// Only check files are readable on -configtest, as files might not be
+		// accessible yet when starting
+		if cfgfile.IsTestConfig() {
+			if err := prospector.CheckPaths(); err != nil {
+				return fmt.Errorf("Error in prospector config: %v", err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -72,10 +89,18 @@ func (fb *Filebeat) Run(b *beat.Beat) error {
 		return err
 	}
 
-	crawl := &Crawler{
+	fb.crawler = &Crawler{
 		Registrar: fb.registrar,
 	}
 
+	if fb.FbConfig.Filebeat.MetricsListen != "" {
+		fb.crawler.Metrics, fb.metrics, err = startMetrics(&fb.FbConfig.Filebeat)
+		if err != nil {
+			logp.Err("Could not serve metrics: %v", err)
+			return err
+		}
+	}
+
 	// Load the previous log file locations now, for use in prospector
 	fb.registrar.LoadState()
 
@@ -91,7 +116,7 @@ func (fb *Filebeat) Run(b *beat.Beat) error {
 	// Start up spooler
 	go fb.Spooler.Run()
 
-	crawl.Start(fb.FbConfig.Filebeat.Prospectors, fb.Spooler.Channel)
+	fb.crawler.Start(fb.FbConfig.Filebeat.Prospectors, fb.Spooler.Channel)
 
 	// Publishes event to output
 	go Publish(b, fb)
@@ -109,14 +134,28 @@ func (fb *Filebeat) Cleanup(b *beat.Beat) error {
 // Stop is called on exit for cleanup
 func (fb *Filebeat) Stop() {
 
-	// Stop harvesters
-	// Stop prospectors
+	// Stop might be called before Run created all components, e.g. on a
+	// signal during startup
+
+	// Stop prospectors and harvesters before the spooler, so no new events
+	// are sent
+	if fb.crawler != nil {
+		fb.crawler.Stop()
+	}
 
 	// Stopping spooler will flush items
-	fb.Spooler.Stop()
+	if fb.Spooler != nil {
+		fb.Spooler.Stop()
+	}
 
 	// Stopping registrar will write last state
-	fb.registrar.Stop()
+	if fb.registrar != nil {
+		fb.registrar.Stop()
+	}
+
+	if fb.metrics != nil {
+		fb.metrics.Close()
+	}
 
 	// Close channels
 	//close(fb.publisherChan)
@@ -137,6 +176,11 @@ func Publish(beat *beat.Beat, fb *Filebeat) {
 
 		logp.Info("Events sent: %d", len(events))
 
+		// Release harvesters waiting for their events with ordered_delivery
+		for _, event := range events {
+			event.Ack()
+		}
+
 		// Tell the registrar that we've successfully sent these events
 		fb.registrar.Channel <- events
 	}
@@ -1 +1,9 @@
 package beat
+
+import "testing"
+
+// Stop is called on signals also before Run started all components
+func TestStopBeforeRun(t *testing.T) {
+	fb := &Filebeat{}
+	fb.Stop()
+}
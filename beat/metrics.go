@@ -0,0 +1,32 @@
+package beat
+
+import (
+	"net"
+	"net/http"
+
+	cfg "github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester"
+	"github.com/elastic/libbeat/logp"
+)
+
+// startMetrics serves the harvester metrics in the Prometheus text format at
+// /metrics on metrics_listen. The listener is closed to stop serving.
+func startMetrics(config *cfg.FilebeatConfig) (*harvester.Metrics, net.Listener, error) {
+	maxSources := config.MetricsMaxSources
+	if maxSources == 0 {
+		maxSources = cfg.DefaultMetricsMaxSources
+	}
+	metrics := harvester.NewMetrics(maxSources)
+
+	listener, err := net.Listen("tcp", config.MetricsListen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go http.Serve(listener, mux)
+
+	logp.Info("Serving harvester metrics on http://%s/metrics", listener.Addr())
+	return metrics, listener, nil
+}
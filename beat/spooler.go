@@ -14,12 +14,14 @@ type Spooler struct {
 	nextFlushTime time.Time
 	spool         []*input.FileEvent
 	Channel       chan *input.FileEvent
+	exit          chan struct{}
 }
 
 func NewSpooler(filebeat *Filebeat) *Spooler {
 	spooler := &Spooler{
 		Filebeat: filebeat,
 		running:  false,
+		exit:     make(chan struct{}),
 	}
 
 	config := &spooler.Filebeat.FbConfig.Filebeat
@@ -97,18 +99,27 @@ func (s *Spooler) Run() {
 				logp.Debug("spooler", "Flushing spooler because of timemout. Events flushed: %v", len(s.spool))
 				s.flush()
 			}
+		case <-s.exit:
+			s.running = false
 		}
 	}
 
+	ticker.Stop()
 	logp.Info("Stopping spooler")
 
-	// Flush again before exiting spooler and closes channel
+	// Flush again before exiting spooler. The channel is not closed, as
+	// harvesters still being torn down might send to it. These stop on their
+	// own done channel instead of panicking on a closed channel.
 	s.flush()
-	close(s.Channel)
 }
 
 // Stop stops the spooler. Flushes events before stopping
 func (s *Spooler) Stop() {
+	select {
+	case <-s.exit:
+	default:
+		close(s.exit)
+	}
 }
 
 // flush flushes all event and sends them to the publisher
@@ -1,9 +1,20 @@
 package beat
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	cfg "github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/crawler"
+	"github.com/elastic/filebeat/harvester"
+	"github.com/elastic/filebeat/input"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
 )
@@ -53,3 +64,89 @@ func TestNewSpoolerIdleTimeout(t *testing.T) {
 
 	assert.Equal(t, idleTimoeout, fb.FbConfig.Filebeat.IdleTimeout)
 }
+
+func TestSpoolerStopUnderLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-spooler")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	line := strings.Repeat("x", 100) + "\n"
+	for i := 0; i < 5; i++ {
+		content := strings.Repeat(line, 10000)
+		path := filepath.Join(dir, fmt.Sprintf("test%d.log", i))
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		assert.Nil(t, err)
+	}
+
+	fb := &Filebeat{
+		FbConfig:      &cfg.Config{Filebeat: cfg.FilebeatConfig{SpoolSize: 10}},
+		publisherChan: make(chan []*input.FileEvent, 1),
+	}
+	spooler := NewSpooler(fb)
+	assert.Nil(t, spooler.Config())
+
+	// drain published events
+	go func() {
+		for range fb.publisherChan {
+		}
+	}()
+
+	spoolerDone := make(chan struct{})
+	go func() {
+		spooler.Run()
+		close(spoolerDone)
+	}()
+
+	c := &crawler.Crawler{
+		Registrar: &crawler.Registrar{
+			State:   map[string]*input.FileState{},
+			Persist: make(chan *input.FileState),
+		},
+		Metrics: harvester.NewMetrics(0),
+	}
+	c.Start([]cfg.ProspectorConfig{{
+		Paths: []string{filepath.Join(dir, "*.log")},
+	}}, spooler.Channel)
+
+	// Stop spooler while harvesters are still sending events
+	waitHarvesters(t, c.Metrics, 5, 5)
+	spooler.Stop()
+	<-spoolerDone
+
+	// Harvesters blocked sending to the stopped spooler must exit without
+	// panicking
+	c.Stop()
+	waitHarvesters(t, c.Metrics, 5, 0)
+}
+
+// waitHarvesters waits until the harvesters of the given number of sources
+// have started and the given number of them is still running.
+func waitHarvesters(t *testing.T, metrics *harvester.Metrics, sources, running int) {
+	timeout := time.After(5 * time.Second)
+	for {
+		var buf bytes.Buffer
+		metrics.Write(&buf)
+
+		n, open := 0, 0.0
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) > 1 && strings.HasPrefix(fields[0], "filebeat_harvester_open{") {
+				var value float64
+				fmt.Sscan(fields[len(fields)-1], &value)
+				n++
+				open += value
+			}
+		}
+		if n == sources && open == float64(running) {
+			return
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("Timeout waiting for %d of %d harvesters running, %v of %d running", running, sources, open, n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
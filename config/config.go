@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"time"
 
 	"github.com/elastic/libbeat/cfgfile"
@@ -12,22 +13,98 @@ import (
 
 // Defaults for config variables which are not set
 const (
-	DefaultRegistryFile                      = ".filebeat"
-	DefaultIgnoreOlderDuration time.Duration = 24 * time.Hour
-	DefaultScanFrequency       time.Duration = 10 * time.Second
-	DefaultSpoolSize           uint64        = 1024
-	DefaultIdleTimeout         time.Duration = 5 * time.Second
-	DefaultHarvesterBufferSize int           = 16 << 10 // 16384
-	DefaultInputType                         = "log"
-	DefaultDocumentType                      = "log"
-	DefaultTailFiles                         = false
-	DefaultBackoff                           = 1 * time.Second
-	DefaultBackoffFactor                     = 2
-	DefaultMaxBackoff                        = 10 * time.Second
-	DefaultPartialLineWaiting                = 5 * time.Second
-	DefaultForceCloseFiles                   = false
+	DefaultRegistryFile                          = ".filebeat"
+	DefaultIgnoreOlderDuration     time.Duration = 24 * time.Hour
+	DefaultScanFrequency           time.Duration = 10 * time.Second
+	DefaultSpoolSize               uint64        = 1024
+	DefaultIdleTimeout             time.Duration = 5 * time.Second
+	DefaultHarvesterBufferSize     int           = 16 << 10 // 16384
+	DefaultInputType                             = "log"
+	DefaultDocumentType                          = "log"
+	DefaultTailFiles                             = false
+	DefaultBackoff                               = 1 * time.Second
+	DefaultBackoffFactor                         = 2
+	DefaultMaxBackoff                            = 10 * time.Second
+	DefaultPartialLineWaiting                    = 5 * time.Second
+	DefaultForceCloseFiles                       = false
+	DefaultMultilineTimeout                      = 5 * time.Second
+	DefaultMaxBytes                              = 10 << 20 // 10MB
+	DefaultCloseOlder                            = 1 * time.Hour
+	DefaultMaxOpenRetries                        = 10
+	DefaultOpenRetryBackoff                      = 5 * time.Second
+	DefaultLineDelimiter                         = "\n"
+	DefaultPartialLinePollInterval               = 1 * time.Second
+	DefaultEncodingErrors                        = EncodingErrorsReplace
+	DefaultBatchTimeout                          = 1 * time.Second
+	DefaultFramePrefixSize                       = 4
+	DefaultFrameByteOrder                        = FrameByteOrderBig
+	DefaultShrinkPolicy                          = ShrinkPolicyRestart
+	DefaultPartialLinePolicy                     = PartialLinePolicyWaitForever
+	DefaultEventID                               = "%{source}:%{offset}"
+	DefaultSymlinks                              = true
+	DefaultMaxSymlinkDepth                       = 10
+	DefaultMetricsMaxSources                     = 100
+	DefaultFutureMtimeSkew                       = 1 * time.Minute
 )
 
+// Supported input types
+const (
+	LogInputType    = "log"
+	StdinInputType  = "stdin"
+	FileInputType   = "file"   // whole file content is sent as one event
+	FramedInputType = "framed" // length-prefixed records
+)
+
+// Policies for lines containing byte sequences invalid in the configured encoding
+const (
+	EncodingErrorsStrict  = "strict"  // stop harvester
+	EncodingErrorsReplace = "replace" // replace invalid sequences with U+FFFD
+	EncodingErrorsSkip    = "skip"    // drop line
+)
+
+// Byte orders of the length prefix of input_type framed
+const (
+	FrameByteOrderBig    = "big"
+	FrameByteOrderLittle = "little"
+)
+
+// Policies for files shrinking below the current offset
+const (
+	ShrinkPolicyRestart = "restart" // read file again from the beginning
+	ShrinkPolicyIgnore  = "ignore"  // continue at the new end of file
+	ShrinkPolicyStop    = "stop"    // stop harvester
+)
+
+// Policies for lines not completed within partial_line_waiting
+const (
+	PartialLinePolicyEmit        = "emit"         // publish the incomplete line flagged as partial
+	PartialLinePolicyDiscard     = "discard"      // drop the incomplete line and continue after it
+	PartialLinePolicyWaitForever = "wait_forever" // keep waiting for the line to be completed
+)
+
+// Policies for secondary spoolers not keeping up
+const (
+	TeePolicyBlock = "block" // wait for the secondary spooler, slowing down all spoolers
+	TeePolicyDrop  = "drop"  // drop the event for the secondary spooler only
+)
+
+// Modes of raw_bytes
+const (
+	RawBytesAdd     = "add"     // add raw bytes to the decoded message
+	RawBytesReplace = "replace" // send raw bytes instead of the decoded message
+)
+
+// Target types of json.convert
+const (
+	ConvertInt   = "int"
+	ConvertFloat = "float"
+	ConvertBool  = "bool"
+)
+
+// EventIDPlaceholder matches the placeholders of event_id and fields values
+// with an optional filter, e.g. %{offset} or %{source|dir}
+var EventIDPlaceholder = regexp.MustCompile(`%\{(\w*)(?:\|(\w*))?\}`)
+
 type Config struct {
 	Filebeat FilebeatConfig
 }
@@ -39,6 +116,8 @@ type FilebeatConfig struct {
 	IdleTimeoutDuration time.Duration
 	RegistryFile        string `yaml:"registry_file"`
 	ConfigDir           string `yaml:"config_dir"`
+	MetricsListen       string `yaml:"metrics_listen"`
+	MetricsMaxSources   int    `yaml:"metrics_max_sources"`
 }
 
 type ProspectorConfig struct {
@@ -46,8 +125,15 @@ type ProspectorConfig struct {
 	Input                 string
 	IgnoreOlder           string `yaml:"ignore_older"`
 	IgnoreOlderDuration   time.Duration
+	IgnoreOlderUseMtime   bool   `yaml:"ignore_older_use_mtime"`
 	ScanFrequency         string `yaml:"scan_frequency"`
 	ScanFrequencyDuration time.Duration
+	ExcludeFiles          []string `yaml:"exclude_files"`
+	ExcludeFilesRegexp    []*regexp.Regexp
+	CaseInsensitive       bool            `yaml:"case_insensitive"`
+	HarvesterLimit        int             `yaml:"harvester_limit"`
+	Concat                bool            `yaml:"concat"`
+	ConcatRereadChanged   bool            `yaml:"concat_reread_changed"`
 	Harvester             HarvesterConfig `yaml:",inline"`
 }
 
@@ -57,6 +143,7 @@ type HarvesterConfig struct {
 	FieldsUnderRoot            bool   `yaml:"fields_under_root"`
 	BufferSize                 int    `yaml:"harvester_buffer_size"`
 	TailFiles                  bool   `yaml:"tail_files"`
+	TailLines                  int    `yaml:"tail_lines"`
 	Encoding                   string `yaml:"encoding"`
 	DocumentType               string `yaml:"document_type"`
 	Backoff                    string `yaml:"backoff"`
@@ -64,9 +151,154 @@ type HarvesterConfig struct {
 	BackoffFactor              int    `yaml:"backoff_factor"`
 	MaxBackoff                 string `yaml:"max_backoff"`
 	MaxBackoffDuration         time.Duration
-	PartialLineWaiting         string `yaml:"partial_line_wating"`
+	PartialLineWaiting         string `yaml:"partial_line_waiting"`
 	PartialLineWaitingDuration time.Duration
-	ForceCloseFiles            bool `yaml:"force_close_files"`
+	PartialLinePollInterval    string `yaml:"partial_line_poll_interval"`
+	PartialLinePollDuration    time.Duration
+	PartialLinePolicy          string           `yaml:"partial_line_policy"`
+	MaxPartialBytes            int              `yaml:"max_partial_bytes"`
+	ForceCloseFiles            bool             `yaml:"force_close_files"`
+	Multiline                  *MultilineConfig `yaml:"multiline"`
+	MaxBytes                   int              `yaml:"max_bytes"`
+	DropLinesOver              int              `yaml:"drop_lines_over"`
+	IncludeLines               []string         `yaml:"include_lines"`
+	ExcludeLines               []string         `yaml:"exclude_lines"`
+	CloseOlder                 string           `yaml:"close_older"`
+	CloseOlderDuration         time.Duration
+	CloseTimeout               string `yaml:"close_timeout"`
+	CloseTimeoutDuration       time.Duration
+	DeviceCheckInterval        string `yaml:"device_check_interval"`
+	DeviceCheckDuration        time.Duration
+	EmptyFileTimeout           string `yaml:"empty_file_timeout"`
+	EmptyFileTimeoutDuration   time.Duration
+	SkipEmptyFiles             bool   `yaml:"skip_empty_files"`
+	SkipFutureFiles            bool   `yaml:"skip_future_files"`
+	FutureMtimeSkew            string `yaml:"future_mtime_skew"`
+	FutureMtimeSkewDuration    time.Duration
+	MaxOpenRetries             *int   `yaml:"max_open_retries"` // DefaultMaxOpenRetries if not set
+	OpenRetryBackoff           string `yaml:"open_retry_backoff"`
+	OpenRetryBackoffDuration   time.Duration
+	LineDelimiter              string      `yaml:"line_delimiter"`
+	JSON                       *JSONConfig `yaml:"json"`
+	CloseEOF                   bool        `yaml:"close_eof"`
+	AllowNonRegularFiles       bool        `yaml:"allow_non_regular_files"`
+	Symlinks                   *bool       `yaml:"symlinks"` // DefaultSymlinks if not set
+	MaxSymlinkDepth            int         `yaml:"max_symlink_depth"`
+	BackoffJitter              float64     `yaml:"backoff_jitter"`
+	AddFileFields              bool        `yaml:"add_file_fields"`
+	StartOffset                int64       `yaml:"start_offset"`
+	MaxEventsPerSecond         int         `yaml:"max_events_per_second"`
+	FlushPartialOnClose        bool        `yaml:"flush_partial_on_close"`
+	SpoolerSendTimeout         string      `yaml:"spooler_send_timeout"`
+	SpoolerSendTimeoutDuration time.Duration
+	TeePolicy                  string           `yaml:"tee_policy"`
+	OrderedDelivery            bool             `yaml:"ordered_delivery"`
+	Timestamp                  *TimestampConfig `yaml:"timestamp"`
+	SFTP                       *SFTPConfig      `yaml:"sftp"`
+	Extract                    *ExtractConfig   `yaml:"extract"`
+	SkipNullPadding            bool             `yaml:"skip_null_padding"`
+	Redact                     []RedactConfig   `yaml:"redact"`
+	EncodingErrors             string           `yaml:"encoding_errors"`
+	AddFileIdentity            bool             `yaml:"add_file_identity"`
+	ReadErrorRetries           int              `yaml:"read_error_retries"`
+	CRLineEndings              bool             `yaml:"cr_line_endings"`
+	DecompressCmd              string           `yaml:"decompress_cmd"`
+	SkipHeaderLines            int              `yaml:"skip_header_lines"`
+	BatchLines                 int              `yaml:"batch_lines"`
+	BatchTimeout               string           `yaml:"batch_timeout"`
+	BatchTimeoutDuration       time.Duration
+	FingerprintSize            int    `yaml:"fingerprint_size"`
+	AddReadLatency             bool   `yaml:"add_read_latency"`
+	FramePrefixSize            int    `yaml:"frame_prefix_size"`
+	FrameByteOrder             string `yaml:"frame_byte_order"`
+	NormalizeSource            bool   `yaml:"normalize_source"`
+	ReadDeadline               string `yaml:"read_deadline"`
+	ReadDeadlineDuration       time.Duration
+	AddSequence                bool   `yaml:"add_sequence"`
+	DropEmptyLines             bool   `yaml:"drop_empty_lines"`
+	DropWhitespaceLines        bool   `yaml:"drop_whitespace_lines"`
+	TrimPrefix                 string `yaml:"trim_prefix"`
+	TrimSuffix                 string `yaml:"trim_suffix"`
+	TrimChars                  string `yaml:"trim_chars"`
+	AddLineEnding              bool   `yaml:"add_line_ending"`
+	ShrinkPolicy               string `yaml:"shrink_policy"`
+	AddEventID                 bool   `yaml:"add_event_id"`
+	AddEndOffset               bool   `yaml:"add_end_offset"`
+	AddEncoding                bool   `yaml:"add_encoding"`
+	AddStartReason             bool   `yaml:"add_start_reason"`
+	RawBytes                   string `yaml:"raw_bytes"`
+	CompressTextOver           int    `yaml:"compress_text_over"`
+	SampleRate                 int    `yaml:"sample_rate"`
+	SampleDeterministic        bool   `yaml:"sample_deterministic"`
+	DedupWindow                string `yaml:"dedup_window"`
+	DedupWindowDuration        time.Duration
+	DedupMaxLines              int    `yaml:"dedup_max_lines"`
+	EventID                    string `yaml:"event_id"`
+	MaxFileSize                int64  `yaml:"max_file_size"`
+	MaxFileSizeTail            int64  `yaml:"max_file_size_tail"`
+	FollowRenamed              bool   `yaml:"follow_renamed"`
+	PublishErrors              bool   `yaml:"publish_errors"`
+	AdaptiveBackoff            bool   `yaml:"adaptive_backoff"`
+	HeartbeatInterval          string `yaml:"heartbeat_interval"`
+	HeartbeatIntervalDuration  time.Duration
+	StrictConfig               bool `yaml:"strict_config"`
+
+	// include_lines and exclude_lines compiled by Validate
+	IncludeLinesRegexp []*regexp.Regexp
+	ExcludeLinesRegexp []*regexp.Regexp
+
+	unknownKeys []string // keys of the prospector config not matching any option
+}
+
+type RedactConfig struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+
+	PatternRegexp *regexp.Regexp // compiled by Validate
+}
+
+type TimestampConfig struct {
+	Pattern     string `yaml:"pattern"`
+	Layout      string `yaml:"layout"`
+	AddErrorKey bool   `yaml:"add_error_key"`
+
+	PatternRegexp *regexp.Regexp // compiled by Validate
+}
+
+type ExtractConfig struct {
+	Pattern       string `yaml:"pattern"`
+	KeysUnderRoot bool   `yaml:"keys_under_root"`
+	AddErrorKey   bool   `yaml:"add_error_key"`
+
+	PatternRegexp *regexp.Regexp // compiled by Validate
+}
+
+type JSONConfig struct {
+	MessageKey         string            `yaml:"message_key"`
+	KeysUnderRoot      bool              `yaml:"keys_under_root"`
+	AddErrorKey        bool              `yaml:"add_error_key"`
+	Convert            map[string]string `yaml:"convert"`
+	AddConvertErrorKey bool              `yaml:"add_convert_error_key"`
+}
+
+// SFTPConfig holds the credentials used to read sftp:// paths
+type SFTPConfig struct {
+	User       string `yaml:"user"`
+	Password   string `yaml:"password"`
+	PrivateKey string `yaml:"private_key"` // path of the private key file
+	KnownHosts string `yaml:"known_hosts"` // path of the known_hosts file to check host keys
+}
+
+type MultilineConfig struct {
+	Mode            string `yaml:"mode"`
+	Pattern         string `yaml:"pattern"`
+	Negate          bool   `yaml:"negate"`
+	Match           string `yaml:"match"`
+	Timeout         string `yaml:"timeout"`
+	TimeoutDuration time.Duration
+	Separator       *string `yaml:"separator"` // joins the lines of an event, "\n" if not set
+
+	PatternRegexp *regexp.Regexp // compiled by Validate
 }
 
 // getConfigFiles returns list of config files.
@@ -6,6 +6,7 @@ import (
 
 	"github.com/elastic/libbeat/cfgfile"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
 func TestReadConfig(t *testing.T) {
@@ -128,3 +129,44 @@ func TestMergeConfigFiles(t *testing.T) {
 
 	assert.Equal(t, 4, len(config.Filebeat.Prospectors))
 }
+
+func TestStrictConfig(t *testing.T) {
+	content := []byte(`
+filebeat:
+  prospectors:
+    - paths: ["/var/log/*.log"]
+      bufer_size: 1024
+      multiline:
+        pattern: "^\\s"
+        patern: "^\\s"
+        match: after
+      fields:
+        any_key: value
+`)
+
+	config := &Config{}
+	assert.Nil(t, yaml.Unmarshal(content, config))
+
+	prospector := config.Filebeat.Prospectors[0]
+	assert.Equal(t, []string{"bufer_size", "multiline.patern"}, prospector.Harvester.unknownKeys)
+
+	// unknown keys are ignored unless strict_config is enabled
+	assert.Nil(t, prospector.Validate())
+
+	prospector.Harvester.StrictConfig = true
+	err := prospector.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "bufer_size, multiline.patern")
+}
+
+func TestReadConfigKnownKeys(t *testing.T) {
+	absPath, err := filepath.Abs("../tests/files/")
+	assert.Nil(t, err)
+
+	config := &Config{}
+	assert.Nil(t, cfgfile.Read(config, absPath+"/config.yml"))
+
+	for _, prospector := range config.Filebeat.Prospectors {
+		assert.Equal(t, 0, len(prospector.Harvester.unknownKeys), "%v", prospector.Harvester.unknownKeys)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnmarshalYAML decodes the prospector config and records the keys not
+// matching any option, so typos can be rejected with strict_config.
+func (c *ProspectorConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ProspectorConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	var raw map[interface{}]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	c.Harvester.unknownKeys = unknownKeys(raw, reflect.TypeOf(*c), "")
+	return nil
+}
+
+// unknownKeys returns the keys of raw not decoded into a field of type t,
+// sorted and prefixed with the path of the nested option, e.g.
+// multiline.patern. Options of nested structs are checked recursively.
+func unknownKeys(raw map[interface{}]interface{}, t reflect.Type, prefix string) []string {
+	fields := map[string]reflect.Type{}
+	yamlFields(t, fields)
+
+	var unknown []string
+	for k, v := range raw {
+		key := fmt.Sprint(k)
+		fieldType, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if nested, ok := v.(map[interface{}]interface{}); ok && fieldType.Kind() == reflect.Struct {
+			unknown = append(unknown, unknownKeys(nested, fieldType, prefix+key+".")...)
+		}
+	}
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+// yamlFields adds the keys of all options of t to fields, following the
+// naming rules of the yaml decoder: the name given in the tag or the
+// lowercased field name. Fields of inlined structs are added as well.
+func yamlFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "inline" {
+			yamlFields(field.Type, fields)
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+}
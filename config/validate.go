@@ -0,0 +1,391 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/filebeat/input"
+)
+
+// Validate checks the prospector and harvester options for invalid values
+// and conflicting options. Durations are checked when they are parsed on
+// prospector initialization.
+func (c *ProspectorConfig) Validate() error {
+	for _, path := range c.Paths {
+		if _, err := filepath.Glob(path); err != nil {
+			return fmt.Errorf("invalid path '%v': %v", path, err)
+		}
+	}
+
+	if err := validateRegexps("exclude_files", c.ExcludeFiles); err != nil {
+		return err
+	}
+
+	if c.HarvesterLimit < 0 {
+		return fmt.Errorf("harvester_limit must not be negative, got %v", c.HarvesterLimit)
+	}
+
+	for _, path := range c.Paths {
+		if !strings.HasPrefix(path, "sftp://") {
+			continue
+		}
+		if c.Harvester.SFTP == nil {
+			return fmt.Errorf("sftp options must be set to read sftp:// paths")
+		}
+		if c.Concat {
+			return fmt.Errorf("concat can not be used with sftp:// paths")
+		}
+	}
+
+	if c.Concat {
+		if c.Harvester.InputType != "" && c.Harvester.InputType != LogInputType {
+			return fmt.Errorf("concat can only be used with input_type log")
+		}
+		if c.Harvester.FingerprintSize > 0 {
+			return fmt.Errorf("concat can not be used with fingerprint_size")
+		}
+		if c.Harvester.CloseTimeout != "" {
+			return fmt.Errorf("concat can not be used with close_timeout")
+		}
+	}
+
+	return c.Harvester.Validate()
+}
+
+// CheckPaths checks all files currently matching the configured paths can be
+// opened for reading. Directories and non regular files are not checked.
+func (c *ProspectorConfig) CheckPaths() error {
+	for _, path := range c.Paths {
+		matches, err := input.Glob(path, c.CaseInsensitive)
+		if err != nil {
+			return fmt.Errorf("invalid path '%v': %v", path, err)
+		}
+
+		for _, file := range matches {
+			info, err := os.Stat(file)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				return fmt.Errorf("file '%v' is not readable: %v", file, err)
+			}
+			f.Close()
+		}
+	}
+	return nil
+}
+
+// Validate checks the harvester options for invalid values and conflicting
+// options.
+func (c *HarvesterConfig) Validate() error {
+	if c.StrictConfig && len(c.unknownKeys) > 0 {
+		return fmt.Errorf("unknown config keys with strict_config enabled: %v", strings.Join(c.unknownKeys, ", "))
+	}
+
+	if _, ok := encoding.FindEncoding(c.Encoding); !ok {
+		return fmt.Errorf("unknown encoding('%v')", c.Encoding)
+	}
+
+	switch c.EncodingErrors {
+	case "", EncodingErrorsStrict, EncodingErrorsReplace, EncodingErrorsSkip:
+	default:
+		return fmt.Errorf("unknown encoding_errors('%v'), must be 'strict', 'replace' or 'skip'", c.EncodingErrors)
+	}
+
+	// Patterns are compiled once and kept in the config, so validating the
+	// config again for every harvester does not compile them again
+	if err := CompileRegexps("include_lines", &c.IncludeLinesRegexp, c.IncludeLines); err != nil {
+		return err
+	}
+	if err := CompileRegexps("exclude_lines", &c.ExcludeLinesRegexp, c.ExcludeLines); err != nil {
+		return err
+	}
+
+	for i := range c.Redact {
+		redact := &c.Redact[i]
+		if err := CompileRegexp("redact", &redact.PatternRegexp, redact.Pattern); err != nil {
+			return err
+		}
+	}
+
+	if c.Multiline != nil && c.Multiline.Mode == "indent" {
+		if c.Multiline.Pattern != "" {
+			return fmt.Errorf("multiline.pattern can not be used with multiline.mode indent")
+		}
+	} else if c.Multiline != nil {
+		if c.Multiline.Mode != "" && c.Multiline.Mode != "pattern" {
+			return fmt.Errorf("unknown multiline.mode('%v'), must be 'pattern' or 'indent'", c.Multiline.Mode)
+		}
+		if c.Multiline.Pattern == "" {
+			return fmt.Errorf("multiline.pattern must be set")
+		}
+		if err := CompileRegexp("multiline.pattern", &c.Multiline.PatternRegexp, c.Multiline.Pattern); err != nil {
+			return err
+		}
+		if c.Multiline.Match != "before" && c.Multiline.Match != "after" {
+			return fmt.Errorf("unknown multiline.match('%v'), must be 'before' or 'after'", c.Multiline.Match)
+		}
+	}
+
+	if c.JSON != nil {
+		for field, typ := range c.JSON.Convert {
+			switch typ {
+			case ConvertInt, ConvertFloat, ConvertBool:
+			default:
+				return fmt.Errorf("unknown json.convert type('%v') for field '%v', must be 'int', 'float' or 'bool'", typ, field)
+			}
+		}
+	}
+
+	if c.Extract != nil {
+		if c.Extract.Pattern == "" {
+			return fmt.Errorf("extract.pattern must be set")
+		}
+		if err := CompileRegexp("extract.pattern", &c.Extract.PatternRegexp, c.Extract.Pattern); err != nil {
+			return err
+		}
+	}
+
+	if c.SFTP != nil {
+		if c.SFTP.KnownHosts == "" {
+			return fmt.Errorf("sftp.known_hosts must be set")
+		}
+		if c.SFTP.Password == "" && c.SFTP.PrivateKey == "" {
+			return fmt.Errorf("sftp.password or sftp.private_key must be set")
+		}
+	}
+
+	if c.Timestamp != nil {
+		if c.Timestamp.Layout == "" {
+			return fmt.Errorf("timestamp.layout must be set")
+		}
+		if err := CompileRegexp("timestamp.pattern", &c.Timestamp.PatternRegexp, c.Timestamp.Pattern); err != nil {
+			return err
+		}
+	}
+
+	// Jitter is a fraction of the backoff duration
+	if c.BackoffJitter < 0 || c.BackoffJitter > 1 {
+		return fmt.Errorf("backoff_jitter must be between 0 and 1, got %v", c.BackoffJitter)
+	}
+
+	if c.MaxEventsPerSecond < 0 {
+		return fmt.Errorf("max_events_per_second must not be negative, got %v", c.MaxEventsPerSecond)
+	}
+
+	if c.CRLineEndings && c.LineDelimiter != "" && c.LineDelimiter != "\n" {
+		return fmt.Errorf("cr_line_endings can only be used with the default line_delimiter")
+	}
+
+	if c.DecompressCmd != "" && strings.TrimSpace(c.DecompressCmd) == "" {
+		return fmt.Errorf("decompress_cmd must not be empty")
+	}
+
+	if c.BatchLines < 0 {
+		return fmt.Errorf("batch_lines must not be negative, got %v", c.BatchLines)
+	}
+	if c.BatchLines > 0 && c.Multiline != nil {
+		return fmt.Errorf("batch_lines can not be used with multiline")
+	}
+
+	if c.FingerprintSize < 0 {
+		return fmt.Errorf("fingerprint_size must not be negative, got %v", c.FingerprintSize)
+	}
+
+	if c.SkipHeaderLines < 0 {
+		return fmt.Errorf("skip_header_lines must not be negative, got %v", c.SkipHeaderLines)
+	}
+
+	if c.ReadErrorRetries < 0 {
+		return fmt.Errorf("read_error_retries must not be negative, got %v", c.ReadErrorRetries)
+	}
+
+	if c.StartOffset < 0 {
+		return fmt.Errorf("start_offset must not be negative, got %v", c.StartOffset)
+	}
+	if c.StartOffset > 0 && c.TailFiles {
+		return fmt.Errorf("start_offset and tail_files can not be used together")
+	}
+	if c.InputType == FileInputType && (c.StartOffset > 0 || c.TailFiles) {
+		return fmt.Errorf("start_offset and tail_files can not be used with input_type file")
+	}
+	if c.InputType == FramedInputType && c.StartOffset > 0 {
+		return fmt.Errorf("start_offset can not be used with input_type framed")
+	}
+
+	if c.MaxSymlinkDepth < 0 {
+		return fmt.Errorf("max_symlink_depth must not be negative, got %v", c.MaxSymlinkDepth)
+	}
+
+	if c.TailLines < 0 {
+		return fmt.Errorf("tail_lines must not be negative, got %v", c.TailLines)
+	}
+	if c.TailLines > 0 {
+		if c.StartOffset > 0 {
+			return fmt.Errorf("start_offset and tail_lines can not be used together")
+		}
+		if c.InputType == FileInputType || c.InputType == FramedInputType {
+			return fmt.Errorf("tail_lines can not be used with input_type %v", c.InputType)
+		}
+		if c.LineDelimiter != "" && c.LineDelimiter != DefaultLineDelimiter {
+			return fmt.Errorf("tail_lines can not be used with line_delimiter")
+		}
+		if strings.HasPrefix(strings.ToLower(c.Encoding), "utf-16") {
+			return fmt.Errorf("tail_lines can not be used with encoding %v", c.Encoding)
+		}
+	}
+
+	switch c.FramePrefixSize {
+	case 0, 1, 2, 4, 8:
+	default:
+		return fmt.Errorf("frame_prefix_size must be 1, 2, 4 or 8, got %v", c.FramePrefixSize)
+	}
+
+	switch c.FrameByteOrder {
+	case "", FrameByteOrderBig, FrameByteOrderLittle:
+	default:
+		return fmt.Errorf("unknown frame_byte_order('%v'), must be 'big' or 'little'", c.FrameByteOrder)
+	}
+
+	switch c.ShrinkPolicy {
+	case "", ShrinkPolicyRestart, ShrinkPolicyIgnore, ShrinkPolicyStop:
+	default:
+		return fmt.Errorf("unknown shrink_policy('%v'), must be 'restart', 'ignore' or 'stop'", c.ShrinkPolicy)
+	}
+
+	switch c.PartialLinePolicy {
+	case "", PartialLinePolicyEmit, PartialLinePolicyDiscard, PartialLinePolicyWaitForever:
+	default:
+		return fmt.Errorf("unknown partial_line_policy('%v'), must be 'emit', 'discard' or 'wait_forever'", c.PartialLinePolicy)
+	}
+
+	switch c.TeePolicy {
+	case "", TeePolicyBlock, TeePolicyDrop:
+	default:
+		return fmt.Errorf("unknown tee_policy('%v'), must be 'block' or 'drop'", c.TeePolicy)
+	}
+
+	if c.DropLinesOver < 0 {
+		return fmt.Errorf("drop_lines_over must not be negative, got %v", c.DropLinesOver)
+	}
+	if c.DropLinesOver > 0 && (c.InputType == FileInputType || c.InputType == FramedInputType) {
+		return fmt.Errorf("drop_lines_over can not be used with input_type %v", c.InputType)
+	}
+
+	if c.SampleRate < 0 {
+		return fmt.Errorf("sample_rate must not be negative, got %v", c.SampleRate)
+	}
+
+	if c.CompressTextOver < 0 {
+		return fmt.Errorf("compress_text_over must not be negative, got %v", c.CompressTextOver)
+	}
+
+	if c.MaxPartialBytes < 0 {
+		return fmt.Errorf("max_partial_bytes must not be negative, got %v", c.MaxPartialBytes)
+	}
+	if c.MaxPartialBytes > 0 && (c.InputType == FileInputType || c.InputType == FramedInputType) {
+		return fmt.Errorf("max_partial_bytes can not be used with input_type %v", c.InputType)
+	}
+
+	if c.DedupMaxLines < 0 {
+		return fmt.Errorf("dedup_max_lines must not be negative, got %v", c.DedupMaxLines)
+	}
+	if c.DedupWindow != "" && (c.Multiline != nil || c.BatchLines > 0) {
+		return fmt.Errorf("dedup_window can not be used with multiline or batch_lines")
+	}
+	if c.DedupWindow != "" && (c.InputType == FileInputType || c.InputType == FramedInputType) {
+		return fmt.Errorf("dedup_window can not be used with input_type %v", c.InputType)
+	}
+
+	switch c.RawBytes {
+	case "", RawBytesAdd, RawBytesReplace:
+	default:
+		return fmt.Errorf("unknown raw_bytes('%v'), must be 'add' or 'replace'", c.RawBytes)
+	}
+	if c.RawBytes != "" && (c.InputType == FileInputType || c.InputType == FramedInputType) {
+		return fmt.Errorf("raw_bytes can not be used with input_type %v", c.InputType)
+	}
+	if c.RawBytes != "" && len(c.Redact) > 0 {
+		// the raw bytes are sent as read, bypassing redact
+		return fmt.Errorf("raw_bytes can not be used with redact")
+	}
+
+	if c.CloseTimeout != "" && c.InputType == StdinInputType {
+		return fmt.Errorf("close_timeout can not be used with input_type stdin")
+	}
+
+	if c.FollowRenamed && c.ForceCloseFiles {
+		return fmt.Errorf("follow_renamed can not be used with force_close_files")
+	}
+
+	if c.MaxFileSize < 0 {
+		return fmt.Errorf("max_file_size must not be negative, got %v", c.MaxFileSize)
+	}
+	if c.MaxFileSizeTail < 0 || c.MaxFileSizeTail > c.MaxFileSize {
+		return fmt.Errorf("max_file_size_tail must be between 0 and max_file_size, got %v", c.MaxFileSizeTail)
+	}
+
+	for _, match := range EventIDPlaceholder.FindAllStringSubmatch(c.EventID, -1) {
+		switch match[1] {
+		case "source", "offset", "line":
+		default:
+			return fmt.Errorf("unknown event_id placeholder %v, must be %%{source}, %%{offset} or %%{line}", match[0])
+		}
+	}
+
+	return nil
+}
+
+func validateRegexps(name string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid %s pattern '%v': %v", name, pattern, err)
+		}
+	}
+	return nil
+}
+
+// CompileRegexp compiles pattern into r, unless r was compiled from pattern
+// before. name is the config option the pattern is read from and is only used
+// for error reporting.
+func CompileRegexp(name string, r **regexp.Regexp, pattern string) error {
+	if *r != nil && (*r).String() == pattern {
+		return nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid %s pattern '%v': %v", name, pattern, err)
+	}
+	*r = compiled
+	return nil
+}
+
+// CompileRegexps compiles all patterns into regexps, unless these were
+// compiled from the same patterns before.
+func CompileRegexps(name string, regexps *[]*regexp.Regexp, patterns []string) error {
+	if len(*regexps) == len(patterns) {
+		compiled := true
+		for i, r := range *regexps {
+			compiled = compiled && r.String() == patterns[i]
+		}
+		if compiled {
+			return nil
+		}
+	}
+
+	result := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		if err := CompileRegexp(name, &result[i], pattern); err != nil {
+			return err
+		}
+	}
+	*regexps = result
+	return nil
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvesterConfigValidate(t *testing.T) {
+	var tests = []struct {
+		config HarvesterConfig
+		valid  bool
+	}{
+		{HarvesterConfig{}, true},
+		{HarvesterConfig{Encoding: "utf-16le-bom"}, true},
+		{HarvesterConfig{Encoding: "no-such-encoding"}, false},
+		{HarvesterConfig{IncludeLines: []string{"^ERR"}}, true},
+		{HarvesterConfig{ExcludeLines: []string{"("}}, false},
+		{HarvesterConfig{Multiline: &MultilineConfig{Pattern: "^ ", Match: "after"}}, true},
+		{HarvesterConfig{Multiline: &MultilineConfig{Pattern: "^ ", Match: "around"}}, false},
+		{HarvesterConfig{Multiline: &MultilineConfig{Match: "after"}}, false},
+		{HarvesterConfig{Multiline: &MultilineConfig{Mode: "indent"}}, true},
+		{HarvesterConfig{Multiline: &MultilineConfig{Mode: "indent", Pattern: "^ "}}, false},
+		{HarvesterConfig{Multiline: &MultilineConfig{Mode: "block"}}, false},
+		{HarvesterConfig{BackoffJitter: 1.5}, false},
+		{HarvesterConfig{MaxEventsPerSecond: -1}, false},
+		{HarvesterConfig{StartOffset: 10}, true},
+		{HarvesterConfig{StartOffset: 10, TailFiles: true}, false},
+		{HarvesterConfig{InputType: FileInputType}, true},
+		{HarvesterConfig{EncodingErrors: EncodingErrorsSkip}, true},
+		{HarvesterConfig{EncodingErrors: "ignore"}, false},
+		{HarvesterConfig{ReadErrorRetries: 3}, true},
+		{HarvesterConfig{ReadErrorRetries: -1}, false},
+		{HarvesterConfig{SkipHeaderLines: 1}, true},
+		{HarvesterConfig{SkipHeaderLines: -1}, false},
+		{HarvesterConfig{BatchLines: 100}, true},
+		{HarvesterConfig{BatchLines: -1}, false},
+		{HarvesterConfig{FingerprintSize: 1024}, true},
+		{HarvesterConfig{FingerprintSize: -1}, false},
+		{HarvesterConfig{InputType: FramedInputType, FramePrefixSize: 2, FrameByteOrder: "little"}, true},
+		{HarvesterConfig{InputType: FramedInputType, StartOffset: 10}, false},
+		{HarvesterConfig{FramePrefixSize: 3}, false},
+		{HarvesterConfig{ShrinkPolicy: ShrinkPolicyIgnore}, true},
+		{HarvesterConfig{ShrinkPolicy: "truncate"}, false},
+		{HarvesterConfig{EventID: "%{source}:%{offset}:%{line}"}, true},
+		{HarvesterConfig{EventID: "%{inode}"}, false},
+		{HarvesterConfig{EventID: "%{source|base}:%{offset}"}, true},
+		{HarvesterConfig{EventID: "%{inode|base}"}, false},
+		{HarvesterConfig{MaxFileSize: 1 << 30, MaxFileSizeTail: 1 << 20}, true},
+		{HarvesterConfig{MaxFileSize: -1}, false},
+		{HarvesterConfig{MaxFileSizeTail: 1 << 20}, false},
+		{HarvesterConfig{FollowRenamed: true}, true},
+		{HarvesterConfig{FollowRenamed: true, ForceCloseFiles: true}, false},
+		{HarvesterConfig{FrameByteOrder: "middle"}, false},
+		{HarvesterConfig{BatchLines: 100, Multiline: &MultilineConfig{Mode: "indent"}}, false},
+		{HarvesterConfig{CRLineEndings: true, LineDelimiter: "\n"}, true},
+		{HarvesterConfig{CRLineEndings: true, LineDelimiter: "\x00"}, false},
+		{HarvesterConfig{DecompressCmd: "zstd -dc"}, true},
+		{HarvesterConfig{DecompressCmd: " "}, false},
+		{HarvesterConfig{InputType: FileInputType, TailFiles: true}, false},
+		{HarvesterConfig{JSON: &JSONConfig{Convert: map[string]string{"status": "int"}}}, true},
+		{HarvesterConfig{JSON: &JSONConfig{Convert: map[string]string{"status": "long"}}}, false},
+		{HarvesterConfig{MaxSymlinkDepth: -1}, false},
+		{HarvesterConfig{RawBytes: RawBytesAdd}, true},
+		{HarvesterConfig{RawBytes: "base64"}, false},
+		{HarvesterConfig{RawBytes: RawBytesReplace, InputType: FramedInputType}, false},
+		{HarvesterConfig{RawBytes: RawBytesAdd, Redact: []RedactConfig{{Pattern: "secret"}}}, false},
+		{HarvesterConfig{DedupWindow: "10s", DedupMaxLines: 1000}, true},
+		{HarvesterConfig{DedupMaxLines: -1}, false},
+		{HarvesterConfig{DedupWindow: "10s", BatchLines: 100}, false},
+		{HarvesterConfig{DedupWindow: "10s", InputType: FileInputType}, false},
+		{HarvesterConfig{MaxPartialBytes: 4096}, true},
+		{HarvesterConfig{MaxPartialBytes: -1}, false},
+		{HarvesterConfig{MaxPartialBytes: 4096, InputType: FramedInputType}, false},
+		{HarvesterConfig{CloseTimeout: "1h"}, true},
+		{HarvesterConfig{CloseTimeout: "1h", InputType: StdinInputType}, false},
+		{HarvesterConfig{DropLinesOver: 1 << 20}, true},
+		{HarvesterConfig{DropLinesOver: -1}, false},
+		{HarvesterConfig{DropLinesOver: 1 << 20, InputType: FileInputType}, false},
+		{HarvesterConfig{CompressTextOver: 4096}, true},
+		{HarvesterConfig{CompressTextOver: -1}, false},
+		{HarvesterConfig{TeePolicy: TeePolicyDrop}, true},
+		{HarvesterConfig{TeePolicy: "skip"}, false},
+		{HarvesterConfig{SampleRate: 100}, true},
+		{HarvesterConfig{SampleRate: -1}, false},
+		{HarvesterConfig{SFTP: &SFTPConfig{Password: "secret", KnownHosts: "known_hosts"}}, true},
+		{HarvesterConfig{SFTP: &SFTPConfig{PrivateKey: "id_ed25519", KnownHosts: "known_hosts"}}, true},
+		{HarvesterConfig{SFTP: &SFTPConfig{Password: "secret"}}, false},
+		{HarvesterConfig{SFTP: &SFTPConfig{KnownHosts: "known_hosts"}}, false},
+		{HarvesterConfig{PartialLinePolicy: PartialLinePolicyWaitForever}, true},
+		{HarvesterConfig{PartialLinePolicy: "skip"}, false},
+		{HarvesterConfig{Extract: &ExtractConfig{Pattern: `(?P<level>\w+)`}}, true},
+		{HarvesterConfig{Extract: &ExtractConfig{}}, false},
+		{HarvesterConfig{Extract: &ExtractConfig{Pattern: "(?P<level"}}, false},
+		{HarvesterConfig{TailLines: 10}, true},
+		{HarvesterConfig{TailLines: -1}, false},
+		{HarvesterConfig{TailLines: 10, StartOffset: 10}, false},
+		{HarvesterConfig{TailLines: 10, InputType: FileInputType}, false},
+		{HarvesterConfig{TailLines: 10, LineDelimiter: "\x00"}, false},
+		{HarvesterConfig{TailLines: 10, Encoding: "utf-16le"}, false},
+	}
+
+	for i, test := range tests {
+		err := test.config.Validate()
+		assert.Equal(t, test.valid, err == nil, "test %d: %v", i, err)
+	}
+}
+
+func TestHarvesterConfigValidateCompiles(t *testing.T) {
+	config := HarvesterConfig{
+		IncludeLines: []string{"^ERR"},
+		Redact:       []RedactConfig{{Pattern: "secret"}},
+	}
+	assert.Nil(t, config.Validate())
+	assert.Len(t, config.IncludeLinesRegexp, 1)
+	assert.NotNil(t, config.Redact[0].PatternRegexp)
+
+	// validating again keeps the compiled patterns
+	include := config.IncludeLinesRegexp[0]
+	redact := config.Redact[0].PatternRegexp
+	assert.Nil(t, config.Validate())
+	assert.True(t, include == config.IncludeLinesRegexp[0])
+	assert.True(t, redact == config.Redact[0].PatternRegexp)
+
+	// changed patterns are compiled again
+	config.IncludeLines = []string{"^WARN"}
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, "^WARN", config.IncludeLinesRegexp[0].String())
+}
+
+func TestProspectorConfigValidate(t *testing.T) {
+	config := ProspectorConfig{Paths: []string{"/var/log/*.log"}}
+	assert.Nil(t, config.Validate())
+
+	config = ProspectorConfig{Paths: []string{"/var/log/[.log"}}
+	assert.NotNil(t, config.Validate())
+
+	config = ProspectorConfig{ExcludeFiles: []string{"("}}
+	assert.NotNil(t, config.Validate())
+
+	config = ProspectorConfig{HarvesterLimit: -1}
+	assert.NotNil(t, config.Validate())
+
+	config = ProspectorConfig{Concat: true, Harvester: HarvesterConfig{InputType: FramedInputType}}
+	assert.NotNil(t, config.Validate())
+
+	config = ProspectorConfig{Concat: true, Harvester: HarvesterConfig{CloseTimeout: "1h"}}
+	assert.NotNil(t, config.Validate())
+
+	sftp := &SFTPConfig{Password: "secret", KnownHosts: "known_hosts"}
+	config = ProspectorConfig{Paths: []string{"sftp://host/var/log/app.log"}, Harvester: HarvesterConfig{SFTP: sftp}}
+	assert.Nil(t, config.Validate())
+
+	config = ProspectorConfig{Paths: []string{"sftp://host/var/log/app.log"}}
+	assert.NotNil(t, config.Validate())
+
+	config = ProspectorConfig{Paths: []string{"sftp://host/var/log/app.log"}, Concat: true, Harvester: HarvesterConfig{SFTP: sftp}}
+	assert.NotNil(t, config.Validate())
+}
+
+func TestProspectorConfigCheckPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-config")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("line\n"), 0600))
+
+	config := ProspectorConfig{Paths: []string{filepath.Join(dir, "*.log")}}
+	assert.Nil(t, config.CheckPaths())
+
+	if os.Getuid() != 0 {
+		os.Chmod(path, 0)
+		assert.NotNil(t, config.CheckPaths())
+	}
+}
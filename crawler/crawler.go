@@ -3,8 +3,10 @@ package crawler
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester"
 	"github.com/elastic/filebeat/input"
 	"github.com/elastic/libbeat/logp"
 )
@@ -23,8 +25,11 @@ import (
 
 type Crawler struct {
 	// Registrar object to persist the state
-	Registrar *Registrar
-	running   bool
+	Registrar   *Registrar
+	Metrics     *harvester.Metrics      // optional, updated by all harvesters
+	Tee         []chan *input.FileEvent // optional secondary spoolers receiving a copy of all events
+	running     bool
+	prospectors []*Prospector
 }
 
 func (crawler *Crawler) Start(files []config.ProspectorConfig, eventChan chan *input.FileEvent) {
@@ -33,13 +38,16 @@ func (crawler *Crawler) Start(files []config.ProspectorConfig, eventChan chan *i
 	crawler.running = true
 
 	// Prospect the globs/paths given on the command line and launch harvesters
-	for _, fileconfig := range files {
+	for i, fileconfig := range files {
 
 		logp.Debug("prospector", "File Configs: %v", fileconfig.Paths)
 
 		prospector := &Prospector{
 			ProspectorConfig: fileconfig,
 			registrar:        crawler.Registrar,
+			metrics:          crawler.Metrics,
+			tee:              crawler.Tee,
+			id:               strconv.Itoa(i),
 		}
 
 		err := prospector.Init()
@@ -49,6 +57,7 @@ func (crawler *Crawler) Start(files []config.ProspectorConfig, eventChan chan *i
 			os.Exit(1)
 		}
 
+		crawler.prospectors = append(crawler.prospectors, prospector)
 		go prospector.Run(eventChan)
 		pendingProspectorCnt++
 	}
@@ -78,6 +87,11 @@ func (crawler *Crawler) Start(files []config.ProspectorConfig, eventChan chan *i
 	logp.Info("All prospectors initialised with %d states to persist", len(crawler.Registrar.State))
 }
 
+// Stop stops all prospectors and their harvesters
 func (crawler *Crawler) Stop() {
-	// TODO: Properly stop prospectors and harvesters
+	crawler.running = false
+
+	for _, prospector := range crawler.prospectors {
+		prospector.Stop()
+	}
 }
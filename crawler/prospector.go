@@ -3,7 +3,7 @@ package crawler
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	cfg "github.com/elastic/filebeat/config"
@@ -20,12 +20,25 @@ type Prospector struct {
 	registrar        *Registrar
 	missingFiles     map[string]os.FileInfo
 	running          bool
+	initialScanDone  bool                          /* files found after the first scan were created while running */
+	harvesters       map[*harvester.Harvester]bool /* running harvesters, stopped on Stop */
+	harvesterCount   int                           /* number of running harvesters */
+	harvesterQueue   []*harvester.Harvester        /* harvesters waiting for harvester_limit */
+	metrics          *harvester.Metrics            /* optional, shared by all prospectors */
+	tee              []chan *input.FileEvent       /* optional secondary spoolers, see tee_policy */
+	id               string                        /* index of the prospector in the config, label of its metrics */
+	mutex            sync.Mutex
 }
 
 // Init sets up default config for prospector
 func (p *Prospector) Init() error {
 
-	err := p.setupProspectorConfig()
+	err := p.ProspectorConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = p.setupProspectorConfig()
 	if err != nil {
 		return err
 	}
@@ -54,6 +67,15 @@ func (p *Prospector) setupProspectorConfig() error {
 		return err
 	}
 
+	config.ExcludeFilesRegexp = nil
+	for _, pattern := range config.ExcludeFiles {
+		r, err := input.CompilePathRegexp(pattern, config.CaseInsensitive)
+		if err != nil {
+			return fmt.Errorf("invalid exclude_files pattern '%v': %v", pattern, err)
+		}
+		config.ExcludeFilesRegexp = append(config.ExcludeFilesRegexp, r)
+	}
+
 	// Init File Stat list
 	p.prospectorList = make(map[string]harvester.FileStat)
 
@@ -71,6 +93,16 @@ func (p *Prospector) setupHarvesterConfig() error {
 		config.BufferSize = cfg.DefaultHarvesterBufferSize
 	}
 
+	// Setup max bytes per line
+	if config.MaxBytes == 0 {
+		config.MaxBytes = cfg.DefaultMaxBytes
+	}
+
+	// Setup line delimiter
+	if config.LineDelimiter == "" {
+		config.LineDelimiter = cfg.DefaultLineDelimiter
+	}
+
 	// Setup DocumentType
 	if config.DocumentType == "" {
 		config.DocumentType = cfg.DefaultDocumentType
@@ -81,6 +113,32 @@ func (p *Prospector) setupHarvesterConfig() error {
 		config.InputType = cfg.DefaultInputType
 	}
 
+	if config.EncodingErrors == "" {
+		config.EncodingErrors = cfg.DefaultEncodingErrors
+	}
+
+	if config.FramePrefixSize == 0 {
+		config.FramePrefixSize = cfg.DefaultFramePrefixSize
+	}
+	if config.FrameByteOrder == "" {
+		config.FrameByteOrder = cfg.DefaultFrameByteOrder
+	}
+
+	if config.ShrinkPolicy == "" {
+		config.ShrinkPolicy = cfg.DefaultShrinkPolicy
+	}
+	if config.PartialLinePolicy == "" {
+		config.PartialLinePolicy = cfg.DefaultPartialLinePolicy
+	}
+
+	if config.Symlinks == nil {
+		symlinks := cfg.DefaultSymlinks
+		config.Symlinks = &symlinks
+	}
+	if config.MaxSymlinkDepth == 0 {
+		config.MaxSymlinkDepth = cfg.DefaultMaxSymlinkDepth
+	}
+
 	config.BackoffDuration, err = getConfigDuration(config.Backoff, cfg.DefaultBackoff, "backoff")
 	if err != nil {
 		return err
@@ -101,6 +159,79 @@ func (p *Prospector) setupHarvesterConfig() error {
 		return err
 	}
 
+	config.PartialLinePollDuration, err = getConfigDuration(config.PartialLinePollInterval, cfg.DefaultPartialLinePollInterval, "partial_line_poll_interval")
+	if err != nil {
+		return err
+	}
+
+	config.SpoolerSendTimeoutDuration, err = getConfigDuration(config.SpoolerSendTimeout, 0, "spooler_send_timeout")
+	if err != nil {
+		return err
+	}
+
+	config.CloseOlderDuration, err = getConfigDuration(config.CloseOlder, cfg.DefaultCloseOlder, "close_older")
+	if err != nil {
+		return err
+	}
+
+	// Setup open retries. 0 disables retries, negative values retry forever
+	if config.MaxOpenRetries == nil {
+		retries := cfg.DefaultMaxOpenRetries
+		config.MaxOpenRetries = &retries
+	}
+
+	config.OpenRetryBackoffDuration, err = getConfigDuration(config.OpenRetryBackoff, cfg.DefaultOpenRetryBackoff, "open_retry_backoff")
+	if err != nil {
+		return err
+	}
+
+	config.ReadDeadlineDuration, err = getConfigDuration(config.ReadDeadline, 0, "read_deadline")
+	if err != nil {
+		return err
+	}
+
+	config.BatchTimeoutDuration, err = getConfigDuration(config.BatchTimeout, cfg.DefaultBatchTimeout, "batch_timeout")
+	if err != nil {
+		return err
+	}
+
+	config.DedupWindowDuration, err = getConfigDuration(config.DedupWindow, 0, "dedup_window")
+	if err != nil {
+		return err
+	}
+
+	config.HeartbeatIntervalDuration, err = getConfigDuration(config.HeartbeatInterval, 0, "heartbeat_interval")
+	if err != nil {
+		return err
+	}
+
+	config.CloseTimeoutDuration, err = getConfigDuration(config.CloseTimeout, 0, "close_timeout")
+	if err != nil {
+		return err
+	}
+
+	config.EmptyFileTimeoutDuration, err = getConfigDuration(config.EmptyFileTimeout, 0, "empty_file_timeout")
+	if err != nil {
+		return err
+	}
+
+	config.DeviceCheckDuration, err = getConfigDuration(config.DeviceCheckInterval, 0, "device_check_interval")
+	if err != nil {
+		return err
+	}
+
+	config.FutureMtimeSkewDuration, err = getConfigDuration(config.FutureMtimeSkew, cfg.DefaultFutureMtimeSkew, "future_mtime_skew")
+	if err != nil {
+		return err
+	}
+
+	if config.Multiline != nil {
+		config.Multiline.TimeoutDuration, err = getConfigDuration(config.Multiline.Timeout, cfg.DefaultMultilineTimeout, "multiline.timeout")
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -114,7 +245,7 @@ func getConfigDuration(config string, duration time.Duration, name string) (time
 		var err error
 		duration, err = time.ParseDuration(config)
 		if err != nil {
-			logp.Warn("Failed to parse %s value '%s'. Error was: %s\n", name, config)
+			logp.Warn("Failed to parse %s value '%s'. Error was: %s\n", name, config, err)
 			return 0, err
 		}
 	}
@@ -126,28 +257,45 @@ func getConfigDuration(config string, duration time.Duration, name string) (time
 // Starts scanning through all the file paths and fetch the related files. Start a harvester for each file
 func (p *Prospector) Run(spoolChan chan *input.FileEvent) {
 
+	p.mutex.Lock()
 	p.running = true
+	p.mutex.Unlock()
 
-	// Handle any "-" (stdin) paths
-	for i, path := range p.ProspectorConfig.Paths {
+	// Handle any "-" (stdin), fd: (file descriptor), unix:// (socket) and
+	// sftp:// (remote file) paths. They are removed from the paths, leaving the
+	// globs to scan.
+	var globs []string
+	for _, path := range p.ProspectorConfig.Paths {
 
 		logp.Debug("prospector", "Harvest path: %s", path)
 
-		if path == "-" {
-			// Offset and Initial never get used when path is "-"
+		if harvester.IsStreamPath(path) || harvester.IsSocketPath(path) {
+			// Offset and Initial never get used for streams and sockets
 			h, err := harvester.NewHarvester(
 				p.ProspectorConfig, &p.ProspectorConfig.Harvester,
-				path, nil, spoolChan)
+				path, nil, spoolChan, p.tee...)
 			if err != nil {
 				logp.Err("Error initializing harvester: %v", err)
 				return
 			}
 
-			h.Start()
+			p.startHarvester(h)
+			continue
+		}
+		if harvester.IsSFTPPath(path) {
+			p.startPathHarvester(path, spoolChan)
+			continue
+		}
+		globs = append(globs, path)
+	}
+	p.ProspectorConfig.Paths = globs
 
-			// Remove it from the file list
-			p.ProspectorConfig.Paths = append(p.ProspectorConfig.Paths[:i], p.ProspectorConfig.Paths[i+1:]...)
+	// With concat, all files matching a path are read by one harvester
+	if p.ProspectorConfig.Concat {
+		for _, path := range p.ProspectorConfig.Paths {
+			p.startPathHarvester(path, spoolChan)
 		}
+		p.ProspectorConfig.Paths = nil
 	}
 
 	// Seed last scan time
@@ -157,6 +305,7 @@ func (p *Prospector) Run(spoolChan chan *input.FileEvent) {
 	for _, path := range p.ProspectorConfig.Paths {
 		p.scan(path, spoolChan)
 	}
+	p.initialScanDone = true
 
 	// This signals we finished considering the previous state
 	event := &input.FileState{
@@ -187,19 +336,39 @@ func (p *Prospector) Run(spoolChan chan *input.FileEvent) {
 
 		p.iteration++ // Overflow is allowed
 
-		if !p.running {
+		if !p.isRunning() {
 			break
 		}
 	}
 }
 
+// startPathHarvester starts a harvester reading path as one source not found
+// by scanning, i.e. all files matching the glob path with concat or a remote
+// file. Reading continues at the offset stored for the path.
+func (p *Prospector) startPathHarvester(path string, output chan *input.FileEvent) {
+	h, err := harvester.NewHarvester(
+		p.ProspectorConfig, &p.ProspectorConfig.Harvester,
+		path, nil, output, p.tee...)
+	if err != nil {
+		logp.Err("Error initializing harvester: %v", err)
+		return
+	}
+
+	if state, found := p.registrar.GetFileState(h.Source); found {
+		logp.Debug("prospector", "Resuming harvester on: %s", path)
+		h.Offset = state.Offset
+	}
+
+	p.startHarvester(h)
+}
+
 // Scans the specific path which can be a glob (/**/**/*.log)
 // For all found files it is checked if a harvester should be started
 func (p *Prospector) scan(path string, output chan *input.FileEvent) {
 
 	logp.Debug("prospector", "scan path %s", path)
 	// Evaluate the path as a wildcards/shell glob
-	matches, err := filepath.Glob(path)
+	matches, err := input.Glob(path, p.ProspectorConfig.CaseInsensitive)
 	if err != nil {
 		logp.Debug("prospector", "glob(%s) failed: %v", path, err)
 		return
@@ -229,6 +398,22 @@ func (p *Prospector) scan(path string, output chan *input.FileEvent) {
 			continue
 		}
 
+		if p.isFileExcluded(file) {
+			logp.Debug("prospector", "Exclude file: %s", file)
+			continue
+		}
+
+		if input.IsSymlink(file) {
+			if !*p.ProspectorConfig.Harvester.Symlinks {
+				logp.Debug("prospector", "Skipping symlink, as symlinks is disabled: %s", file)
+				continue
+			}
+			if _, err := input.ResolveSymlink(file, p.ProspectorConfig.Harvester.MaxSymlinkDepth); err != nil {
+				logp.Debug("prospector", "Skipping symlink %s: %s", file, err)
+				continue
+			}
+		}
+
 		// Check the current info against p.prospectorinfo[file]
 		lastinfo, isKnown := p.prospectorList[file]
 
@@ -255,6 +440,12 @@ func (p *Prospector) scan(path string, output chan *input.FileEvent) {
 	} // for each file matched by the glob
 }
 
+// isFileExcluded checks if the given path matches any of the exclude_files
+// patterns
+func (p *Prospector) isFileExcluded(file string) bool {
+	return input.MatchPath(p.ProspectorConfig.ExcludeFilesRegexp, file)
+}
+
 // Check if harvester for new file has to be started
 // For a new file the following options exist:
 func (p *Prospector) checkNewFile(newinfo *harvester.FileStat, file string, output chan *input.FileEvent) {
@@ -263,7 +454,7 @@ func (p *Prospector) checkNewFile(newinfo *harvester.FileStat, file string, outp
 
 	// Init harvester with info
 	h, err := harvester.NewHarvester(
-		p.ProspectorConfig, &p.ProspectorConfig.Harvester, file, newinfo, output)
+		p.ProspectorConfig, &p.ProspectorConfig.Harvester, file, newinfo, output, p.tee...)
 	if err != nil {
 		logp.Err("Error initializing harvester: %v", err)
 		return
@@ -276,7 +467,7 @@ func (p *Prospector) checkNewFile(newinfo *harvester.FileStat, file string, outp
 
 		logp.Debug("prospector", "Fetching old state of file to resume: %s", file)
 		// Call crawler if there if there exists a state for the given file
-		offset, resuming := p.registrar.fetchState(file, newinfo.Fileinfo)
+		offset, resuming := p.registrar.fetchState(h.Source, file, newinfo.Fileinfo)
 
 		// Are we resuming a dead file? We have to resume even if dead so we catch any old updates to the file
 		// This is safe as the harvester, once it hits the EOF and a timeout, will stop harvesting
@@ -285,7 +476,7 @@ func (p *Prospector) checkNewFile(newinfo *harvester.FileStat, file string, outp
 			logp.Debug("prospector", "Resuming harvester on a previously harvested file: %s", file)
 
 			h.Offset = offset
-			h.Start()
+			p.startHarvester(h)
 		} else {
 			// Old file, skip it, but push offset of file size so we start from the end if this file changes and needs picking up
 			logp.Debug("prospector", "Skipping file (older than ignore older of %v, %v): %s",
@@ -302,18 +493,29 @@ func (p *Prospector) checkNewFile(newinfo *harvester.FileStat, file string, outp
 	} else {
 
 		// Call crawler if there if there exists a state for the given file
-		offset, resuming := p.registrar.fetchState(file, newinfo.Fileinfo)
+		offset, resuming := p.registrar.fetchState(h.Source, file, newinfo.Fileinfo)
 
 		// Are we resuming a file or is this a completely new file?
 		if resuming {
 			logp.Debug("prospector", "Resuming harvester on a previously harvested file: %s", file)
+		} else if p.skipEmptyFile(newinfo) {
+			// Push offset 0, so the file is read from the beginning once it grows
+			logp.Debug("prospector", "Skipping empty file until it grows: %s", file)
+			newinfo.Skip(0)
+			return
 		} else {
 			logp.Debug("prospector", "Launching harvester on new file: %s", file)
+
+			// tail_files only applies to files existing on startup. Files
+			// created later are read from the beginning.
+			if p.initialScanDone {
+				h.TailFiles = false
+			}
 		}
 
 		// Launch the harvester
 		h.Offset = offset
-		h.Start()
+		p.startHarvester(h)
 	}
 }
 
@@ -330,7 +532,7 @@ func (p *Prospector) checkExistingFile(newinfo *harvester.FileStat, newFile *inp
 
 	h, err := harvester.NewHarvester(
 		p.ProspectorConfig, &p.ProspectorConfig.Harvester,
-		file, newinfo, output)
+		file, newinfo, output, p.tee...)
 	if err != nil {
 		logp.Err("Error initializing harvester: %v", err)
 		return
@@ -353,28 +555,115 @@ func (p *Prospector) checkExistingFile(newinfo *harvester.FileStat, newFile *inp
 			newinfo.Ignore()
 
 			// Start a new harvester on the path
-			h.Start()
+			p.startHarvester(h)
 		}
 
 		// Keep the old file in missingFiles so we don't rescan it if it was renamed and we've not yet reached the new filename
 		// We only need to keep it for the remainder of this iteration then we can assume it was deleted and forget about it
 		p.missingFiles[file] = oldFile.FileInfo
 
-	} else if newinfo.Finished() && oldFile.FileInfo.ModTime() != newinfo.Fileinfo.ModTime() {
+	} else if newinfo.Finished() && oldFile.FileInfo.ModTime() != newinfo.Fileinfo.ModTime() && !p.skipEmptyFile(newinfo) {
 		// Resume harvesting of an old file we've stopped harvesting from
 		logp.Debug("prospector", "Resuming harvester on an old file that was just modified: %s", file)
 
 		// Start a harvester on the path; an old file was just modified and it doesn't have a harvester
 		// The offset to continue from will be stored in the harvester channel - so take that to use and also clear the channel
 		h.Offset = <-newinfo.Return
-		h.Start()
+		if h.Offset == 0 {
+			// Nothing was read before, e.g. from an empty file. tail_files
+			// only applies to the first harvester of a file.
+			h.TailFiles = false
+		}
+		p.startHarvester(h)
 	} else {
 		logp.Debug("prospector", "Not harvesting, file didn't change: %s", file)
 	}
 }
 
+// skipEmptyFile checks if no harvester is started for the file as it is
+// empty and skip_empty_files is set. Pipes and sockets have no size.
+func (p *Prospector) skipEmptyFile(info *harvester.FileStat) bool {
+	return p.ProspectorConfig.Harvester.SkipEmptyFiles &&
+		info.Fileinfo.Mode().IsRegular() && info.Fileinfo.Size() == 0
+}
+
+// Stop stops scanning for new files and stops all harvesters started by the
+// prospector
 func (p *Prospector) Stop() {
-	// TODO: Stopping is currently not implemented
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running = false
+	for h := range p.harvesters {
+		h.Stop()
+	}
+	p.harvesters = nil
+	p.harvesterQueue = nil
+}
+
+func (p *Prospector) isRunning() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.running
+}
+
+// startHarvester starts h unless the prospector was stopped. Harvesters are
+// remembered until they finish, so they can be stopped with the prospector. If
+// harvester_limit harvesters are running, h is queued until a running
+// harvester finished.
+func (p *Prospector) startHarvester(h *harvester.Harvester) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.running {
+		logp.Debug("prospector", "Prospector stopped. Not starting harvester for %s", h.Path)
+		return
+	}
+
+	h.Metrics = p.metrics.Source(p.id, h.Source)
+
+	limit := p.ProspectorConfig.HarvesterLimit
+	if limit > 0 && p.harvesterCount >= limit {
+		logp.Debug("prospector", "harvester_limit of %d reached. Queueing harvester for %s", limit, h.Path)
+		p.harvesterQueue = append(p.harvesterQueue, h)
+		return
+	}
+
+	p.runHarvester(h)
+}
+
+// runHarvester runs h in a new goroutine. Must be called with p.mutex held.
+func (p *Prospector) runHarvester(h *harvester.Harvester) {
+	if p.harvesters == nil {
+		p.harvesters = map[*harvester.Harvester]bool{}
+	}
+	p.harvesters[h] = true
+	p.harvesterCount++
+
+	go func() {
+		h.Harvest()
+		p.harvesterFinished(h)
+	}()
+}
+
+// harvesterFinished is called once h returned and pushed its last offset. A
+// harvester only backing off on an idle file is still running and keeps its
+// slot. The next queued harvester is started in place of h.
+func (p *Prospector) harvesterFinished(h *harvester.Harvester) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.harvesterCount--
+	delete(p.harvesters, h)
+
+	if !p.running || len(p.harvesterQueue) == 0 {
+		return
+	}
+
+	next := p.harvesterQueue[0]
+	p.harvesterQueue = p.harvesterQueue[1:]
+	logp.Debug("prospector", "Starting queued harvester for %s", next.Path)
+	p.runHarvester(next)
 }
 
 // Check if the given file was renamed. If file is known but with different path,
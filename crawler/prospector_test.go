@@ -1,10 +1,15 @@
 package crawler
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester"
+	"github.com/elastic/filebeat/input"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,9 +28,7 @@ func TestProspectorInit(t *testing.T) {
 		ProspectorConfig: prospectorConfig,
 	}
 
-	assert.NotNil(t, prospector)
-
-	prospector.Init()
+	assert.Nil(t, prospector.Init())
 
 	// Predefined values expected
 	assert.Equal(t, 100*time.Minute, prospector.ProspectorConfig.IgnoreOlderDuration)
@@ -75,6 +78,9 @@ func TestProspectorInitNotSet(t *testing.T) {
 	assert.Equal(t, config.DefaultMaxBackoff, prospector.ProspectorConfig.Harvester.MaxBackoffDuration)
 	assert.Equal(t, config.DefaultPartialLineWaiting, prospector.ProspectorConfig.Harvester.PartialLineWaitingDuration)
 	assert.Equal(t, config.DefaultForceCloseFiles, prospector.ProspectorConfig.Harvester.ForceCloseFiles)
+	assert.Equal(t, config.DefaultMaxBytes, prospector.ProspectorConfig.Harvester.MaxBytes)
+	assert.Equal(t, config.DefaultCloseOlder, prospector.ProspectorConfig.Harvester.CloseOlderDuration)
+	assert.Equal(t, config.DefaultPartialLinePollInterval, prospector.ProspectorConfig.Harvester.PartialLinePollDuration)
 }
 
 func TestProspectorInitScanFrequency0(t *testing.T) {
@@ -121,3 +127,269 @@ func TestProspectorInitInvalidIgnoreOlder(t *testing.T) {
 	err := prospector.Init()
 	assert.NotNil(t, err)
 }
+
+func TestProspectorInitCloseOlder(t *testing.T) {
+
+	prospectorConfig := config.ProspectorConfig{
+		Harvester: config.HarvesterConfig{
+			CloseOlder: "5m",
+		},
+	}
+
+	prospector := Prospector{
+		ProspectorConfig: prospectorConfig,
+	}
+
+	err := prospector.Init()
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Minute, prospector.ProspectorConfig.Harvester.CloseOlderDuration)
+}
+
+func TestProspectorInitMaxOpenRetries(t *testing.T) {
+
+	prospector := Prospector{}
+
+	err := prospector.Init()
+	assert.Nil(t, err)
+	assert.Equal(t, config.DefaultMaxOpenRetries, *prospector.ProspectorConfig.Harvester.MaxOpenRetries)
+
+	// 0 disables retries instead of using the default
+	maxRetries := 0
+	prospector = Prospector{
+		ProspectorConfig: config.ProspectorConfig{
+			Harvester: config.HarvesterConfig{
+				MaxOpenRetries: &maxRetries,
+			},
+		},
+	}
+
+	err = prospector.Init()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, *prospector.ProspectorConfig.Harvester.MaxOpenRetries)
+}
+
+func TestProspectorInitSymlinks(t *testing.T) {
+
+	prospector := Prospector{}
+
+	// symlinks are followed unless disabled
+	err := prospector.Init()
+	assert.Nil(t, err)
+	assert.True(t, *prospector.ProspectorConfig.Harvester.Symlinks)
+
+	symlinks := false
+	prospector.ProspectorConfig.Harvester.Symlinks = &symlinks
+	err = prospector.Init()
+	assert.Nil(t, err)
+	assert.False(t, *prospector.ProspectorConfig.Harvester.Symlinks)
+}
+
+func TestProspectorInitInvalidBackoffJitter(t *testing.T) {
+
+	prospectorConfig := config.ProspectorConfig{
+		Harvester: config.HarvesterConfig{
+			BackoffJitter: 1.5,
+		},
+	}
+
+	prospector := Prospector{
+		ProspectorConfig: prospectorConfig,
+	}
+
+	err := prospector.Init()
+	assert.NotNil(t, err)
+}
+
+func TestProspectorInitExcludeFiles(t *testing.T) {
+
+	prospectorConfig := config.ProspectorConfig{
+		ExcludeFiles: []string{`\.gz$`},
+	}
+
+	prospector := Prospector{
+		ProspectorConfig: prospectorConfig,
+	}
+
+	err := prospector.Init()
+	assert.Nil(t, err)
+	assert.True(t, prospector.isFileExcluded("/var/log/app.log.1.gz"))
+	assert.False(t, prospector.isFileExcluded("/var/log/app.log"))
+
+	assert.False(t, prospector.isFileExcluded("/var/log/app.log.1.GZ"))
+
+	prospector.ProspectorConfig.CaseInsensitive = true
+	err = prospector.Init()
+	assert.Nil(t, err)
+	assert.True(t, prospector.isFileExcluded("/var/log/app.log.1.GZ"))
+
+	prospector.ProspectorConfig.ExcludeFiles = []string{"("}
+	err = prospector.Init()
+	assert.NotNil(t, err)
+}
+
+func TestProspectorInitCompileRegexps(t *testing.T) {
+
+	prospectorConfig := config.ProspectorConfig{
+		Harvester: config.HarvesterConfig{
+			IncludeLines: []string{"^ERR"},
+			Redact:       []config.RedactConfig{{Pattern: "[0-9]+"}},
+			Multiline:    &config.MultilineConfig{Pattern: "^ ", Match: "after"},
+		},
+	}
+
+	prospector := Prospector{
+		ProspectorConfig: prospectorConfig,
+	}
+
+	err := prospector.Init()
+	assert.Nil(t, err)
+
+	// Patterns are compiled on validation and shared by all harvesters
+	cfg := prospector.ProspectorConfig.Harvester
+	assert.Len(t, cfg.IncludeLinesRegexp, 1)
+	assert.Nil(t, cfg.ExcludeLinesRegexp)
+	assert.NotNil(t, cfg.Redact[0].PatternRegexp)
+	assert.NotNil(t, cfg.Multiline.PatternRegexp)
+}
+
+func TestProspectorHarvesterLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-limit")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	prospector := Prospector{
+		ProspectorConfig: config.ProspectorConfig{
+			HarvesterLimit: 1,
+			Harvester: config.HarvesterConfig{
+				CloseEOF: true,
+			},
+		},
+	}
+	err = prospector.Init()
+	assert.Nil(t, err)
+	prospector.running = true
+
+	// spooler blocks until events are read, so the first harvester keeps running
+	spooler := make(chan *input.FileEvent)
+	for _, name := range []string{"a.log", "b.log"} {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(name+"\n"), 0644)
+
+		h, err := harvester.NewHarvester(
+			prospector.ProspectorConfig, &prospector.ProspectorConfig.Harvester,
+			path, nil, spooler)
+		assert.Nil(t, err)
+		prospector.startHarvester(h)
+	}
+
+	prospector.mutex.Lock()
+	assert.Equal(t, 1, prospector.harvesterCount)
+	assert.Equal(t, 1, len(prospector.harvesterQueue))
+	prospector.mutex.Unlock()
+
+	// queued harvester is started once the first one finished
+	assert.Equal(t, "a.log", *(<-spooler).Text)
+	assert.Equal(t, "b.log", *(<-spooler).Text)
+
+	prospector.Stop()
+}
+
+func TestProspectorTailFilesCreatedWhileRunning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-tail")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "existing.log"), []byte("old line\n"), 0644)
+
+	prospector := Prospector{
+		ProspectorConfig: config.ProspectorConfig{
+			Harvester: config.HarvesterConfig{
+				TailFiles: true,
+			},
+		},
+		registrar: &Registrar{
+			State:   map[string]*input.FileState{},
+			Persist: make(chan *input.FileState, 10),
+		},
+	}
+	err = prospector.Init()
+	assert.Nil(t, err)
+	prospector.running = true
+	prospector.lastscan = time.Now()
+	defer prospector.Stop()
+
+	// existing file is tailed on startup
+	spooler := make(chan *input.FileEvent, 10)
+	path := filepath.Join(dir, "*.log")
+	prospector.scan(path, spooler)
+	prospector.initialScanDone = true
+
+	// file created while running is read from the beginning
+	ioutil.WriteFile(filepath.Join(dir, "new.log"), []byte("new line\n"), 0644)
+	prospector.scan(path, spooler)
+
+	select {
+	case event := <-spooler:
+		assert.Equal(t, "new line", *event.Text)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No event received for new file")
+	}
+	assert.Equal(t, 0, len(spooler))
+}
+
+func TestProspectorSkipEmptyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-empty")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "empty.log")
+	ioutil.WriteFile(file, nil, 0644)
+
+	prospector := Prospector{
+		ProspectorConfig: config.ProspectorConfig{
+			Harvester: config.HarvesterConfig{
+				TailFiles:      true,
+				SkipEmptyFiles: true,
+			},
+		},
+		registrar: &Registrar{
+			State:   map[string]*input.FileState{},
+			Persist: make(chan *input.FileState, 10),
+		},
+	}
+	err = prospector.Init()
+	assert.Nil(t, err)
+	prospector.running = true
+	prospector.lastscan = time.Now()
+	defer prospector.Stop()
+
+	// no harvester is started for the empty file
+	spooler := make(chan *input.FileEvent, 10)
+	path := filepath.Join(dir, "*.log")
+	prospector.scan(path, spooler)
+	prospector.initialScanDone = true
+
+	prospector.mutex.Lock()
+	assert.Equal(t, 0, prospector.harvesterCount)
+	prospector.mutex.Unlock()
+
+	// once the file grows, it is read from the beginning despite tail_files
+	ioutil.WriteFile(file, []byte("first line\n"), 0644)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(file, later, later)
+	prospector.scan(path, spooler)
+
+	select {
+	case event := <-spooler:
+		assert.Equal(t, "first line", *event.Text)
+		assert.Equal(t, int64(0), event.Offset)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No event received for file that grew")
+	}
+}
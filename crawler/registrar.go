@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	cfg "github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester"
 	"github.com/elastic/filebeat/input"
 	. "github.com/elastic/filebeat/input"
 	"github.com/elastic/libbeat/logp"
@@ -111,17 +112,56 @@ func (r *Registrar) processEvents(events []*FileEvent) {
 	logp.Debug("registrar", "Processing %d events", len(events))
 
 	// Take the last event found for each file source
+	updated := map[string]*FileState{}
 	for _, event := range events {
 		if !r.running {
 			break
 		}
 
-		// skip stdin
-		if *event.Source == "-" {
+		// skip stdin, file descriptors and sockets
+		if harvester.IsStreamPath(*event.Source) || harvester.IsSocketPath(*event.Source) {
 			continue
 		}
 
-		r.State[*event.Source] = event.GetState()
+		// error and heartbeat events do not change the state of the file
+		if event.Error != "" || event.Heartbeat {
+			continue
+		}
+
+		state := event.GetState()
+		r.State[*event.Source] = state
+		updated[*event.Source] = state
+	}
+
+	for path, state := range updated {
+		r.removeRenamed(path, state)
+	}
+}
+
+// removeRenamed deletes states of the same file stored under a different path.
+// This happens if a file was renamed, e.g. by log rotation. States of paths
+// still referring to the file are kept, e.g. of a symlink harvested separately
+// from its target.
+func (r *Registrar) removeRenamed(path string, state *FileState) {
+	if state.FileStateOS == nil {
+		return
+	}
+
+	for oldPath, oldState := range r.State {
+		if oldPath == path || oldState.FileStateOS == nil {
+			continue
+		}
+
+		if !state.FileStateOS.IsSame(oldState.FileStateOS) {
+			continue
+		}
+
+		if info, err := os.Stat(oldPath); err == nil && state.FileStateOS.IsSame(GetOSFileState(&info)) {
+			continue
+		}
+
+		logp.Debug("registrar", "Remove state of renamed file: %s -> %s", oldPath, path)
+		delete(r.State, oldPath)
 	}
 }
 
@@ -159,10 +199,12 @@ func (r *Registrar) writeRegistry() error {
 	return SafeFileRotate(r.registryFile, tempfile)
 }
 
-func (r *Registrar) fetchState(filePath string, fileInfo os.FileInfo) (int64, bool) {
+// fetchState returns the offset stored for the file at filePath. The state is
+// looked up by source, the path or its normalized form used by the harvester.
+func (r *Registrar) fetchState(source string, filePath string, fileInfo os.FileInfo) (int64, bool) {
 
 	// Check if there is a state for this file
-	lastState, isFound := r.GetFileState(filePath)
+	lastState, isFound := r.GetFileState(source)
 
 	if isFound && input.IsSameFile(filePath, fileInfo) {
 		logp.Debug("registar", "Same file as before found. Fetch the state and persist it.")
@@ -172,14 +214,14 @@ func (r *Registrar) fetchState(filePath string, fileInfo os.FileInfo) (int64, bo
 		return lastState.Offset, true
 	}
 
-	if previous, err := r.getPreviousFile(filePath, fileInfo); err == nil {
+	if previous, err := r.getPreviousFile(source, fileInfo); err == nil {
 		// File has rotated between shutdown and startup
 		// We return last state downstream, with a modified event source with the new file name
 		// And return the offset - also force harvest in case the file is old and we're about to skip it
 		logp.Info("Detected rename of a previously harvested file: %s -> %s", previous, filePath)
 
 		lastState, _ := r.GetFileState(previous)
-		lastState.Source = &filePath
+		lastState.Source = &source
 		r.Persist <- lastState
 		return lastState.Offset, true
 	}
@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrarRemoveRenamed(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-registrar")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	info, err := os.Stat(file.Name())
+	assert.Nil(t, err)
+
+	oldPath := "/var/log/app.log"
+	newPath := "/var/log/app.log.1"
+
+	r := &Registrar{
+		State:   map[string]*input.FileState{},
+		running: true,
+	}
+	r.State[oldPath] = &input.FileState{
+		Source:      &oldPath,
+		Offset:      10,
+		FileStateOS: input.GetOSFileState(&info),
+	}
+
+	// same file was renamed and harvested under its new path
+	r.processEvents([]*input.FileEvent{
+		{Source: &newPath, Offset: 10, Bytes: 5, Fileinfo: &info},
+	})
+
+	assert.Equal(t, 1, len(r.State))
+	state, ok := r.State[newPath]
+	assert.True(t, ok)
+	assert.Equal(t, int64(15), state.Offset)
+}
+
+func TestRegistrarKeepSymlinkState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-registrar")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "app.log")
+	link := filepath.Join(dir, "current.log")
+	assert.Nil(t, ioutil.WriteFile(target, []byte("line\n"), 0644))
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	info, err := os.Stat(target)
+	assert.Nil(t, err)
+
+	r := &Registrar{
+		State:   map[string]*input.FileState{},
+		running: true,
+	}
+	r.State[link] = &input.FileState{
+		Source:      &link,
+		Offset:      5,
+		FileStateOS: input.GetOSFileState(&info),
+	}
+
+	// the symlink still refers to the file, so both states are kept
+	r.processEvents([]*input.FileEvent{
+		{Source: &target, Offset: 0, Bytes: 5, Fileinfo: &info},
+	})
+
+	assert.Equal(t, 2, len(r.State))
+	assert.Equal(t, int64(5), r.State[link].Offset)
+	assert.Equal(t, int64(5), r.State[target].Offset)
+
+	// once the symlink is gone, its state is removed
+	assert.Nil(t, os.Remove(link))
+	r.processEvents([]*input.FileEvent{
+		{Source: &target, Offset: 5, Bytes: 5, Fileinfo: &info},
+	})
+
+	assert.Equal(t, 1, len(r.State))
+	assert.Equal(t, int64(10), r.State[target].Offset)
+}
+
+func TestRegistrarFetchStateBySource(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-registrar")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	info, err := os.Stat(file.Name())
+	assert.Nil(t, err)
+
+	source := "/var/log/app.log"
+	r := &Registrar{
+		State:   map[string]*input.FileState{},
+		Persist: make(chan *input.FileState, 1),
+	}
+	r.State[source] = &input.FileState{
+		Source:      &source,
+		Offset:      10,
+		FileStateOS: input.GetOSFileState(&info),
+	}
+
+	// state is stored under the normalized source, not the path of the file
+	offset, resuming := r.fetchState(source, file.Name(), info)
+	assert.True(t, resuming)
+	assert.Equal(t, int64(10), offset)
+	assert.Equal(t, source, *(<-r.Persist).Source)
+}
+
+func TestRegistrarSkipErrorEvents(t *testing.T) {
+	path := "/var/log/app.log"
+	text := "Given file is not a regular file."
+
+	r := &Registrar{
+		State:   map[string]*input.FileState{},
+		running: true,
+	}
+
+	// error events have no file info, heartbeats repeat the last offset
+	r.processEvents([]*input.FileEvent{
+		{Source: &path, Offset: 10, Text: &text, Error: text},
+		{Source: &path, Offset: 20, Heartbeat: true},
+	})
+	assert.Equal(t, 0, len(r.State))
+}
@@ -0,0 +1,78 @@
+package harvester
+
+import "time"
+
+// Weights of the latest interval in the moving average of the intervals
+// between new data. Shorter intervals are taken over at once so a file becoming
+// active is polled often right away, while longer intervals only slowly raise
+// the average so a single pause does not slow down polling an active file.
+const (
+	adaptiveBackoffWeightDown = 1.0
+	adaptiveBackoffWeightUp   = 0.25
+)
+
+// adaptiveBackoff derives the backoff from the exponentially weighted moving
+// average (EWMA) of the intervals at which new lines are found after EOF. In
+// contrast to resetting the backoff to its minimum on every line, files
+// written to rarely keep being polled rarely, while files written to
+// frequently are polled often. Intervals are measured between EOFs with new
+// lines read in between, as lines read in one go would otherwise pull the
+// average towards 0.
+type adaptiveBackoff struct {
+	min, max time.Duration
+	average  float64   // EWMA of the intervals between new data in nanoseconds
+	last     time.Time // time new data was found last
+	data     bool      // lines were read since the last EOF
+}
+
+func newAdaptiveBackoff(min, max time.Duration) *adaptiveBackoff {
+	return &adaptiveBackoff{min: min, max: max}
+}
+
+// lineRead records that a line was read.
+func (a *adaptiveBackoff) lineRead() {
+	a.data = true
+}
+
+// update is called on EOF at now. If lines were read since the last EOF, the
+// interval since new data was found before is added to the average, and the
+// backoff to use is returned. The backoff is half the average interval,
+// limited by min and max. Returns false if no lines were read, so the current
+// backoff keeps growing.
+func (a *adaptiveBackoff) update(now time.Time) (time.Duration, bool) {
+	if !a.data {
+		return 0, false
+	}
+	a.data = false
+
+	if !a.last.IsZero() {
+		interval := float64(now.Sub(a.last))
+		weight := adaptiveBackoffWeightUp
+		if interval < a.average || a.average == 0 {
+			weight = adaptiveBackoffWeightDown
+		}
+		a.average += weight * (interval - a.average)
+	}
+	a.last = now
+
+	backoff := time.Duration(a.average / 2)
+	if backoff < a.min {
+		backoff = a.min
+	}
+	if backoff > a.max {
+		backoff = a.max
+	}
+	return backoff, true
+}
+
+// growBackoff multiplies backoff by factor, up to max.
+func growBackoff(backoff time.Duration, factor int, max time.Duration) time.Duration {
+	if backoff >= max {
+		return backoff
+	}
+	backoff *= time.Duration(factor)
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
@@ -0,0 +1,125 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveBackoff(t *testing.T) {
+	a := newAdaptiveBackoff(time.Second, 10*time.Second)
+	start := time.Now()
+
+	// no lines read -> keep growing the current backoff
+	_, ok := a.update(start)
+	assert.False(t, ok)
+
+	a.lineRead()
+	backoff, ok := a.update(start)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, backoff)
+
+	// new data every 4s -> poll every 2s
+	a.lineRead()
+	backoff, _ = a.update(start.Add(4 * time.Second))
+	assert.Equal(t, 2*time.Second, backoff)
+
+	// a single line after a longer pause does not reset to the minimum
+	a.lineRead()
+	backoff, _ = a.update(start.Add(24 * time.Second))
+	assert.Equal(t, 4*time.Second, backoff)
+
+	// limited to max
+	for i := 2; i < 10; i++ {
+		a.lineRead()
+		backoff, _ = a.update(start.Add(time.Duration(i) * time.Minute))
+	}
+	assert.Equal(t, 10*time.Second, backoff)
+}
+
+func TestGrowBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, growBackoff(time.Second, 2, 10*time.Second))
+	assert.Equal(t, 10*time.Second, growBackoff(8*time.Second, 2, 10*time.Second))
+	assert.Equal(t, 12*time.Second, growBackoff(12*time.Second, 2, 10*time.Second))
+}
+
+// simulateBackoff simulates harvesting a file for one hour and returns the
+// number of times the file was polled and the average delay between a line
+// being written and read. A line is written every interval, and additionally
+// one line per second for the first burst of every 15 minutes.
+func simulateBackoff(adaptive bool, interval, burst time.Duration) (int, time.Duration) {
+	const (
+		minBackoff = time.Second
+		maxBackoff = 10 * time.Second
+		factor     = 2
+	)
+
+	var writes []time.Duration
+	for t := time.Duration(0); t < time.Hour; t += time.Second {
+		if t%interval == 0 || t%(15*time.Minute) < burst {
+			writes = append(writes, t)
+		}
+	}
+
+	start := time.Now()
+	a := newAdaptiveBackoff(minBackoff, maxBackoff)
+	backoff := minBackoff
+
+	polls := 0
+	var delay time.Duration
+	next := 0
+	for now := time.Duration(0); now < time.Hour; {
+		polls++
+
+		// read all lines written until now
+		for ; next < len(writes) && writes[next] <= now; next++ {
+			delay += now - writes[next]
+			if adaptive {
+				a.lineRead()
+			} else {
+				backoff = minBackoff
+			}
+		}
+
+		// EOF reached, back off
+		if adaptive {
+			if b, ok := a.update(start.Add(now)); ok {
+				backoff = b
+			}
+		}
+		now += backoff
+		backoff = growBackoff(backoff, factor, maxBackoff)
+	}
+
+	return polls, delay / time.Duration(next)
+}
+
+func benchmarkBackoff(b *testing.B, adaptive bool) {
+	files := []struct {
+		name            string
+		interval, burst time.Duration
+	}{
+		{"active", time.Second, 0},
+		{"moderate", 5 * time.Second, 0},
+		{"idle", 30 * time.Second, 0},
+		{"idle-bursts", 30 * time.Second, time.Minute},
+	}
+
+	for i := 0; i < b.N; i++ {
+		for _, f := range files {
+			simulateBackoff(adaptive, f.interval, f.burst)
+		}
+	}
+
+	for _, f := range files {
+		polls, delay := simulateBackoff(adaptive, f.interval, f.burst)
+		b.Logf("%s: %d polls/h, average delay %v", f.name, polls, delay)
+	}
+}
+
+// BenchmarkBackoffFixed and BenchmarkBackoffAdaptive log the number of
+// polls per hour and the average read delay of files written to at different
+// rates for the default and the adaptive backoff.
+func BenchmarkBackoffFixed(b *testing.B)    { benchmarkBackoff(b, false) }
+func BenchmarkBackoffAdaptive(b *testing.B) { benchmarkBackoff(b, true) }
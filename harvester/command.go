@@ -0,0 +1,77 @@
+package harvester
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/elastic/libbeat/logp"
+)
+
+// commandSource reads the output of an external command decompressing the
+// file, e.g. `zstd -dc`. The file is passed to the command on stdin. As the
+// output is not seekable, offsets are the number of bytes read from the
+// output. Reading stops on EOF.
+type commandSource struct {
+	file   *os.File
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+}
+
+func (c commandSource) Read(b []byte) (int, error) { return c.stdout.Read(b) }
+func (c commandSource) Name() string               { return c.file.Name() }
+func (c commandSource) Stat() (os.FileInfo, error) { return c.file.Stat() }
+func (c commandSource) Continuable() bool          { return false }
+
+func (c commandSource) Close() error {
+	c.stop()
+	return c.file.Close()
+}
+
+// stop stops the command, if still running, and waits for it to exit, so no
+// zombie process is left.
+func (c commandSource) stop() {
+	c.stdout.Close()
+	c.cmd.Process.Kill()
+
+	if err := c.cmd.Wait(); err != nil {
+		logp.Debug("harvester", "Decompress command for %s exited: %v %s", c.file.Name(), err, c.stderr.String())
+	}
+}
+
+// newCommandSource starts command with file as input. Offset is the number of
+// bytes already read from the command output, which are skipped.
+func newCommandSource(file *os.File, command string, offset int64) (commandSource, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return commandSource{}, fmt.Errorf("decompress_cmd is empty")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = file
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return commandSource{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return commandSource{}, fmt.Errorf("Error starting decompress_cmd '%s': %v", command, err)
+	}
+
+	source := commandSource{file: file, cmd: cmd, stdout: stdout, stderr: stderr}
+	if offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, stdout, offset); err != nil {
+			source.stop()
+			return commandSource{}, err
+		}
+	}
+
+	return source, nil
+}
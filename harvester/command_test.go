@@ -0,0 +1,102 @@
+// +build !windows
+
+package harvester
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeGzipFile(t *testing.T, path string, content string) {
+	out, err := os.Create(path)
+	assert.Nil(t, err)
+
+	writer := gzip.NewWriter(out)
+	writer.Write([]byte(content))
+	writer.Close()
+	out.Close()
+}
+
+func TestCommandSource(t *testing.T) {
+	if _, err := exec.LookPath("gzip"); err != nil {
+		t.Skip("gzip command not available")
+	}
+
+	dir, err := ioutil.TempDir("", "filebeat-command")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "archive.log.z")
+	writeGzipFile(t, path, "line 1\nline 2\n")
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+
+	// resume after first line
+	source, err := newCommandSource(file, "gzip -dc", 7)
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadAll(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "line 2\n", string(content))
+	assert.False(t, source.Continuable())
+
+	// command is reaped on close
+	source.Close()
+	assert.NotNil(t, source.cmd.ProcessState)
+}
+
+func TestHarvestDecompressCmd(t *testing.T) {
+	if _, err := exec.LookPath("gzip"); err != nil {
+		t.Skip("gzip command not available")
+	}
+
+	dir, err := ioutil.TempDir("", "filebeat-command")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "archive.log.z")
+	writeGzipFile(t, path, "line 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{},
+		&config.HarvesterConfig{
+			BufferSize:    1024,
+			DecompressCmd: "gzip -dc",
+		},
+		path, nil, spooler)
+	assert.Nil(t, err)
+
+	// harvester stops at end of the command output
+	h.Harvest()
+
+	assert.Equal(t, 2, len(spooler))
+	assert.Equal(t, "line 1", *(<-spooler).Text)
+	assert.Equal(t, "line 2", *(<-spooler).Text)
+	assert.Equal(t, int64(14), h.Offset)
+}
+
+func TestCommandSourceNotFound(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-command")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = newCommandSource(file, "filebeat-no-such-command -dc", 0)
+	assert.NotNil(t, err)
+}
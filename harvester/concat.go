@@ -0,0 +1,278 @@
+package harvester
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/filebeat/input"
+	"github.com/elastic/libbeat/logp"
+)
+
+// concatSource reads all files matching a glob pattern as one stream, as if
+// the files were concatenated in natural sort order (app.log.2 before
+// app.log.10). Each file is read to EOF before advancing to the next one.
+// Offsets are counted over the whole stream, the offset of a file being the
+// sum of the sizes of all files before it.
+type concatSource struct {
+	pattern    string
+	exclude    []*regexp.Regexp
+	ignoreCase bool
+
+	files   []concatFile // known files in read order
+	current int          // index of the file being read
+	file    *os.File
+}
+
+// concatFile is a file of a concatSource. For files read before the current
+// one, size and modification time are kept to detect later changes.
+type concatFile struct {
+	path    string
+	offset  int64 // offset of the first byte of the file in the stream
+	size    int64
+	modTime time.Time
+}
+
+// concatInfo reports the size of the whole stream up to the end of the
+// current file, so it can be compared with the stream offset.
+type concatInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i concatInfo) Size() int64 { return i.size }
+
+// newConcatSource opens the first file matching pattern. Files matching any
+// of the exclude patterns are skipped. If ignoreCase is set, the pattern
+// matches case-insensitively.
+func newConcatSource(pattern string, exclude []*regexp.Regexp, ignoreCase bool) (*concatSource, error) {
+	c := &concatSource{pattern: pattern, exclude: exclude, ignoreCase: ignoreCase}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	if len(c.files) == 0 {
+		return nil, fmt.Errorf("no files matching %s", pattern)
+	}
+
+	file, err := os.Open(c.files[0].path)
+	if err != nil {
+		return nil, err
+	}
+	c.file = file
+	return c, nil
+}
+
+// refresh adds new files matching the pattern. Only files sorting after the
+// last known file are added, as files before were already passed.
+func (c *concatSource) refresh() error {
+	matches, err := input.Glob(c.pattern, c.ignoreCase)
+	if err != nil {
+		return err
+	}
+	sort.Sort(naturalOrder(matches))
+
+	for _, path := range matches {
+		if len(c.files) > 0 && !naturalLess(c.files[len(c.files)-1].path, path) {
+			continue
+		}
+		if input.MatchPath(c.exclude, path) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		logp.Debug("harvester", "Add file to concatenated files %s: %s", c.pattern, path)
+		c.files = append(c.files, concatFile{path: path})
+	}
+	return nil
+}
+
+func (c *concatSource) Read(b []byte) (int, error) {
+	for {
+		n, err := c.file.Read(b)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if !c.next() {
+			return 0, io.EOF
+		}
+	}
+}
+
+// next advances to the next file once the current file was read to EOF.
+// Returns false if there is no next file yet.
+func (c *concatSource) next() bool {
+	if c.current == len(c.files)-1 {
+		if err := c.refresh(); err != nil {
+			logp.Err("Failed to find files matching %s: %s", c.pattern, err)
+			return false
+		}
+		if c.current == len(c.files)-1 {
+			return false
+		}
+	}
+
+	size, err := c.file.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return false
+	}
+	info, err := c.file.Stat()
+	if err != nil {
+		return false
+	}
+
+	next := c.files[c.current+1]
+	file, err := os.Open(next.path)
+	if err != nil {
+		logp.Err("Failed opening %s: %s", next.path, err)
+		return false
+	}
+
+	logp.Debug("harvester", "Continue concatenated files %s with %s", c.pattern, next.path)
+
+	c.finish(c.current, size, info.ModTime())
+	c.file.Close()
+	c.file = file
+	c.current++
+	return true
+}
+
+// finish records the size and modification time of the file at index i and
+// updates the offset of the following file.
+func (c *concatSource) finish(i int, size int64, modTime time.Time) {
+	c.files[i].size = size
+	c.files[i].modTime = modTime
+	c.files[i+1].offset = c.files[i].offset + size
+}
+
+func (c *concatSource) Name() string      { return c.file.Name() }
+func (c *concatSource) Close() error      { return c.file.Close() }
+func (c *concatSource) Continuable() bool { return true }
+
+func (c *concatSource) Stat() (os.FileInfo, error) {
+	info, err := c.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return concatInfo{info, c.files[c.current].offset + info.Size()}, nil
+}
+
+// Seek moves to offset in the stream, opening the file containing it. Offsets
+// behind the last file are set in the last file.
+func (c *concatSource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		pos, err := c.file.Seek(0, os.SEEK_CUR)
+		if err != nil {
+			return 0, err
+		}
+		offset += c.files[c.current].offset + pos
+	default:
+		return 0, errNotSeekable
+	}
+
+	for i := range c.files {
+		if i > 0 {
+			info, err := os.Stat(c.files[i-1].path)
+			if err != nil {
+				return 0, err
+			}
+			c.finish(i-1, info.Size(), info.ModTime())
+		}
+
+		last := i == len(c.files)-1
+		if !last {
+			info, err := os.Stat(c.files[i].path)
+			if err != nil {
+				return 0, err
+			}
+			if offset >= c.files[i].offset+info.Size() {
+				continue
+			}
+		}
+
+		if i != c.current {
+			file, err := os.Open(c.files[i].path)
+			if err != nil {
+				return 0, err
+			}
+			c.file.Close()
+			c.file = file
+			c.current = i
+		}
+
+		if _, err := c.file.Seek(offset-c.files[i].offset, os.SEEK_SET); err != nil {
+			return 0, err
+		}
+		return offset, nil
+	}
+	return 0, errNotSeekable
+}
+
+// checkChanged checks if a file read before the current one was modified
+// after reading advanced past it. The path and stream offset of the first
+// changed file are returned. Each change is reported once.
+func (c *concatSource) checkChanged() (string, int64, bool) {
+	for i := 0; i < c.current; i++ {
+		f := &c.files[i]
+		info, err := os.Stat(f.path)
+		if err != nil {
+			// removed files can not be read again anyway
+			continue
+		}
+
+		if info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+			f.size = info.Size()
+			f.modTime = info.ModTime()
+			return f.path, f.offset, true
+		}
+	}
+	return "", 0, false
+}
+
+// naturalOrder sorts paths with naturalLess.
+type naturalOrder []string
+
+func (n naturalOrder) Len() int           { return len(n) }
+func (n naturalOrder) Less(i, j int) bool { return naturalLess(n[i], n[j]) }
+func (n naturalOrder) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+// naturalLess compares a and b treating runs of digits as numbers, so
+// app.log.2 sorts before app.log.10.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// digitPrefix returns the leading digits of s.
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,162 @@
+package harvester
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConcatFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	paths := []string{"app.log.10", "app.log", "app.log.2", "app.log.1", "app.log.01b", "app.log.b"}
+	sort.Sort(naturalOrder(paths))
+	assert.Equal(t, []string{"app.log", "app.log.1", "app.log.01b", "app.log.2", "app.log.10", "app.log.b"}, paths)
+}
+
+func TestConcatSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-concat")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConcatFiles(t, dir, map[string]string{
+		"app.log.1":  "a\n",
+		"app.log.2":  "bb\n",
+		"app.log.10": "ccc\n",
+	})
+
+	source, err := newConcatSource(filepath.Join(dir, "app.log.*"), nil, false)
+	assert.Nil(t, err)
+	defer source.Close()
+
+	content, err := ioutil.ReadAll(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nbb\nccc\n", string(content))
+
+	info, err := source.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), info.Size())
+
+	// files added later are read once the last file is at EOF
+	writeConcatFiles(t, dir, map[string]string{"app.log.11": "d\n"})
+	content, err = ioutil.ReadAll(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "d\n", string(content))
+
+	// offsets are counted over all files
+	offset, err := source.Seek(3, os.SEEK_SET)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), offset)
+	assert.Equal(t, filepath.Join(dir, "app.log.2"), source.Name())
+
+	content, err = ioutil.ReadAll(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "b\nccc\nd\n", string(content))
+}
+
+func TestConcatSourceChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-concat")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConcatFiles(t, dir, map[string]string{
+		"app.log.1": "a\n",
+		"app.log.2": "b\n",
+	})
+
+	source, err := newConcatSource(filepath.Join(dir, "app.log.*"), nil, false)
+	assert.Nil(t, err)
+	defer source.Close()
+
+	ioutil.ReadAll(source)
+	_, _, changed := source.checkChanged()
+	assert.False(t, changed)
+
+	// the current file growing is no change
+	file, err := os.OpenFile(filepath.Join(dir, "app.log.2"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	file.WriteString("c\n")
+	file.Close()
+
+	_, _, changed = source.checkChanged()
+	assert.False(t, changed)
+
+	file, err = os.OpenFile(filepath.Join(dir, "app.log.1"), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	file.WriteString("late\n")
+	file.Close()
+
+	path, offset, changed := source.checkChanged()
+	assert.True(t, changed)
+	assert.Equal(t, filepath.Join(dir, "app.log.1"), path)
+	assert.Equal(t, int64(0), offset)
+
+	// changes are reported once
+	_, _, changed = source.checkChanged()
+	assert.False(t, changed)
+}
+
+func TestHarvestConcat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-concat")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the first file ends with an incomplete line continued by the next file
+	writeConcatFiles(t, dir, map[string]string{
+		"app.log.1": "line 1\nline",
+		"app.log.2": " 2\nline 3\n",
+	})
+
+	harvest := func(offset int64) []*input.FileEvent {
+		spooler := make(chan *input.FileEvent, 10)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour, Concat: true},
+			&config.HarvesterConfig{BufferSize: 1024, CloseEOF: true},
+			filepath.Join(dir, "app.log.*"), nil, spooler)
+		assert.Nil(t, err)
+		h.Offset = offset
+
+		h.Harvest()
+		close(spooler)
+
+		var events []*input.FileEvent
+		for event := range spooler {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	events := harvest(0)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "line 1", *events[0].Text)
+	assert.Equal(t, "line 2", *events[1].Text)
+	assert.Equal(t, int64(7), events[1].Offset)
+	assert.Equal(t, "line 3", *events[2].Text)
+	assert.Equal(t, int64(14), events[2].Offset)
+	assert.Equal(t, filepath.Join(dir, "app.log.*"), *events[2].Source)
+
+	// resume in the second file
+	events = harvest(14)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "line 3", *events[0].Text)
+}
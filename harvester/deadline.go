@@ -0,0 +1,100 @@
+package harvester
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var errReadTimeout = errors.New("read did not return within read_deadline")
+
+// deadlineReader fails reads not returning within the configured timeout,
+// e.g. on hung network mounts. If the source supports read deadlines, like
+// pipes, the deadline is set on the source. Otherwise the read is run in a
+// goroutine guarded by a timer. As a hung read can not be aborted, the reader
+// fails all following reads after a timeout.
+type deadlineReader struct {
+	in       io.Reader
+	timeout  time.Duration
+	deadline bool // source supports read deadlines
+
+	buf []byte // read buffer of the guarded read
+	err error  // set after a read timed out
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+func newDeadlineReader(in io.Reader, timeout time.Duration) *deadlineReader {
+	r := &deadlineReader{in: in, timeout: timeout}
+
+	// regular files return an error if deadlines are not supported
+	if d, ok := in.(readDeadliner); ok && d.SetReadDeadline(time.Time{}) == nil {
+		r.deadline = true
+	}
+	return r
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.deadline {
+		r.in.(readDeadliner).SetReadDeadline(time.Now().Add(r.timeout))
+		n, err := r.in.Read(p)
+		if err != nil && isTimeout(err) {
+			r.err = errReadTimeout
+			return n, r.err
+		}
+		return n, err
+	}
+
+	// The hung read keeps writing to its own buffer, never to p
+	if len(r.buf) < len(p) {
+		r.buf = make([]byte, len(p))
+	}
+	buf := r.buf[:len(p)]
+
+	result := make(chan readResult, 1)
+	go func() {
+		n, err := r.in.Read(buf)
+		result <- readResult{n, err}
+	}()
+
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-result:
+		copy(p, buf[:res.n])
+		return res.n, res.err
+	case <-timer.C:
+		r.buf = nil
+		r.err = errReadTimeout
+		return 0, r.err
+	}
+}
+
+// isRegular checks if read_deadline applies to file. Only reads of regular files
+// return once all data is read. On pipes, sockets, devices or stdin reads block
+// until new data arrives, so a deadline would stop idle harvesters.
+func isRegular(file FileSource) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isTimeout checks if err was caused by exceeding the read deadline. Errors of
+// files and network connections both implement Timeout.
+func isTimeout(err error) bool {
+	t, ok := err.(interface {
+		Timeout() bool
+	})
+	return ok && t.Timeout()
+}
@@ -0,0 +1,65 @@
+package harvester
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingReader blocks reads until unblock is closed
+type blockingReader struct{ unblock chan struct{} }
+
+func (r blockingReader) Read(p []byte) (int, error) {
+	<-r.unblock
+	return copy(p, "late"), nil
+}
+
+func TestDeadlineReader(t *testing.T) {
+	reader := newDeadlineReader(strings.NewReader("line\n"), time.Second)
+	assert.False(t, reader.deadline)
+
+	buf := make([]byte, 10)
+	n, err := reader.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "line\n", string(buf[:n]))
+}
+
+func TestDeadlineReaderHung(t *testing.T) {
+	in := blockingReader{make(chan struct{})}
+	reader := newDeadlineReader(in, 10*time.Millisecond)
+
+	buf := make([]byte, 10)
+	_, err := reader.Read(buf)
+	assert.Equal(t, errReadTimeout, err)
+
+	// the hung read returning later does not modify buf
+	close(in.unblock)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, make([]byte, 10), buf)
+
+	_, err = reader.Read(buf)
+	assert.Equal(t, errReadTimeout, err)
+}
+
+func TestDeadlineReaderPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	reader := newDeadlineReader(r, 10*time.Millisecond)
+
+	w.Write([]byte("line\n"))
+	buf := make([]byte, 10)
+	n, err := reader.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "line\n", string(buf[:n]))
+
+	_, err = reader.Read(buf)
+	assert.Equal(t, errReadTimeout, err)
+}
@@ -0,0 +1,79 @@
+package harvester
+
+import (
+	"os"
+	"time"
+)
+
+// dedup combines consecutive identical lines into one event, counting the
+// repeats, if dedup_window is set. The pending event is sent once a different
+// line is read, dedup_max_lines lines were combined or dedup_window has
+// passed since its first line. The event spans the raw bytes of all combined
+// lines, so the offset advances past every suppressed line.
+type dedup struct {
+	window   time.Duration
+	maxLines int
+
+	line   string
+	ending string // line ending of the first line, if add_line_ending is set
+	bytes  int
+	count  int
+	first  time.Time // time the first line of the pending event was added
+}
+
+func newDedup(window time.Duration, maxLines int) *dedup {
+	return &dedup{window: window, maxLines: maxLines}
+}
+
+// repeats checks if line repeats the pending line and can be added to the
+// pending event.
+func (d *dedup) repeats(line string) bool {
+	return d.count > 0 && line == d.line &&
+		(d.maxLines <= 0 || d.count < d.maxLines) && !d.timedOut()
+}
+
+// add adds a line of sz raw bytes. If the line does not repeat the pending
+// line, it starts a new pending event and must only be added after flushing.
+func (d *dedup) add(line string, sz int, ending string) {
+	if d.count == 0 {
+		d.line = line
+		d.ending = ending
+		d.first = time.Now()
+	}
+	d.bytes += sz
+	d.count++
+}
+
+// flush returns the pending line, the raw bytes of all combined lines and the
+// number of lines combined and resets the pending event. Returns false if no
+// line is pending.
+func (d *dedup) flush() (string, string, int, int, bool) {
+	if d.count == 0 {
+		return "", "", 0, 0, false
+	}
+
+	line, ending, bytes, count := d.line, d.ending, d.bytes, d.count
+	d.line, d.ending = "", ""
+	d.bytes, d.count = 0, 0
+	return line, ending, bytes, count, true
+}
+
+// timedOut returns true if a line is pending for longer than dedup_window.
+func (d *dedup) timedOut() bool {
+	return d.count > 0 && time.Since(d.first) >= d.window
+}
+
+// flushDedup sends the pending event of identical lines. The number of
+// lines is added as repeat_count if lines were repeated.
+func (h *Harvester) flushDedup(readTime time.Time, info *os.FileInfo) {
+	text, ending, bytesRead, count, ok := h.dedup.flush()
+	if !ok {
+		return
+	}
+
+	h.lineEnding = ending
+	if count > 1 {
+		h.repeatCount = count
+	}
+	h.sendEvent(readTime, text, bytesRead, false, false, info)
+}
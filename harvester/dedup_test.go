@@ -0,0 +1,43 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	d := newDedup(time.Hour, 3)
+	assert.False(t, d.repeats("a"))
+
+	d.add("a", 2, "lf")
+	assert.True(t, d.repeats("a"))
+	assert.False(t, d.repeats("b"))
+
+	d.add("a", 2, "lf")
+	d.add("a", 2, "lf")
+
+	// dedup_max_lines reached
+	assert.False(t, d.repeats("a"))
+
+	line, ending, bytes, count, ok := d.flush()
+	assert.True(t, ok)
+	assert.Equal(t, "a", line)
+	assert.Equal(t, "lf", ending)
+	assert.Equal(t, 6, bytes)
+	assert.Equal(t, 3, count)
+
+	_, _, _, _, ok = d.flush()
+	assert.False(t, ok)
+}
+
+func TestDedupTimeout(t *testing.T) {
+	d := newDedup(time.Millisecond, 0)
+	assert.False(t, d.timedOut())
+
+	d.add("a", 2, "")
+	time.Sleep(2 * time.Millisecond)
+	assert.True(t, d.timedOut())
+	assert.False(t, d.repeats("a"))
+}
@@ -0,0 +1,36 @@
+package harvester
+
+import (
+	"os"
+
+	"github.com/elastic/filebeat/input"
+	"github.com/elastic/libbeat/logp"
+)
+
+// statFunc returns the file info of a path, like os.Stat.
+type statFunc func(path string) (os.FileInfo, error)
+
+// deviceChanged checks if the path of the harvested file is on another device
+// than the file opened, e.g. after the file system was unmounted and mounted
+// again. The open file then refers to a file no longer reachable by its path.
+// If the path can not be stat'ed, e.g. while the file system is not mounted,
+// the device is not considered changed.
+func (h *Harvester) deviceChanged() bool {
+	if h.fileStateOS == nil {
+		return false
+	}
+
+	stat := h.statPath
+	if stat == nil {
+		stat = os.Stat
+	}
+	info, err := stat(h.Path)
+	if err != nil {
+		logp.Debug("harvester", "Can not check device of %s: %v", h.Path, err)
+		return false
+	}
+
+	_, device := input.GetOSFileState(&info).Identity()
+	_, opened := h.fileStateOS.Identity()
+	return device != opened
+}
@@ -0,0 +1,97 @@
+// +build !windows
+
+package harvester
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+// remountedInfo reports the file info of a file on another device
+type remountedInfo struct {
+	os.FileInfo
+}
+
+func (i remountedInfo) Sys() interface{} {
+	stat := *i.FileInfo.Sys().(*syscall.Stat_t)
+	stat.Dev++
+	return &stat
+}
+
+// statRemounted stats path as if its file system was mounted again
+func statRemounted(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return remountedInfo{info}, nil
+}
+
+func TestDeviceChanged(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-device")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	info, err := file.Stat()
+	assert.Nil(t, err)
+
+	h := &Harvester{
+		Path:        file.Name(),
+		fileStateOS: input.GetOSFileState(&info),
+	}
+	assert.False(t, h.deviceChanged())
+
+	h.statPath = statRemounted
+	assert.True(t, h.deviceChanged())
+
+	// path not available, e.g. while not mounted
+	h.statPath = func(string) (os.FileInfo, error) { return nil, errors.New("not mounted") }
+	assert.False(t, h.deviceChanged())
+}
+
+func TestHarvestDeviceChanged(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-device")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:          1024,
+			BackoffDuration:     10 * time.Millisecond,
+			MaxBackoffDuration:  10 * time.Millisecond,
+			BackoffFactor:       1,
+			DeviceCheckDuration: 20 * time.Millisecond,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+	h.statPath = statRemounted
+
+	var reason string
+	h.Lifecycle = func(event LifecycleEvent) {
+		reason = event.Reason
+	}
+
+	// lines read before the check are sent, then the harvester stops
+	h.Harvest()
+	assert.Equal(t, StopReasonDevice, reason)
+	assert.Equal(t, 2, len(spooler))
+	assert.Equal(t, int64(14), h.Offset)
+}
@@ -0,0 +1,78 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// Byte Order Markers supported by auto detection. Longer BOMs must be checked
+// first, as the UTF-16LE BOM is a prefix of the UTF-32LE BOM.
+var boms = []struct {
+	bom      []byte
+	encoding Encoding
+}{
+	{[]byte{0x00, 0x00, 0xfe, 0xff}, utf32Map[bigEndian]},
+	{[]byte{0xff, 0xfe, 0x00, 0x00}, utf32Map[littleEndian]},
+	{[]byte{0xef, 0xbb, 0xbf}, utf8Validating},
+	{[]byte{0xfe, 0xff}, utf16Map[bigEndian]},
+	{[]byte{0xff, 0xfe}, utf16Map[littleEndian]},
+}
+
+// autoBOM detects the encoding from the Byte Order Marker (BOM) at the
+// beginning of the data source. If no BOM is present, the input is not
+// transformed (plain). Only seekable data sources are supported. If the read
+// pointer is at the beginning of the file, it is moved past the BOM, so the
+// BOM is not part of the first line.
+func autoBOM(in_ io.Reader) (Encoding, error) {
+	in, ok := in_.(io.ReadSeeker)
+	if !ok {
+		return nil, ErrUnsupportedSourceTypeBOM
+	}
+
+	// remember file offset in case we have to back off
+	offset, err := in.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = in.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	var buf [4]byte
+	n, err := io.ReadFull(in, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		in.Seek(offset, os.SEEK_SET)
+		return nil, err
+	}
+	if n == 0 {
+		// empty file, wait for content to detect encoding
+		in.Seek(offset, os.SEEK_SET)
+		return nil, transform.ErrShortSrc
+	}
+
+	for _, b := range boms {
+		if !bytes.HasPrefix(buf[:n], b.bom) {
+			continue
+		}
+
+		// skip BOM if reading from beginning of file
+		if offset == 0 {
+			offset = int64(len(b.bom))
+		}
+		if _, err = in.Seek(offset, os.SEEK_SET); err != nil {
+			return nil, err
+		}
+		return b.encoding, nil
+	}
+
+	// no BOM found -> restore offset and fall back to plain
+	if _, err = in.Seek(offset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	return encoding.Nop, nil
+}
@@ -0,0 +1,88 @@
+package encoding
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+func TestAutoBOMEncodings(t *testing.T) {
+	text := []byte("hello wörld")
+
+	var tests = []struct {
+		name             string
+		bom              []byte
+		writeEncoding    Encoding
+		expectedEncoding Encoding
+	}{
+		{"utf-8", []byte{0xef, 0xbb, 0xbf}, encoding.Nop, utf8Validating},
+		{"utf-16be", []byte{0xfe, 0xff},
+			unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), utf16Map[bigEndian]},
+		{"utf-16le", []byte{0xff, 0xfe},
+			unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), utf16Map[littleEndian]},
+		{"utf-32be", []byte{0x00, 0x00, 0xfe, 0xff},
+			utf32Map[bigEndian], utf32Map[bigEndian]},
+		{"utf-32le", []byte{0xff, 0xfe, 0x00, 0x00},
+			utf32Map[littleEndian], utf32Map[littleEndian]},
+		{"no bom", nil, encoding.Nop, encoding.Nop},
+	}
+
+	factory, ok := FindEncoding("auto")
+	assert.True(t, ok)
+
+	for _, test := range tests {
+		t.Logf("testing: %v", test.name)
+
+		buf := bytes.NewBuffer(nil)
+		buf.Write(test.bom)
+		writer := transform.NewWriter(buf, test.writeEncoding.NewEncoder())
+		writer.Write(text)
+		writer.Close()
+
+		rawReader := bytes.NewReader(buf.Bytes())
+		contentLen := rawReader.Len()
+
+		encoding, err := factory(rawReader)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedEncoding, encoding)
+		assert.Equal(t, len(test.bom), contentLen-rawReader.Len())
+		if err == nil {
+			reader := transform.NewReader(rawReader, encoding.NewDecoder())
+			content, _ := ioutil.ReadAll(reader)
+			assert.Equal(t, text, content)
+		}
+	}
+}
+
+func TestAutoBOMKeepOffset(t *testing.T) {
+	rawReader := bytes.NewReader([]byte{0xff, 0xfe, 'a', 0, 'b', 0})
+	rawReader.Seek(4, 0)
+
+	factory, _ := FindEncoding("auto")
+	encoding, err := factory(rawReader)
+	assert.Nil(t, err)
+	assert.Equal(t, utf16Map[littleEndian], encoding)
+	assert.Equal(t, 2, rawReader.Len())
+}
+
+func TestAutoBOMEmpty(t *testing.T) {
+	factory, _ := FindEncoding("auto")
+	_, err := factory(bytes.NewReader(nil))
+	assert.Equal(t, transform.ErrShortSrc, err)
+}
+
+func TestUtf32InvalidInput(t *testing.T) {
+	// surrogate code point and incomplete code unit are replaced
+	raw := []byte{0x00, 0xd8, 0x00, 0x00, 'a', 0x00, 0x00, 0x00, 'b'}
+	reader := transform.NewReader(bytes.NewReader(raw),
+		utf32Map[littleEndian].NewDecoder())
+	content, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "�a�", string(content))
+}
@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"fmt"
 	"io"
 	"strings"
 
@@ -37,6 +38,9 @@ var encodings = map[string]EncodingFactory{
 	"utf-16-bom":   utf16BOMRequired,
 	"utf-16be-bom": utf16BOMBigEndian,
 	"utf-16le-bom": utf16BOMLittleEndian,
+
+	// detect encoding from BOM (seekable data source required)
+	"auto": autoBOM,
 }
 
 // Plain file encoding not transforming any read bytes.
@@ -46,10 +50,12 @@ var Plain = enc(encoding.Nop)
 // converted to '\uFFFD'.
 //
 // See: http://encoding.spec.whatwg.org/#replacement
-var utf8Encoding = enc(mixedEncoding{
+var utf8Encoding = enc(utf8Validating)
+
+var utf8Validating Encoding = &mixedEncoding{
 	decoder: encoding.Replacement.NewEncoder,
 	encoder: encoding.Replacement.NewEncoder,
-})
+}
 
 // FindEncoding searches for an EncodingFactoryby name.
 func FindEncoding(name string) (EncodingFactory, bool) {
@@ -68,6 +74,30 @@ func FindEncoding(name string) (EncodingFactory, bool) {
 	return enc(codec), true
 }
 
+// Name returns the lower case name of e, e.g. "utf-16le" for an encoding
+// detected from the BOM. Encodings not transforming the input are named
+// "plain". Returns an empty string if the name is unknown.
+func Name(e Encoding) string {
+	switch e {
+	case encoding.Nop:
+		return "plain"
+	case utf8Validating:
+		return "utf-8"
+	case utf32Map[bigEndian]:
+		return "utf-32be"
+	case utf32Map[littleEndian]:
+		return "utf-32le"
+	}
+
+	if name, err := htmlindex.Name(e); err == nil {
+		return name
+	}
+	if s, ok := e.(fmt.Stringer); ok {
+		return strings.ToLower(s.String())
+	}
+	return ""
+}
+
 func enc(e Encoding) EncodingFactory {
 	return func(io.Reader) (Encoding, error) {
 		return e, nil
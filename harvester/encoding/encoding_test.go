@@ -0,0 +1,35 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestName(t *testing.T) {
+	var tests = []struct {
+		encoding string
+		content  []byte
+		expected string
+	}{
+		{"plain", nil, "plain"},
+		{"utf-8", nil, "utf-8"},
+		{"latin1", nil, "windows-1252"},
+		{"gbk", nil, "gbk"},
+		{"utf-16le", nil, "utf-16le"},
+		{"auto", []byte{0xfe, 0xff, 0x00, 'a'}, "utf-16be"},
+		{"auto", []byte{0xff, 0xfe, 0x00, 0x00}, "utf-32le"},
+		{"auto", []byte{0xef, 0xbb, 0xbf, 'a'}, "utf-8"},
+		{"auto", []byte("abc"), "plain"},
+	}
+
+	for _, test := range tests {
+		factory, ok := FindEncoding(test.encoding)
+		assert.True(t, ok)
+
+		encoding, err := factory(bytes.NewReader(test.content))
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, Name(encoding), "encoding %s", test.encoding)
+	}
+}
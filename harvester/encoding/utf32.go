@@ -0,0 +1,95 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// utf32Encoding implements UTF-32 without BOM handling. The BOM is expected
+// to be handled by the encoding factory (see auto BOM detection).
+type utf32Encoding struct {
+	endianness endianness
+}
+
+type utf32Decoder struct {
+	order binary.ByteOrder
+}
+
+type utf32Encoder struct {
+	order binary.ByteOrder
+}
+
+var utf32Map = map[endianness]Encoding{
+	bigEndian:    utf32Encoding{bigEndian},
+	littleEndian: utf32Encoding{littleEndian},
+}
+
+func (u utf32Encoding) NewDecoder() transform.Transformer {
+	return &utf32Decoder{u.byteOrder()}
+}
+
+func (u utf32Encoding) NewEncoder() transform.Transformer {
+	return &utf32Encoder{u.byteOrder()}
+}
+
+func (u utf32Encoding) byteOrder() binary.ByteOrder {
+	if u.endianness == bigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+func (d *utf32Decoder) Reset() {}
+
+func (d *utf32Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc+4 <= len(src) {
+		r := rune(d.order.Uint32(src[nSrc:]))
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += 4
+	}
+
+	if nSrc < len(src) {
+		if !atEOF {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+
+		// incomplete code unit at end of input
+		if nDst+utf8.RuneLen(utf8.RuneError) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], utf8.RuneError)
+		nSrc = len(src)
+	}
+	return nDst, nSrc, nil
+}
+
+func (e *utf32Encoder) Reset() {}
+
+func (e *utf32Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := rune(src[nSrc]), 1
+		if r >= utf8.RuneSelf {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r, size = utf8.DecodeRune(src[nSrc:])
+		}
+
+		if nDst+4 > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		e.order.PutUint32(dst[nDst:], uint32(r))
+		nDst += 4
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
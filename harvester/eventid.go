@@ -0,0 +1,21 @@
+package harvester
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/elastic/filebeat/config"
+)
+
+// eventID returns the hex encoded SHA-256 hash of event_id with all
+// placeholders replaced by the values of the event starting at offset. The
+// same line read again from the same source and offset gets the same id.
+func (h *Harvester) eventID(offset int64, text string) string {
+	format := h.Config.EventID
+	if format == "" {
+		format = config.DefaultEventID
+	}
+
+	sum := sha256.Sum256([]byte(h.expandPlaceholders(format, offset, text)))
+	return hex.EncodeToString(sum[:])
+}
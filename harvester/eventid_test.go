@@ -0,0 +1,31 @@
+package harvester
+
+import (
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventID(t *testing.T) {
+	h := &Harvester{
+		Source: "/var/log/app.log",
+		Config: &config.HarvesterConfig{},
+	}
+
+	// same input yields the same id
+	id := h.eventID(42, "line")
+	assert.Equal(t, "d67ff32c636f0b7f5a2da1b52d777b27394f4ded5210b48f4bca5f7ce34af2fd", id)
+	assert.Equal(t, id, h.eventID(42, "line"))
+
+	// default uses source and offset only
+	assert.Equal(t, id, h.eventID(42, "other line"))
+	assert.NotEqual(t, id, h.eventID(43, "line"))
+
+	h.Source = "/var/log/other.log"
+	assert.NotEqual(t, id, h.eventID(42, "line"))
+
+	h.Config.EventID = "%{source}:%{offset}:%{line}"
+	assert.Equal(t, h.eventID(42, "line"), h.eventID(42, "line"))
+	assert.NotEqual(t, h.eventID(42, "line"), h.eventID(42, "other line"))
+}
@@ -0,0 +1,52 @@
+package harvester
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/libbeat/common"
+)
+
+// fieldExtractor adds the named capture groups of a regular expression
+// matching the line as fields of the event.
+type fieldExtractor struct {
+	pattern *regexp.Regexp
+}
+
+func newFieldExtractor(cfg *config.ExtractConfig) (*fieldExtractor, error) {
+	if err := config.CompileRegexp("extract.pattern", &cfg.PatternRegexp, cfg.Pattern); err != nil {
+		return nil, err
+	}
+	pattern := cfg.PatternRegexp
+
+	named := false
+	for _, name := range pattern.SubexpNames() {
+		named = named || name != ""
+	}
+	if !named {
+		return nil, fmt.Errorf("extract.pattern '%v' has no named capture group", cfg.Pattern)
+	}
+
+	return &fieldExtractor{pattern: pattern}, nil
+}
+
+// extract returns the values of the named groups of the first match in line.
+// The pattern is not anchored, so it can match part of the line. Groups not
+// participating in the match, e.g. of an optional part of the pattern, are
+// left out. Returns an error if the pattern does not match.
+func (e *fieldExtractor) extract(line string) (common.MapStr, error) {
+	match := e.pattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		return nil, fmt.Errorf("no match of extract.pattern")
+	}
+
+	fields := common.MapStr{}
+	for i, name := range e.pattern.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		fields[name] = line[match[2*i]:match[2*i+1]]
+	}
+	return fields, nil
+}
@@ -0,0 +1,85 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/elastic/libbeat/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldExtractor(t *testing.T) {
+	e, err := newFieldExtractor(&config.ExtractConfig{
+		Pattern: `(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<status>\d{3}))?`,
+	})
+	assert.Nil(t, err)
+
+	fields, err := e.extract("GET /index.html 200")
+	assert.Nil(t, err)
+	assert.Equal(t, common.MapStr{"method": "GET", "path": "/index.html", "status": "200"}, fields)
+
+	// the pattern can match part of the line
+	fields, err = e.extract("10.0.0.1 - POST /login 302 512")
+	assert.Nil(t, err)
+	assert.Equal(t, common.MapStr{"method": "POST", "path": "/login", "status": "302"}, fields)
+
+	// groups not participating in the match are left out
+	fields, err = e.extract("GET /index.html")
+	assert.Nil(t, err)
+	assert.Equal(t, common.MapStr{"method": "GET", "path": "/index.html"}, fields)
+
+	// empty matches are kept
+	e, err = newFieldExtractor(&config.ExtractConfig{Pattern: `^(?P<prefix>\w*):`})
+	assert.Nil(t, err)
+	fields, err = e.extract(": message")
+	assert.Nil(t, err)
+	assert.Equal(t, common.MapStr{"prefix": ""}, fields)
+
+	_, err = e.extract("no prefix")
+	assert.NotNil(t, err)
+}
+
+func TestFieldExtractorInvalidConfig(t *testing.T) {
+	_, err := newFieldExtractor(&config.ExtractConfig{Pattern: "("})
+	assert.NotNil(t, err)
+
+	// unnamed groups only
+	_, err = newFieldExtractor(&config.ExtractConfig{Pattern: `(\w+) (\w+)`})
+	assert.NotNil(t, err)
+}
+
+func TestSendEventExtract(t *testing.T) {
+	spooler := make(chan *input.FileEvent, 3)
+	h := &Harvester{
+		Config: &config.HarvesterConfig{
+			Extract: &config.ExtractConfig{
+				Pattern:     `level=(?P<level>\w+)`,
+				AddErrorKey: true,
+			},
+		},
+		SpoolerChan: spooler,
+	}
+	h.extractor, _ = newFieldExtractor(h.Config.Extract)
+
+	now := time.Now()
+	h.sendEvent(now, "level=warn disk full", 20, false, false, nil)
+	h.sendEvent(now, "disk full", 9, false, false, nil)
+	h.sendEvent(now, "level=in", 8, true, false, nil)
+
+	event := <-spooler
+	assert.Equal(t, common.MapStr{"level": "warn"}, event.ExtractedFields)
+	assert.Equal(t, "", event.ExtractError)
+
+	// the message is kept if the pattern does not match
+	event = <-spooler
+	assert.Nil(t, event.ExtractedFields)
+	assert.Equal(t, "disk full", *event.Text)
+	assert.NotEqual(t, "", event.ExtractError)
+
+	// partial lines are not extracted
+	event = <-spooler
+	assert.Nil(t, event.ExtractedFields)
+	assert.Equal(t, "", event.ExtractError)
+}
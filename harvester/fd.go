@@ -0,0 +1,59 @@
+package harvester
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/libbeat/logp"
+)
+
+// fdScheme marks paths of inherited file descriptors, e.g. fd:3
+const fdScheme = "fd:"
+
+// IsFDPath returns true if path refers to an inherited file descriptor using
+// the fd: scheme, e.g. the stdout and stderr streams of a container passed to
+// a sidecar.
+func IsFDPath(path string) bool {
+	return strings.HasPrefix(path, fdScheme)
+}
+
+// IsStreamPath returns true if path refers to stdin or an inherited file
+// descriptor. Streams are read once up to EOF and have no state to resume.
+func IsStreamPath(path string) bool {
+	return path == "-" || IsFDPath(path)
+}
+
+// parseFDPath returns the file descriptor number of a path like fd:3.
+func parseFDPath(path string) (uintptr, error) {
+	fd, err := strconv.ParseUint(strings.TrimPrefix(path, fdScheme), 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file descriptor path '%v', must be fd:N", path)
+	}
+	return uintptr(fd), nil
+}
+
+// openFD assigns the inherited file descriptor given by h.Path. Like stdin,
+// it is read as a non seekable pipe, so the harvester stops on EOF.
+func (h *Harvester) openFD() (encoding.Encoding, error) {
+	fd, err := parseFDPath(h.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := os.NewFile(fd, h.Path)
+	if file == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	if _, err := file.Stat(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("file descriptor %d can not be read: %v", fd, err)
+	}
+
+	logp.Debug("harvester", "harvest: file descriptor %q", h.Path)
+	h.Offset = 0
+	h.file = pipeSource{file}
+	return h.encoding(h.file)
+}
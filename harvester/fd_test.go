@@ -0,0 +1,86 @@
+// +build !windows
+
+package harvester
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFDPath(t *testing.T) {
+	assert.True(t, IsFDPath("fd:3"))
+	assert.False(t, IsFDPath("/var/log/fd:3"))
+	assert.True(t, IsStreamPath("-"))
+	assert.True(t, IsStreamPath("fd:4"))
+	assert.False(t, IsStreamPath("unix:///run/app.sock"))
+	assert.Equal(t, "fd:3", NormalizeSource("fd:3"))
+
+	fd, err := parseFDPath("fd:3")
+	assert.Nil(t, err)
+	assert.Equal(t, uintptr(3), fd)
+
+	for _, path := range []string{"fd:", "fd:-1", "fd:stdout"} {
+		_, err := parseFDPath(path)
+		assert.NotNil(t, err, path)
+	}
+}
+
+func TestHarvestFD(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	defer reader.Close()
+
+	// the harvester closes its own copy of the file descriptor
+	fd, err := syscall.Dup(int(reader.Fd()))
+	if err != nil {
+		t.Fatalf("Error duplicating file descriptor: %v", err)
+	}
+
+	writer.WriteString("stdout 1\nstdout 2\n")
+	writer.Close()
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{BufferSize: 1024},
+		fmt.Sprintf("fd:%d", fd), nil, spooler)
+	assert.Nil(t, err)
+
+	var reason string
+	h.Lifecycle = func(event LifecycleEvent) {
+		reason = event.Reason
+	}
+
+	// stops on EOF of the stream
+	h.Harvest()
+	assert.Equal(t, StopReasonEOF, reason)
+
+	close(spooler)
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "stdout 1", *events[0].Text)
+	assert.Equal(t, "stdout 2", *events[1].Text)
+	assert.Equal(t, fmt.Sprintf("fd:%d", fd), *events[1].Source)
+}
+
+func TestOpenFDInvalid(t *testing.T) {
+	h := &Harvester{
+		Path:   "fd:1000",
+		Config: &config.HarvesterConfig{},
+		done:   make(chan struct{}),
+	}
+	_, err := h.open()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,38 @@
+package harvester
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// addFileFields returns a copy of fields extended by the absolute path, the
+// name and the directory of the harvested file. The configured fields are
+// shared by all harvesters of a prospector and must not be modified.
+func addFileFields(fields map[string]string, path string) (map[string]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(fields)+3)
+	for key, value := range fields {
+		result[key] = value
+	}
+
+	result["file_path"] = absPath
+	result["file_name"] = filepath.Base(absPath)
+	result["file_dir"] = filepath.Dir(absPath)
+	return result, nil
+}
+
+// NormalizeSource returns the canonical form of path used as event source and
+// registry key if normalize_source is enabled. The path is cleaned and case
+// folded, so differently spelled paths of the same file on case insensitive
+// file systems share one source. Streams, sockets and remote files are not
+// normalized.
+func NormalizeSource(path string) string {
+	if IsStreamPath(path) || IsSocketPath(path) || IsSFTPPath(path) {
+		return path
+	}
+	return strings.ToLower(filepath.Clean(path))
+}
@@ -0,0 +1,31 @@
+package harvester
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddFileFields(t *testing.T) {
+	configured := map[string]string{"hello": "world"}
+
+	fields, err := addFileFields(configured, filepath.Join("logs", "app.log"))
+	assert.Nil(t, err)
+
+	absPath, _ := filepath.Abs(filepath.Join("logs", "app.log"))
+	assert.Equal(t, "world", fields["hello"])
+	assert.Equal(t, absPath, fields["file_path"])
+	assert.Equal(t, "app.log", fields["file_name"])
+	assert.Equal(t, filepath.Dir(absPath), fields["file_dir"])
+
+	// configured fields are not modified
+	assert.Equal(t, 1, len(configured))
+}
+
+func TestNormalizeSource(t *testing.T) {
+	assert.Equal(t, filepath.Join("c:", "logs", "app.log"),
+		NormalizeSource(filepath.Join("C:", "Logs", ".", "APP.LOG")))
+	assert.Equal(t, "-", NormalizeSource("-"))
+	assert.Equal(t, "unix:///run/App.sock", NormalizeSource("unix:///run/App.sock"))
+}
@@ -1,4 +1,126 @@
 package harvester
 
-// File harvester crawls full file and sends them to tika for "indexing".
-// This is a potential substitute for fsriver
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/libbeat/logp"
+	"golang.org/x/text/transform"
+)
+
+// harvestFile reads the whole content of the file until EOF and sends it as
+// one event (input_type: file). The offset stored in the registrar is the
+// file size, so the file is only read again if its size changes. Returns an
+// error if the file could not be read.
+func (h *Harvester) harvestFile(enc encoding.Encoding, info os.FileInfo) error {
+	if h.Offset > 0 && h.file.Continuable() {
+		if h.Offset == info.Size() {
+			logp.Debug("harvester", "File %s unchanged since last read. Skipping.", h.Path)
+			return nil
+		}
+
+		// file changed since being sent. Read the whole file again
+		logp.Debug("harvester", "File %s changed since last read. Reading from beginning.", h.Path)
+		var err error
+		enc, err = h.rewind()
+		if err != nil {
+			logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+			return err
+		}
+	}
+
+	counter := &countingReader{in: h.file}
+	decoder := newInvalidDetector(enc)
+	var in io.Reader = transform.NewReader(counter, decoder)
+
+	// Only max_bytes are kept in memory. One more byte is read to detect
+	// larger files
+	if h.Config.MaxBytes > 0 {
+		in = io.LimitReader(in, int64(h.Config.MaxBytes)+1)
+	}
+	content, err := ioutil.ReadAll(in)
+	if err != nil {
+		logp.Err("File reading error. Stopping harvester. Error: %s", err)
+		return err
+	}
+
+	if h.Config.MaxBytes > 0 && len(content) > h.Config.MaxBytes {
+		// the rest of the file is read without decoding it, so the offset
+		// covers the whole file
+		if _, err := io.Copy(ioutil.Discard, counter); err != nil {
+			logp.Err("File reading error. Stopping harvester. Error: %s", err)
+			return err
+		}
+		logp.Debug("harvester", "File of %d bytes exceeds max_bytes (%d) and was truncated: %s", counter.n, h.Config.MaxBytes, h.Path)
+		content = trimIncompleteRune(content[:h.Config.MaxBytes])
+	}
+	if counter.n == 0 {
+		return nil
+	}
+
+	text, ok, err := h.checkEncoding(string(content), decoder.invalid)
+	if err != nil {
+		logp.Err("Stop Harvesting. Invalid input for encoding '%s' in file %s", h.Config.Encoding, h.Path)
+		return err
+	}
+	if !ok {
+		h.Offset += int64(counter.n)
+		return nil
+	}
+
+	h.stats.lineRead(counter.n, time.Now())
+	h.sendEvent(time.Now(), text, counter.n, false, false, &info)
+	logp.Info("End of file reached: %s. Stopping harvester.", h.Path)
+	return nil
+}
+
+// rewind seeks to the beginning of the file and reinitializes the encoding,
+// skipping a byte order mark again.
+func (h *Harvester) rewind() (encoding.Encoding, error) {
+	seeker, ok := h.file.(io.Seeker)
+	if !ok {
+		return nil, errNotSeekable
+	}
+
+	if _, err := seeker.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	enc, err := h.encoding(h.file)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Offset, err = seeker.Seek(0, os.SEEK_CUR)
+	return enc, err
+}
+
+// trimIncompleteRune drops an incomplete UTF-8 sequence at the end of b, e.g.
+// of content cut at max_bytes.
+func trimIncompleteRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			return b
+		}
+	}
+	return b
+}
+
+// countingReader counts the raw bytes read from in
+type countingReader struct {
+	in io.Reader
+	n  int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.in.Read(p)
+	c.n += n
+	return n, err
+}
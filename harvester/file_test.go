@@ -0,0 +1,111 @@
+package harvester
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvestWholeFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-whole-file")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	content := "<doc>\n  <item>1</item>\n</doc>\n"
+	file.WriteString(content)
+
+	spooler := make(chan *input.FileEvent, 2)
+	newHarvester := func(offset int64) *Harvester {
+		h, err := NewHarvester(
+			config.ProspectorConfig{},
+			&config.HarvesterConfig{
+				InputType:  config.FileInputType,
+				BufferSize: 1024,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+		h.Offset = offset
+		return h
+	}
+
+	h := newHarvester(0)
+	h.Harvest()
+
+	assert.Equal(t, 1, len(spooler))
+	event := <-spooler
+	assert.Equal(t, content, *event.Text)
+	assert.Equal(t, int64(len(content)), h.Offset)
+
+	// unchanged file is not sent again
+	h = newHarvester(int64(len(content)))
+	h.Harvest()
+	assert.Equal(t, 0, len(spooler))
+
+	// changed file is sent again as a whole
+	file.WriteString("<!-- updated -->\n")
+	h = newHarvester(int64(len(content)))
+	h.Harvest()
+
+	assert.Equal(t, 1, len(spooler))
+	event = <-spooler
+	assert.Equal(t, content+"<!-- updated -->\n", *event.Text)
+	assert.Equal(t, int64(0), event.Offset)
+}
+
+func TestHarvestWholeFileMaxBytes(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-whole-file")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// max_bytes cuts the 2 byte ü, which is dropped
+	content := strings.Repeat("a", 9) + "ü" + strings.Repeat("b", 100000)
+	file.WriteString(content)
+
+	spooler := make(chan *input.FileEvent, 1)
+	h, err := NewHarvester(
+		config.ProspectorConfig{},
+		&config.HarvesterConfig{
+			InputType:      config.FileInputType,
+			BufferSize:     1024,
+			MaxBytes:       10,
+			EncodingErrors: config.EncodingErrorsStrict,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+
+	assert.Equal(t, 1, len(spooler))
+	event := <-spooler
+	assert.Equal(t, strings.Repeat("a", 9), *event.Text)
+	assert.Equal(t, len(content), event.Bytes)
+	assert.Equal(t, int64(len(content)), h.Offset)
+}
+
+func TestTrimIncompleteRune(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"abü", "abü"},
+		{"ab\xc3", "ab"},
+		{"ab\xe2\x82", "ab"},
+		{"ab€", "ab€"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, string(trimIncompleteRune([]byte(test.input))))
+	}
+}
@@ -0,0 +1,43 @@
+package harvester
+
+import (
+	"regexp"
+	"strings"
+)
+
+// includeLines drops all lines not matching any of the include_lines patterns
+type includeLines []*regexp.Regexp
+
+// excludeLines drops all lines matching any of the exclude_lines patterns
+type excludeLines []*regexp.Regexp
+
+func (r includeLines) Process(line *string) (*string, bool) {
+	return line, matchAny(r, *line)
+}
+
+func (r excludeLines) Process(line *string) (*string, bool) {
+	return line, !matchAny(r, *line)
+}
+
+// matchAny checks if the text matches any of the regular expressions
+func matchAny(regexps []*regexp.Regexp, text string) bool {
+	for _, r := range regexps {
+		if r.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyLine checks if line is dropped by drop_empty_lines. If
+// drop_whitespace_lines is set, lines consisting of whitespace only are
+// dropped as well.
+func (h *Harvester) isEmptyLine(line string) bool {
+	if !h.Config.DropEmptyLines {
+		return false
+	}
+	if h.Config.DropWhitespaceLines {
+		return strings.TrimSpace(line) == ""
+	}
+	return line == ""
+}
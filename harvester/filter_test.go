@@ -0,0 +1,60 @@
+package harvester
+
+import (
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncludeExcludeLines(t *testing.T) {
+	var err error
+	h := Harvester{}
+
+	h.Processors, err = NewProcessors(&config.HarvesterConfig{
+		IncludeLines: []string{"^ERR", "^WARN"},
+		ExcludeLines: []string{"ignore"},
+	})
+	assert.Nil(t, err)
+
+	isExported := func(line string) bool {
+		_, ok := h.processLine(line)
+		return ok
+	}
+
+	assert.True(t, isExported("ERR something failed"))
+	assert.True(t, isExported("WARN disk almost full"))
+	assert.False(t, isExported("DBG some debug output"))
+
+	// exclude wins if both match
+	assert.False(t, isExported("ERR please ignore"))
+}
+
+func TestNoProcessors(t *testing.T) {
+	h := Harvester{}
+	text, ok := h.processLine("any line")
+	assert.True(t, ok)
+	assert.Equal(t, "any line", text)
+}
+
+func TestCompileRegexpsInvalid(t *testing.T) {
+	_, err := NewProcessors(&config.HarvesterConfig{IncludeLines: []string{"("}})
+	assert.NotNil(t, err)
+
+	_, err = NewProcessors(&config.HarvesterConfig{ExcludeLines: []string{"("}})
+	assert.NotNil(t, err)
+}
+
+func TestIsEmptyLine(t *testing.T) {
+	h := Harvester{Config: &config.HarvesterConfig{}}
+	assert.False(t, h.isEmptyLine(""))
+
+	h.Config.DropEmptyLines = true
+	assert.True(t, h.isEmptyLine(""))
+	assert.False(t, h.isEmptyLine(" \t"))
+	assert.False(t, h.isEmptyLine("text"))
+
+	h.Config.DropWhitespaceLines = true
+	assert.True(t, h.isEmptyLine(" \t"))
+	assert.False(t, h.isEmptyLine(" text "))
+}
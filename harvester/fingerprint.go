@@ -0,0 +1,46 @@
+package harvester
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+)
+
+// readFingerprint returns the hash of the first fingerprint_size bytes of the
+// harvested file. If the file is shorter, nil is returned.
+func (h *Harvester) readFingerprint() ([]byte, error) {
+	readerAt, ok := h.file.(io.ReaderAt)
+	if !ok {
+		return nil, errNotSeekable
+	}
+
+	head := make([]byte, h.Config.FingerprintSize)
+	_, err := readerAt.ReadAt(head, 0)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(head)
+	return sum[:], nil
+}
+
+// fingerprintChanged checks if the head of the file still matches the
+// fingerprint taken when the file was opened. This detects files being
+// rewritten with content of about the same size, which is not detected by
+// comparing the file size with the offset. If no fingerprint was taken yet,
+// because the file was too short, it is taken now.
+func (h *Harvester) fingerprintChanged() (bool, error) {
+	current, err := h.readFingerprint()
+	if err != nil {
+		return false, err
+	}
+
+	if h.fingerprint == nil {
+		h.fingerprint = current
+		return false, nil
+	}
+	return !bytes.Equal(current, h.fingerprint), nil
+}
@@ -0,0 +1,90 @@
+package harvester
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintChanged(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-fingerprint")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	h := &Harvester{
+		Path:   file.Name(),
+		Config: &config.HarvesterConfig{FingerprintSize: 8},
+		file:   fileSource{file},
+	}
+
+	// file too short, fingerprint is taken once enough content was written
+	file.WriteString("line 1\n")
+	changed, err := h.fingerprintChanged()
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.Nil(t, h.fingerprint)
+
+	file.WriteString("line 2\n")
+	changed, err = h.fingerprintChanged()
+	assert.Nil(t, err)
+	assert.False(t, changed)
+	assert.NotNil(t, h.fingerprint)
+
+	// appending does not change the head of the file
+	file.WriteString("line 3\n")
+	changed, err = h.fingerprintChanged()
+	assert.Nil(t, err)
+	assert.False(t, changed)
+
+	file.WriteAt([]byte("LINE 1\n"), 0)
+	changed, err = h.fingerprintChanged()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+}
+
+func TestHandleReadlineErrorFingerprint(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-fingerprint")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("2016-01-01 old line\n")
+
+	h := &Harvester{
+		Path: file.Name(),
+		ProspectorConfig: config.ProspectorConfig{
+			IgnoreOlderDuration: time.Hour,
+		},
+		Config: &config.HarvesterConfig{
+			FingerprintSize: 16,
+			CloseEOF:        true,
+		},
+		Offset: 20,
+		file:   fileSource{file},
+		done:   make(chan struct{}),
+	}
+	h.fingerprint, err = h.readFingerprint()
+	assert.Nil(t, err)
+
+	// rewritten with content of the same size
+	file.WriteAt([]byte("2016-01-02 new line\n"), 0)
+
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), h.Offset)
+	assert.Nil(t, h.fingerprint)
+
+	content, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "2016-01-02 new line\n", string(content))
+}
@@ -0,0 +1,168 @@
+package harvester
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/libbeat/logp"
+)
+
+// frameReader reads records prefixed by their length in bytes. Incomplete
+// frames are kept buffered, so reading can continue once the remaining bytes
+// have been written.
+type frameReader struct {
+	reader     io.Reader
+	prefixSize int
+	order      binary.ByteOrder
+	maxBytes   int
+
+	buf       []byte // prefix and payload of the current frame
+	discarded int64  // payload bytes of the current frame dropped due to max_bytes
+}
+
+func newFrameReader(reader io.Reader, prefixSize int, byteOrder string, maxBytes int) *frameReader {
+	var order binary.ByteOrder = binary.BigEndian
+	if byteOrder == config.FrameByteOrderLittle {
+		order = binary.LittleEndian
+	}
+
+	return &frameReader{
+		reader:     reader,
+		prefixSize: prefixSize,
+		order:      order,
+		maxBytes:   maxBytes,
+	}
+}
+
+// next returns the payload of the next frame and the number of raw bytes the
+// frame spans, including the prefix. Payloads exceeding max_bytes are
+// truncated. Returns io.EOF if the frame is not complete yet.
+func (r *frameReader) next() ([]byte, int, error) {
+	if err := r.fill(r.prefixSize); err != nil {
+		return nil, 0, err
+	}
+
+	length := r.length()
+	keep := length
+	if r.maxBytes > 0 && keep > int64(r.maxBytes) {
+		keep = int64(r.maxBytes)
+	}
+
+	if err := r.fill(r.prefixSize + int(keep)); err != nil {
+		return nil, 0, err
+	}
+
+	if remaining := length - keep - r.discarded; remaining > 0 {
+		n, err := io.CopyN(ioutil.Discard, r.reader, remaining)
+		r.discarded += n
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	payload := make([]byte, keep)
+	copy(payload, r.buf[r.prefixSize:])
+	sz := r.prefixSize + int(length)
+
+	r.reset()
+	return payload, sz, nil
+}
+
+// reset drops the buffered bytes of the current frame
+func (r *frameReader) reset() {
+	r.buf = r.buf[:0]
+	r.discarded = 0
+}
+
+// fill reads until n bytes are buffered
+func (r *frameReader) fill(n int) error {
+	if cap(r.buf) < n {
+		buf := make([]byte, len(r.buf), n)
+		copy(buf, r.buf)
+		r.buf = buf
+	}
+
+	for len(r.buf) < n {
+		read, err := r.reader.Read(r.buf[len(r.buf):n])
+		r.buf = r.buf[:len(r.buf)+read]
+		if len(r.buf) == n {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if read == 0 {
+			return io.EOF
+		}
+	}
+	return nil
+}
+
+// length decodes the payload length from the buffered prefix
+func (r *frameReader) length() int64 {
+	prefix := r.buf[:r.prefixSize]
+	switch r.prefixSize {
+	case 1:
+		return int64(prefix[0])
+	case 2:
+		return int64(r.order.Uint16(prefix))
+	case 4:
+		return int64(r.order.Uint32(prefix))
+	default:
+		return int64(r.order.Uint64(prefix) & (1<<63 - 1))
+	}
+}
+
+// harvestFramed reads length-prefixed records (input_type: framed) and sends
+// each payload as one event. The offset advances by prefix and payload size.
+// At the end of the file, the harvester backs off until incomplete frames
+// have been written completely.
+func (h *Harvester) harvestFramed(info os.FileInfo) error {
+	reader := newFrameReader(h.file, h.Config.FramePrefixSize, h.Config.FrameByteOrder, h.Config.MaxBytes)
+	lastReadTime := time.Now()
+
+	for {
+		h.stats.update(h.Offset, h.backoff)
+
+		if h.stopped() || !h.waitResumed() {
+			logp.Info("Harvester for file %s stopped", h.Path)
+			return errStopped
+		}
+
+		payload, sz, err := reader.next()
+		if err != nil {
+			offset := h.Offset
+			if err = h.handleReadlineError(lastReadTime, err); err != nil {
+				if err == io.EOF {
+					logp.Info("End of file reached: %s. Stopping harvester.", h.Path)
+				} else if err == errInactive || err == errEmpty {
+					logp.Info("Closing file: %s", h.Path)
+				} else {
+					logp.Err("File reading error. Stopping harvester. Error: %s", err)
+				}
+				return err
+			}
+
+			// file was truncated and is read from the beginning
+			if h.Offset != offset {
+				reader.reset()
+			}
+			continue
+		}
+
+		lastReadTime = time.Now()
+		h.resetBackoff()
+
+		if h.Config.MaxBytes > 0 && len(payload) < sz-h.Config.FramePrefixSize {
+			logp.Debug("harvester", "Frame of %d bytes exceeds max_bytes (%d) and was truncated: %s", sz-h.Config.FramePrefixSize, h.Config.MaxBytes, h.Path)
+		}
+
+		h.stats.lineRead(sz, lastReadTime)
+		h.Metrics.lineRead(sz)
+		h.sendEvent(lastReadTime, string(payload), sz, false, false, &info)
+	}
+}
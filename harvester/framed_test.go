@@ -0,0 +1,97 @@
+package harvester
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameReader(t *testing.T) {
+	var buf bytes.Buffer
+	reader := newFrameReader(&buf, 4, config.FrameByteOrderBig, 4)
+
+	// incomplete prefix and payload are kept buffered
+	buf.Write([]byte{0, 0})
+	_, _, err := reader.next()
+	assert.Equal(t, io.EOF, err)
+
+	buf.Write([]byte{0, 3, 'a', 'b'})
+	_, _, err = reader.next()
+	assert.Equal(t, io.EOF, err)
+
+	buf.Write([]byte{'c'})
+	payload, sz, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(payload))
+	assert.Equal(t, 7, sz)
+
+	// payload exceeding max_bytes is truncated, but consumed completely
+	buf.Write([]byte{0, 0, 0, 6, '1', '2', '3', '4', '5'})
+	_, _, err = reader.next()
+	assert.Equal(t, io.EOF, err)
+
+	buf.Write([]byte{'6', 0, 0, 0, 1, 'x'})
+	payload, sz, err = reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", string(payload))
+	assert.Equal(t, 10, sz)
+
+	payload, sz, err = reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "x", string(payload))
+	assert.Equal(t, 5, sz)
+}
+
+func TestFrameReaderLittleEndian(t *testing.T) {
+	reader := newFrameReader(bytes.NewReader([]byte{2, 0, 'h', 'i'}), 2, config.FrameByteOrderLittle, 0)
+
+	payload, sz, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", string(payload))
+	assert.Equal(t, 4, sz)
+}
+
+func TestHarvestFramed(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-framed")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.Write([]byte{0, 5, 'f', 'i', 'r', 's', 't', 0, 6, 's', 'e', 'c', 'o', 'n', 'd'})
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			InputType:       config.FramedInputType,
+			FramePrefixSize: 2,
+			FrameByteOrder:  config.FrameByteOrderBig,
+			CloseEOF:        true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "first", *events[0].Text)
+	assert.Equal(t, int64(0), events[0].Offset)
+	assert.Equal(t, "second", *events[1].Text)
+	assert.Equal(t, int64(7), events[1].Offset)
+	assert.Equal(t, int64(15), h.Offset)
+}
@@ -0,0 +1,82 @@
+package harvester
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipSource reads the uncompressed content of a gzip compressed file. As
+// compressed files are not expected to grow, reading stops on EOF.
+type gzipSource struct {
+	file   *os.File
+	reader *gzip.Reader
+}
+
+func (g gzipSource) Read(b []byte) (int, error) { return g.reader.Read(b) }
+func (g gzipSource) Name() string               { return g.file.Name() }
+func (g gzipSource) Stat() (os.FileInfo, error) { return g.file.Stat() }
+func (g gzipSource) Continuable() bool          { return false }
+
+func (g gzipSource) Close() error {
+	g.reader.Close()
+	return g.file.Close()
+}
+
+// newGzipSource creates a gzipSource for file. Offset is the number of
+// uncompressed bytes already read, which are skipped.
+func newGzipSource(file *os.File, offset int64) (gzipSource, error) {
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return gzipSource{}, err
+	}
+
+	if offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, reader, offset); err != nil {
+			reader.Close()
+			return gzipSource{}, err
+		}
+	}
+
+	return gzipSource{file: file, reader: reader}, nil
+}
+
+// isGzipFile checks by file extension or gzip magic header if file is gzip
+// compressed. The read offset is reset to the beginning of the file.
+func isGzipFile(file *os.File) (bool, error) {
+	if strings.HasSuffix(file.Name(), ".gz") {
+		return true, nil
+	}
+
+	var magic [2]byte
+	n, err := io.ReadFull(file, magic[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	if _, err := file.Seek(0, os.SEEK_SET); err != nil {
+		return false, err
+	}
+
+	return n == len(gzipMagic) && bytes.Equal(magic[:], gzipMagic), nil
+}
+
+// compressText returns text gzip compressed and base64 encoded, the message of
+// events with compress_text_over exceeded.
+func compressText(text string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, text); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,67 @@
+package harvester
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-gzip")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// gzip compressed file without .gz extension to test magic header detection
+	path := filepath.Join(dir, "rotated.log.1")
+	out, err := os.Create(path)
+	assert.Nil(t, err)
+
+	writer := gzip.NewWriter(out)
+	writer.Write([]byte("line 1\nline 2\n"))
+	writer.Close()
+	out.Close()
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+
+	compressed, err := isGzipFile(file)
+	assert.Nil(t, err)
+	assert.True(t, compressed)
+
+	// resume after first line
+	source, err := newGzipSource(file, 7)
+	assert.Nil(t, err)
+	defer source.Close()
+
+	content, err := ioutil.ReadAll(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "line 2\n", string(content))
+	assert.False(t, source.Continuable())
+}
+
+func TestIsGzipFilePlain(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-plain")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("plain text\n")
+	file.Seek(0, os.SEEK_SET)
+
+	compressed, err := isGzipFile(file)
+	assert.Nil(t, err)
+	assert.False(t, compressed)
+
+	// read offset must be reset
+	content, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "plain text\n", string(content))
+}
@@ -11,15 +11,48 @@ import (
 )
 
 type Harvester struct {
-	Path             string /* the file path to harvest */
+	stats            harvesterStats /* first field to guarantee 64bit alignment of counters */
+	Path             string         /* the file path to harvest */
+	Source           string         /* the source of published events, the path or its normalized form */
 	ProspectorConfig config.ProspectorConfig
 	Config           *config.HarvesterConfig
 	Offset           int64
+	TailFiles        bool /* start new files at the end. Disabled for files created while running */
 	Stat             *FileStat
 	SpoolerChan      chan *input.FileEvent
+	TeeChans         []chan *input.FileEvent /* secondary spoolers receiving a copy of each event, see tee_policy */
 	encoding         encoding.EncodingFactory
+	encodingName     string     /* name of the encoding used to read the file */
 	file             FileSource /* the file being watched */
 	backoff          time.Duration
+	adaptiveBackoff  *adaptiveBackoff /* set with adaptive_backoff */
+	multiline        *multiline
+	Processors       []LineProcessor /* applied to the text of each line before sending */
+	done             chan struct{}   /* closed by Stop to interrupt harvesting */
+	pause            *pauseGate      /* blocks reading while paused */
+	fileStateOS      *input.FileStateOS
+	fields           map[string]string /* configured fields, optionally extended by file fields */
+	fieldTemplates   []string          /* keys of fields with placeholders, expanded per event */
+	limiter          *rateLimiter
+	timestamp        *timestampParser
+	extractor        *fieldExtractor
+	Lifecycle        func(LifecycleEvent) /* optional, called when harvesting starts, restarts after truncation and stops */
+	Metrics          *SourceMetrics       /* optional, updated while harvesting */
+	headerLines      int                  /* number of header lines still to be skipped */
+	fingerprint      []byte               /* hash of the first fingerprint_size bytes */
+	readLatency      time.Duration        /* duration of the last readLine call, if add_read_latency is set */
+	sequence         uint64               /* number of the last event created, if add_sequence is set */
+	startReason      string               /* StartReason* for the position harvesting started at */
+	statPath         statFunc             /* stats the path for device_check_interval, os.Stat if nil */
+	lineEnding       string               /* line ending of the line sent next, if add_line_ending is set */
+	rawLines         []rawLine            /* raw bytes of lines not sent yet, if raw_bytes is set */
+	partialRaw       []byte               /* raw bytes of the last partial line, if raw_bytes is set */
+	dedup            *dedup               /* combines repeated lines, if dedup_window is set */
+	repeatCount      int                  /* number of lines of the event sent next, if repeated */
+	lastHeartbeat    time.Time            /* time the last heartbeat was sent, if heartbeat_interval is set */
+
+	encodingErrorLogged bool /* invalid input for encoding is logged once only */
+	futureModTimeLogged bool /* modification time in the future is logged once only */
 }
 
 // Contains statistic about file when it was last seend by the prospector
@@ -60,6 +93,15 @@ type fileSource struct{ *os.File }
 
 func (fileSource) Continuable() bool { return true }
 
+// isPipe checks if file is a named pipe or character device.
+func isPipe(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&(os.ModeNamedPipe|os.ModeCharDevice) != 0
+}
+
 func (h *Harvester) Start() {
 	// Starts harvester and picks the right type. In case type is not set, set it to defeault (log)
 
@@ -3,7 +3,10 @@ package harvester
 import (
 	"testing"
 
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
 // Most harvester tests need real files to tes that can be modified. These tests are implemented with
@@ -19,3 +22,22 @@ func TestExampleTest(t *testing.T) {
 	assert.Equal(t, "/var/log/", h.Path)
 
 }
+
+func TestNewHarvesterValidates(t *testing.T) {
+	content := []byte(`
+paths: ["/var/log/*.log"]
+strict_config: true
+bufer_size: 1024
+`)
+
+	prospector := config.ProspectorConfig{}
+	assert.Nil(t, yaml.Unmarshal(content, &prospector))
+
+	spooler := make(chan *input.FileEvent, 1)
+	_, err := NewHarvester(prospector, &prospector.Harvester, "/var/log/test.log", nil, spooler)
+	assert.NotNil(t, err)
+
+	_, err = NewHarvester(prospector, &config.HarvesterConfig{IncludeLines: []string{"("}},
+		"/var/log/test.log", nil, spooler)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,44 @@
+package harvester
+
+import (
+	"os"
+	"time"
+
+	"github.com/elastic/filebeat/input"
+)
+
+// heartbeat publishes a heartbeat event at the current offset if no line was
+// read for heartbeat_interval, so files no longer written to can be alerted on.
+// While the file stays idle, a heartbeat is published every interval.
+func (h *Harvester) heartbeat(lastTimeRead time.Time, info os.FileInfo) {
+	if h.Config.HeartbeatIntervalDuration <= 0 {
+		return
+	}
+
+	last := lastTimeRead
+	if h.lastHeartbeat.After(last) {
+		last = h.lastHeartbeat
+	}
+
+	now := time.Now()
+	if now.Sub(last) < h.Config.HeartbeatIntervalDuration {
+		return
+	}
+	h.lastHeartbeat = now
+
+	source := h.Source
+	event := &input.FileEvent{
+		ReadTime:     now,
+		Source:       &source,
+		InputType:    h.Config.InputType,
+		DocumentType: h.Config.DocumentType,
+		Offset:       h.Offset,
+		Fields:       h.eventFields(h.Offset, ""),
+		Fileinfo:     &info,
+		FileStateOS:  h.fileStateOS,
+		Heartbeat:    true,
+	}
+	event.SetFieldsUnderRoot(h.Config.FieldsUnderRoot)
+
+	h.publish(event)
+}
@@ -0,0 +1,109 @@
+package harvester
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/libbeat/logp"
+	"golang.org/x/text/transform"
+)
+
+var errInvalidEncoding = errors.New("invalid byte sequence for configured encoding")
+
+// replacementChar is U+FFFD encoded in UTF-8
+var replacementChar = []byte(string(utf8.RuneError))
+
+// invalidDetector wraps the decoder of an encoding and records if the input
+// contains byte sequences invalid in the encoding. Decoders either replace
+// invalid sequences with U+FFFD or fail. Failing decoders are continued after
+// the first invalid byte, which is replaced with U+FFFD as well. U+FFFD
+// encoded in the input is not reported as invalid.
+type invalidDetector struct {
+	transform.Transformer
+	replacement []byte // U+FFFD encoded in the input encoding
+	invalid     bool
+}
+
+func newInvalidDetector(codec encoding.Encoding) *invalidDetector {
+	d := &invalidDetector{Transformer: codec.NewDecoder()}
+
+	// encoders not supporting U+FFFD return an error or replace it with \x1a
+	replacement, _, err := transform.Bytes(codec.NewEncoder(), replacementChar)
+	if err == nil && !bytes.Equal(replacement, []byte{0x1a}) {
+		d.replacement = replacement
+	}
+	return d
+}
+
+func (d *invalidDetector) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	nDst, nSrc := 0, 0
+	for {
+		n, m, err := d.Transformer.Transform(dst[nDst:], src[nSrc:], atEOF)
+		if !d.invalid {
+			d.invalid = d.replaced(dst[nDst:nDst+n], src[nSrc:nSrc+m])
+		}
+		nDst += n
+		nSrc += m
+
+		if err == nil || err == transform.ErrShortDst || err == transform.ErrShortSrc || nSrc == len(src) {
+			return nDst, nSrc, err
+		}
+
+		// decoding failed at src[nSrc]. Replace the byte and continue after it
+		if len(dst)-nDst < len(replacementChar) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		d.invalid = true
+		nDst += copy(dst[nDst:], replacementChar)
+		nSrc++
+	}
+}
+
+// replaced checks if the decoder replaced invalid byte sequences of src with
+// U+FFFD in dst. Plain encoding does not transform the input, so dst equals src.
+func (d *invalidDetector) replaced(dst, src []byte) bool {
+	n := bytes.Count(dst, replacementChar)
+	if n == 0 {
+		return false
+	}
+	if d.replacement == nil {
+		return true
+	}
+	return n > bytes.Count(src, d.replacement)
+}
+
+// checkEncoding applies the encoding_errors policy to a decoded line. invalid
+// is set if the decoder found invalid byte sequences in the input. Plain
+// encoding passes the input on as is, so the text is checked to be valid
+// UTF-8. Returns the line to be sent and false if the line is to be dropped.
+// With policy strict, errInvalidEncoding is returned.
+func (h *Harvester) checkEncoding(text string, invalid bool) (string, bool, error) {
+	if !invalid && utf8.ValidString(text) {
+		return text, true, nil
+	}
+
+	policy := h.Config.EncodingErrors
+	if policy == "" {
+		policy = config.DefaultEncodingErrors
+	}
+
+	// log once per harvester only, as all following lines are likely invalid too
+	if !h.encodingErrorLogged {
+		h.encodingErrorLogged = true
+		logp.Warn("Invalid byte sequence for encoding '%s' in file %s at offset %d. Check the encoding setting. Applying encoding_errors: %s",
+			h.Config.Encoding, h.Path, h.Offset, policy)
+	}
+
+	switch policy {
+	case config.EncodingErrorsStrict:
+		return "", false, errInvalidEncoding
+	case config.EncodingErrorsSkip:
+		return "", false, nil
+	default:
+		// converting to runes replaces invalid UTF-8 with U+FFFD
+		return string([]rune(text)), true, nil
+	}
+}
@@ -0,0 +1,149 @@
+package harvester
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/transform"
+)
+
+func TestCheckEncoding(t *testing.T) {
+	tests := []struct {
+		policy   string
+		text     string
+		invalid  bool
+		expected string
+		ok       bool
+		err      error
+	}{
+		{config.EncodingErrorsReplace, "valid line", false, "valid line", true, nil},
+		{config.EncodingErrorsStrict, "valid line", false, "valid line", true, nil},
+		{config.EncodingErrorsReplace, "bad \xff line", false, "bad � line", true, nil},
+		{"", "bad \xff line", false, "bad � line", true, nil},
+		{config.EncodingErrorsReplace, "bad � line", true, "bad � line", true, nil},
+		{config.EncodingErrorsSkip, "bad \xff line", false, "", false, nil},
+		{config.EncodingErrorsSkip, "bad � line", true, "", false, nil},
+		{config.EncodingErrorsStrict, "bad \xff line", false, "", false, errInvalidEncoding},
+
+		// U+FFFD found in the input is valid
+		{config.EncodingErrorsSkip, "valid � line", false, "valid � line", true, nil},
+		{config.EncodingErrorsStrict, "valid � line", false, "valid � line", true, nil},
+	}
+
+	for i, test := range tests {
+		h := &Harvester{
+			Config: &config.HarvesterConfig{EncodingErrors: test.policy},
+		}
+
+		text, ok, err := h.checkEncoding(test.text, test.invalid)
+		assert.Equal(t, test.expected, text, "test %d", i)
+		assert.Equal(t, test.ok, ok, "test %d", i)
+		assert.Equal(t, test.err, err, "test %d", i)
+	}
+}
+
+func TestInvalidDetector(t *testing.T) {
+	tests := []struct {
+		encoding string
+		input    string
+		expected string
+		invalid  bool
+	}{
+		{"plain", "valid \xef\xbf\xbd line", "valid � line", false},
+		{"utf-8", "valid \xef\xbf\xbd line", "valid � line", false},
+		{"utf-8", "bad \xff line", "bad � line", true},
+		{"windows-1252", "bad \x81 line", "bad � line", true},
+		{"gbk", "bad \x81\xff line", "bad �� line", true},
+		{"utf-16le", "\xfd\xff", "�", false},
+	}
+
+	for i, test := range tests {
+		factory, ok := encoding.FindEncoding(test.encoding)
+		assert.True(t, ok, "test %d", i)
+		codec, err := factory(nil)
+		assert.Nil(t, err, "test %d", i)
+
+		decoder := newInvalidDetector(codec)
+		decoded, _, err := transform.Bytes(decoder, []byte(test.input))
+		assert.Nil(t, err, "test %d", i)
+		assert.Equal(t, test.expected, string(decoded), "test %d", i)
+		assert.Equal(t, test.invalid, decoder.invalid, "test %d", i)
+	}
+}
+
+func TestHarvestEncodingErrorsSkip(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-encoding-errors")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	content := "line 1\nbad \xff line\nline 3 \xef\xbf\xbd\n"
+	file.WriteString(content)
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{},
+		&config.HarvesterConfig{
+			BufferSize:     1024,
+			Encoding:       "utf-8",
+			EncodingErrors: config.EncodingErrorsSkip,
+			CloseEOF:       true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+
+	assert.Equal(t, 2, len(spooler))
+	assert.Equal(t, "line 1", *(<-spooler).Text)
+	assert.Equal(t, "line 3 �", *(<-spooler).Text)
+	assert.Equal(t, int64(len(content)), h.Offset)
+}
+
+func TestHarvestEncodingErrorsStrict(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-encoding-errors")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nbad \xff line\nline 3\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{},
+		&config.HarvesterConfig{
+			BufferSize:     1024,
+			Encoding:       "utf-8",
+			EncodingErrors: config.EncodingErrorsStrict,
+			PublishErrors:  true,
+			CloseEOF:       true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	var events []LifecycleEvent
+	h.Lifecycle = func(event LifecycleEvent) {
+		events = append(events, event)
+	}
+
+	h.Harvest()
+
+	assert.Equal(t, 2, len(spooler))
+	assert.Equal(t, "line 1", *(<-spooler).Text)
+	assert.Equal(t, errInvalidEncoding.Error(), (<-spooler).Error)
+	assert.Equal(t, int64(7), h.Offset)
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, LifecycleStopped, events[1].Type)
+	assert.Equal(t, StopReasonError, events[1].Reason)
+	assert.Equal(t, int64(7), events[1].Offset)
+}
@@ -0,0 +1,121 @@
+package harvester
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/libbeat/common"
+	"github.com/elastic/libbeat/logp"
+)
+
+const (
+	jsonErrorKey    = "json_error"
+	convertErrorKey = "convert_error"
+)
+
+// decodeJSON decodes text as JSON object. If json.message_key is configured,
+// the value of the key is returned as the new text of the event. On failure,
+// the original text is returned and, if json.add_error_key is set, the error
+// is reported in the json_error field.
+func (h *Harvester) decodeJSON(text string) (string, common.MapStr) {
+	var fields common.MapStr
+	err := json.Unmarshal([]byte(text), &fields)
+	if err == nil && fields == nil {
+		err = fmt.Errorf("not a JSON object")
+	}
+	if err != nil {
+		logp.Debug("harvester", "Error decoding JSON line of %s: %v", h.Path, err)
+		return text, h.jsonError(nil, fmt.Sprintf("Error decoding JSON: %v", err))
+	}
+
+	// The returned message is redacted by the line processors like all lines.
+	// The decoded values are redacted here, before converting them.
+	key := h.Config.JSON.MessageKey
+	message, ok := fields[key].(string)
+	h.redactJSON(fields)
+	h.convertJSON(fields)
+
+	if key == "" {
+		return text, fields
+	}
+	if !ok {
+		return text, h.jsonError(fields, fmt.Sprintf("Key '%s' not found or not a string", key))
+	}
+	return message, fields
+}
+
+// jsonError adds the error message to fields if json.add_error_key is set
+func (h *Harvester) jsonError(fields common.MapStr, message string) common.MapStr {
+	if !h.Config.JSON.AddErrorKey {
+		return fields
+	}
+
+	if fields == nil {
+		fields = common.MapStr{}
+	}
+	fields[jsonErrorKey] = message
+	return fields
+}
+
+// convertJSON coerces the decoded fields configured in json.convert to their
+// target type. Fields failing conversion keep their original value. If
+// json.add_convert_error_key is set, the failures are reported in the
+// convert_error field.
+func (h *Harvester) convertJSON(fields common.MapStr) {
+	var errs []string
+	for field, typ := range h.Config.JSON.Convert {
+		value, found := fields[field]
+		if !found || value == nil {
+			continue
+		}
+
+		converted, err := convertValue(value, typ)
+		if err != nil {
+			logp.Debug("harvester", "Error converting JSON field '%s' of %s: %v", field, h.Path, err)
+			errs = append(errs, fmt.Sprintf("field '%s': %v", field, err))
+			continue
+		}
+		fields[field] = converted
+	}
+
+	if len(errs) > 0 && h.Config.JSON.AddConvertErrorKey {
+		sort.Strings(errs)
+		fields[convertErrorKey] = strings.Join(errs, "; ")
+	}
+}
+
+// convertValue converts a decoded JSON value (string, number or bool) to int64,
+// float64 or bool.
+func convertValue(value interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case config.ConvertInt:
+		switch v := value.(type) {
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	case config.ConvertFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		}
+	case config.ConvertBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		}
+	}
+	return nil, fmt.Errorf("can not convert %T to %s", value, typ)
+}
@@ -0,0 +1,127 @@
+package harvester
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	h := &Harvester{
+		Config: &config.HarvesterConfig{
+			JSON: &config.JSONConfig{MessageKey: "msg"},
+		},
+	}
+
+	text, fields := h.decodeJSON(`{"msg": "hello", "level": "info", "count": 3}`)
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, "info", fields["level"])
+	assert.Equal(t, float64(3), fields["count"])
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	h := &Harvester{
+		Config: &config.HarvesterConfig{
+			JSON: &config.JSONConfig{MessageKey: "msg", AddErrorKey: true},
+		},
+	}
+
+	// invalid JSON keeps the raw text
+	text, fields := h.decodeJSON(`not json`)
+	assert.Equal(t, "not json", text)
+	assert.NotNil(t, fields[jsonErrorKey])
+
+	text, fields = h.decodeJSON(`null`)
+	assert.Equal(t, "null", text)
+	assert.NotNil(t, fields[jsonErrorKey])
+
+	// missing message key
+	text, fields = h.decodeJSON(`{"level": "info"}`)
+	assert.Equal(t, `{"level": "info"}`, text)
+	assert.Equal(t, "info", fields["level"])
+	assert.NotNil(t, fields[jsonErrorKey])
+
+	// no error key if not configured
+	h.Config.JSON.AddErrorKey = false
+	_, fields = h.decodeJSON(`not json`)
+	assert.Nil(t, fields)
+}
+
+func TestDecodeJSONConvert(t *testing.T) {
+	h := &Harvester{
+		Config: &config.HarvesterConfig{
+			JSON: &config.JSONConfig{
+				Convert: map[string]string{
+					"status":   "int",
+					"duration": "float",
+					"cached":   "bool",
+					"bytes":    "int",
+					"missing":  "int",
+				},
+				AddConvertErrorKey: true,
+			},
+		},
+	}
+
+	_, fields := h.decodeJSON(`{"status": "200", "duration": "0.25", "cached": "true", "bytes": 512}`)
+	assert.Equal(t, int64(200), fields["status"])
+	assert.Equal(t, 0.25, fields["duration"])
+	assert.Equal(t, true, fields["cached"])
+	assert.Equal(t, int64(512), fields["bytes"])
+	assert.Nil(t, fields[convertErrorKey])
+
+	// failed conversions keep the original value
+	_, fields = h.decodeJSON(`{"status": "OK", "bytes": 1.5}`)
+	assert.Equal(t, "OK", fields["status"])
+	assert.Equal(t, 1.5, fields["bytes"])
+	assert.NotNil(t, fields[convertErrorKey])
+
+	h.Config.JSON.AddConvertErrorKey = false
+	_, fields = h.decodeJSON(`{"status": "OK"}`)
+	assert.Equal(t, "OK", fields["status"])
+	assert.Nil(t, fields[convertErrorKey])
+}
+
+func TestHarvestJSONRedact(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-json-redact")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString(`{"msg": "login secret1", "user": {"token": "secret2"}, "tags": ["secret3"], "pin": "secret4"}` + "\n")
+
+	for _, keysUnderRoot := range []bool{false, true} {
+		spooler := make(chan *input.FileEvent, 1)
+		h, err := NewHarvester(
+			config.ProspectorConfig{},
+			&config.HarvesterConfig{
+				BufferSize: 1024,
+				CloseEOF:   true,
+				JSON: &config.JSONConfig{
+					MessageKey:    "msg",
+					KeysUnderRoot: keysUnderRoot,
+					Convert:       map[string]string{"pin": "int"},
+				},
+				Redact: []config.RedactConfig{{Pattern: `secret(\d)`, Replacement: "${1}"}},
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+
+		assert.Equal(t, 1, len(spooler))
+		event := <-spooler
+		assert.Equal(t, "login 1", *event.Text)
+
+		output := fmt.Sprintf("%v", event.ToMapStr())
+		assert.False(t, strings.Contains(output, "secret"), "secret found in %s", output)
+	}
+}
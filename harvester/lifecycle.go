@@ -0,0 +1,96 @@
+package harvester
+
+import (
+	"io"
+	"time"
+)
+
+// Lifecycle event types
+const (
+	LifecycleStarted   = "started"
+	LifecycleTruncated = "truncated" // reading restarted at the beginning of the file
+	LifecycleStopped   = "stopped"
+)
+
+// Reasons for the position a harvester starts reading at
+const (
+	StartReasonResume          = "resume"             // offset saved by a previous harvester or in the registry
+	StartReasonReset           = "reset"              // saved offset beyond the end of the file, read from the beginning
+	StartReasonBeginning       = "beginning"          // new file read from the beginning
+	StartReasonTail            = "tail"               // new file read from the end or the last lines with tail_files or tail_lines
+	StartReasonStartOffset     = "start_offset"       // new file read from start_offset
+	StartReasonMaxFileSizeTail = "max_file_size_tail" // last bytes of a file exceeding max_file_size
+)
+
+// Reasons for a harvester to stop
+const (
+	StopReasonEOF          = "eof"           // end of file with close_eof or of a non growing source
+	StopReasonCloseOlder   = "close_older"   // file inactive
+	StopReasonCloseTimeout = "close_timeout" // harvester running for longer than close_timeout
+	StopReasonEmptyFile    = "empty_file"    // file empty for longer than empty_file_timeout
+	StopReasonIgnoreOlder  = "ignore_older"  // file not modified for longer than ignore_older
+	StopReasonReplaced     = "replaced"      // path points to another file, e.g. after rotation
+	StopReasonForceClose   = "force_close"   // file removed with force_close_files
+	StopReasonShrunk       = "shrunk"        // file shrunk below the offset with shrink_policy stop
+	StopReasonStopped      = "stopped"       // harvester stopped on shutdown
+	StopReasonError        = "error"
+	StopReasonDevice       = "device_changed" // path on another device than the file, e.g. after remount
+	StopReasonFutureFile   = "future_file"    // file modified in the future with skip_future_files
+)
+
+// LifecycleEvent reports the start and stop of harvesting a file. Unlike log
+// messages, lifecycle events are structured to be consumed by monitoring.
+type LifecycleEvent struct {
+	Type   string
+	Path   string
+	Offset int64  // offset the harvester started at, reached or continues from
+	Reason string // StartReason* for LifecycleStarted, StopReason* for LifecycleStopped events
+	Time   time.Time
+}
+
+// stopError is returned by handleReadlineError if the harvester stops for a
+// reason reported in lifecycle events.
+type stopError struct {
+	reason string
+	msg    string
+}
+
+func (e *stopError) Error() string { return e.msg }
+
+// notifyLifecycle calls the Lifecycle callback, if set.
+func (h *Harvester) notifyLifecycle(eventType string, reason string) {
+	if h.Lifecycle == nil {
+		return
+	}
+
+	h.Lifecycle(LifecycleEvent{
+		Type:   eventType,
+		Path:   h.Path,
+		Offset: h.Offset,
+		Reason: reason,
+		Time:   time.Now(),
+	})
+}
+
+// stopReason returns the reason for the harvester stopping with err. err is
+// nil if the harvester returned without a read error.
+func (h *Harvester) stopReason(err error) string {
+	switch err {
+	case io.EOF:
+		return StopReasonEOF
+	case errInactive:
+		return StopReasonCloseOlder
+	case errEmpty:
+		return StopReasonEmptyFile
+	case errStopped:
+		return StopReasonStopped
+	}
+
+	if e, ok := err.(*stopError); ok {
+		return e.reason
+	}
+	if h.stopped() {
+		return StopReasonStopped
+	}
+	return StopReasonError
+}
@@ -0,0 +1,106 @@
+package harvester
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvestLifecycle(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-lifecycle")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{},
+		&config.HarvesterConfig{
+			BufferSize: 1024,
+			CloseEOF:   true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	var events []LifecycleEvent
+	h.Lifecycle = func(event LifecycleEvent) {
+		events = append(events, event)
+	}
+
+	h.Harvest()
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, LifecycleStarted, events[0].Type)
+	assert.Equal(t, file.Name(), events[0].Path)
+	assert.Equal(t, int64(0), events[0].Offset)
+
+	assert.Equal(t, LifecycleStopped, events[1].Type)
+	assert.Equal(t, StopReasonEOF, events[1].Reason)
+	assert.Equal(t, int64(14), events[1].Offset)
+}
+
+func TestStopReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{io.EOF, StopReasonEOF},
+		{errInactive, StopReasonCloseOlder},
+		{errEmpty, StopReasonEmptyFile},
+		{errStopped, StopReasonStopped},
+		{&stopError{StopReasonIgnoreOlder, "ignore older"}, StopReasonIgnoreOlder},
+		{&stopError{StopReasonReplaced, "replaced"}, StopReasonReplaced},
+		{&stopError{StopReasonShrunk, "shrunk"}, StopReasonShrunk},
+		{errors.New("read error"), StopReasonError},
+		{nil, StopReasonError},
+	}
+
+	h := &Harvester{done: make(chan struct{})}
+	for _, test := range tests {
+		assert.Equal(t, test.reason, h.stopReason(test.err))
+	}
+
+	// returning without error after Stop
+	h.Stop()
+	assert.Equal(t, StopReasonStopped, h.stopReason(nil))
+}
+
+func TestTruncatedLifecycle(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-lifecycle-truncated")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("new\n")
+
+	var events []LifecycleEvent
+	h := &Harvester{
+		Path:   file.Name(),
+		Config: &config.HarvesterConfig{},
+		Offset: 14,
+		file:   fileSource{file},
+		Lifecycle: func(event LifecycleEvent) {
+			events = append(events, event)
+		},
+	}
+
+	truncated, err := h.checkTruncated()
+	assert.Nil(t, err)
+	assert.True(t, truncated)
+
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, LifecycleTruncated, events[0].Type)
+	assert.Equal(t, int64(0), events[0].Offset)
+}
@@ -1,10 +1,13 @@
 package harvester
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 
 	"golang.org/x/text/transform"
@@ -12,16 +15,38 @@ import (
 	"github.com/elastic/filebeat/config"
 	"github.com/elastic/filebeat/harvester/encoding"
 	"github.com/elastic/filebeat/input"
+	"github.com/elastic/libbeat/common"
+	"github.com/elastic/libbeat/common/streambuf"
 	"github.com/elastic/libbeat/logp"
 )
 
+var (
+	errStopped     = errors.New("harvester stopped")
+	errInactive    = errors.New("file inactive")
+	errEmpty       = errors.New("file empty")
+	errNotSeekable = errors.New("source is not seekable")
+	errTooLarge    = errors.New("file exceeds max_file_size")
+	errFutureFile  = errors.New("file modified in the future")
+)
+
+// Number of lines read between checks for the file being truncated while
+// reading. Truncation is always checked on EOF.
+const truncationCheckLines = 1000
+
 func NewHarvester(
 	prospectorCfg config.ProspectorConfig,
 	cfg *config.HarvesterConfig,
 	path string,
 	stat *FileStat,
 	spooler chan *input.FileEvent,
+	tee ...chan *input.FileEvent,
 ) (*Harvester, error) {
+	// cheap for configs validated by the prospector, as patterns are compiled
+	// already
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	encoding, ok := encoding.FindEncoding(cfg.Encoding)
 	if !ok || encoding == nil {
 		return nil, fmt.Errorf("unknown encoding('%v')", cfg.Encoding)
@@ -29,33 +54,128 @@ func NewHarvester(
 
 	h := &Harvester{
 		Path:             path,
+		Source:           path,
 		ProspectorConfig: prospectorCfg,
 		Config:           cfg,
 		Stat:             stat,
 		SpoolerChan:      spooler,
+		TeeChans:         tee,
 		encoding:         encoding,
+		TailFiles:        cfg.TailFiles || cfg.TailLines > 0,
 		backoff:          prospectorCfg.Harvester.BackoffDuration,
+		done:             make(chan struct{}),
+		pause:            &pauseGate{},
+		fields:           cfg.Fields,
+	}
+
+	if cfg.NormalizeSource {
+		h.Source = NormalizeSource(path)
+	}
+	h.stats.setPath(path)
+
+	var err error
+	if cfg.AddFileFields && !IsStreamPath(path) && !IsSocketPath(path) && !IsSFTPPath(path) {
+		h.fields, err = addFileFields(cfg.Fields, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h.fieldTemplates = templateFields(h.fields)
+
+	h.Processors, err = NewProcessors(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Timestamp != nil {
+		h.timestamp, err = newTimestampParser(cfg.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Extract != nil {
+		h.extractor, err = newFieldExtractor(cfg.Extract)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.MaxEventsPerSecond > 0 {
+		h.limiter = newRateLimiter(cfg.MaxEventsPerSecond)
+	}
+
+	if cfg.DedupWindowDuration > 0 {
+		h.dedup = newDedup(cfg.DedupWindowDuration, cfg.DedupMaxLines)
+	}
+
+	if cfg.AdaptiveBackoff {
+		h.adaptiveBackoff = newAdaptiveBackoff(cfg.BackoffDuration, cfg.MaxBackoffDuration)
+	}
+
+	if cfg.Multiline != nil {
+		ml, err := newMultiline(cfg.Multiline)
+		if err != nil {
+			return nil, err
+		}
+		h.multiline = ml
+	}
+
+	// batches are buffered like multiline events, joining a fixed number of lines
+	if cfg.BatchLines > 0 {
+		h.multiline = newBatch(cfg.BatchLines, cfg.BatchTimeoutDuration)
 	}
+
 	return h, nil
 }
 
 // Log harvester reads files line by line and sends events to the defined output
 func (h *Harvester) Harvest() {
 
-	encoding, err := h.open()
-	if err != nil {
-		logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+	// Header lines are only skipped if the file is read from the beginning.
+	// On resume, the offset already points behind the header.
+	if h.Offset == 0 && !h.TailFiles && h.Config.StartOffset == 0 {
+		h.headerLines = h.Config.SkipHeaderLines
 	}
 
+	h.Metrics.harvesterStarted()
+
+	encoding, err := h.open()
+
+	// error the harvester stopped with, reported in the lifecycle event
+	var stopErr error
+	started := false
+
 	defer func() {
+		h.Metrics.harvesterStopped()
+
+		if started {
+			h.notifyLifecycle(LifecycleStopped, h.stopReason(stopErr))
+		}
+
 		// On completion, push offset so we can continue where we left off if we relaunch on the same file
-		h.Stat.Return <- h.Offset
+		if h.Stat != nil {
+			h.Stat.Return <- h.Offset
+		}
 		// Make sure file is closed as soon as harvester exits
-		h.file.Close()
+		if h.file != nil {
+			h.file.Close()
+		}
 	}()
 
+	if err == errStopped {
+		logp.Info("Harvester for file %s stopped while opening", h.Path)
+		return
+	}
+	if err == errTooLarge || err == errFutureFile {
+		// warnings are logged by checkFileSize and modifiedInFuture
+		h.publishError(err)
+		return
+	}
 	if err != nil {
 		logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+		h.publishError(err)
 		return
 	}
 
@@ -65,15 +185,86 @@ func (h *Harvester) Harvest() {
 		return
 	}
 
+	// Identity of the opened file, independent of its path. Remote files
+	// have no local identity.
+	if _, ok := h.file.(*sftpSource); !ok {
+		h.fileStateOS = input.GetOSFileState(&info)
+	}
+
+	if h.Config.FingerprintSize > 0 && info.Mode().IsRegular() {
+		h.fingerprint, err = h.readFingerprint()
+		if err != nil {
+			logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+			return
+		}
+	}
+
 	logp.Info("Harvester started for file: %s", h.Path)
+	started = true
+	if h.startReason == "" {
+		// sources without file offset handling, e.g. pipes or compressed files
+		h.startReason = StartReasonBeginning
+		if h.Offset > 0 {
+			h.startReason = StartReasonResume
+		}
+	}
+	h.notifyLifecycle(LifecycleStarted, h.startReason)
+
+	if h.Config.InputType == config.FileInputType {
+		stopErr = h.harvestFile(encoding, info)
+		if stopErr == nil {
+			stopErr = io.EOF
+		}
+		return
+	}
+
+	if h.Config.InputType == config.FramedInputType {
+		stopErr = h.harvestFramed(info)
+		return
+	}
 
 	// TODO: newLineReader uses additional buffering to deal with encoding and testing
 	//       for new lines in input stream. Simple 8-bit based encodings, or plain
 	//       don't require 'complicated' logic.
-	timedIn := newTimedReader(h.file)
-	reader, err := newLineReader(timedIn, encoding, h.Config.BufferSize)
-	if err != nil {
+	var timedIn *timedReader
+	var reader *lineReader
+	var readOffset int64 // offset of the next line read, for raw_bytes
+	newReader := func() error {
+		if reader != nil {
+			reader.release()
+		}
+
+		var err error
+		var in io.Reader = h.file
+		if h.Config.ReadDeadlineDuration > 0 && isRegular(h.file) {
+			in = newDeadlineReader(h.file, h.Config.ReadDeadlineDuration)
+		}
+		timedIn = newTimedReader(in)
+		reader, err = newLineReader(timedIn, encoding, h.Config.BufferSize, h.Config.MaxBytes, h.Config.LineDelimiter)
+		if err == nil && h.Config.CRLineEndings {
+			err = reader.enableCR()
+		}
+		if err == nil && h.Config.MaxPartialBytes > 0 {
+			reader.limitPartial(h.Config.MaxPartialBytes)
+		}
+		if err == nil && h.Config.RawBytes != "" {
+			reader.enableRaw()
+			readOffset = h.Offset
+			h.rawLines = nil
+		}
+		return err
+	}
+
+	// line buffers are reused by the readers of other harvesters
+	defer func() {
+		if reader != nil {
+			reader.release()
+		}
+	}()
+
+	if err := newReader(); err != nil {
 		logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+		stopErr = err
 		return
 	}
 
@@ -85,16 +276,178 @@ func (h *Harvester) Harvest() {
 	// no new bytes have been processed
 	lastPartialLen := 0
 
+	// incomplete lines only time out with partial_line_policy emit or discard
+	partialLineWaiting := time.Duration(-1)
+	if h.partialLineTimeout() {
+		partialLineWaiting = h.Config.PartialLineWaitingDuration
+	}
+
+	// lines read since last check for file truncation
+	linesSinceCheck := 0
+
+	// consecutive read errors retried
+	readErrors := 0
+
+	// harvesting stops at closeDeadline, if close_timeout is set
+	var closeDeadline time.Time
+	if h.Config.CloseTimeoutDuration > 0 {
+		closeDeadline = time.Now().Add(h.Config.CloseTimeoutDuration)
+	}
+
+	// the device of the path is checked at nextDeviceCheck, if
+	// device_check_interval is set. Only files have a path to check.
+	var nextDeviceCheck time.Time
+	if h.Config.DeviceCheckDuration > 0 && info.Mode().IsRegular() && !h.ProspectorConfig.Concat {
+		nextDeviceCheck = time.Now().Add(h.Config.DeviceCheckDuration)
+	}
+
 	for {
-		text, bytesRead, isPartial, err := readLine(reader, &timedIn.lastReadTime, h.Config.PartialLineWaitingDuration)
+		h.stats.update(h.Offset, h.backoff)
+
+		// Stop regardless of activity. Buffered lines were read completely and
+		// are published, so the harvester started next continues behind them.
+		// Incomplete lines are read again.
+		if !closeDeadline.IsZero() && time.Now().After(closeDeadline) {
+			logp.Info("Closing file after close_timeout (%v): %s", h.Config.CloseTimeoutDuration, h.Path)
+			stopErr = &stopError{StopReasonCloseTimeout, fmt.Sprintf("Stop harvesting after close_timeout: %s", h.Path)}
+			h.flushPending(lastReadTime, &info)
+			return
+		}
+
+		// Stop if the file system was mounted again, so the prospector starts
+		// a harvester for the file now found at the path.
+		if !nextDeviceCheck.IsZero() && time.Now().After(nextDeviceCheck) {
+			nextDeviceCheck = time.Now().Add(h.Config.DeviceCheckDuration)
+			if h.deviceChanged() {
+				logp.Info("Device of file changed, e.g. after remount: %s", h.Path)
+				stopErr = &stopError{StopReasonDevice, fmt.Sprintf("Stop harvesting as device changed: %s", h.Path)}
+				h.flushPending(lastReadTime, &info)
+				return
+			}
+		}
+
+		if h.stopped() || !h.waitResumed() {
+			logp.Info("Harvester for file %s stopped", h.Path)
+			return
+		}
+
+		var readStart time.Time
+		if h.Config.AddReadLatency {
+			readStart = time.Now()
+		}
+
+		text, bytesRead, isPartial, err := readLine(reader, &timedIn.lastReadTime, partialLineWaiting, h.Config.PartialLinePollDuration, h.done)
+
+		if h.Config.AddReadLatency {
+			h.readLatency = time.Since(readStart)
+		}
+
+		// No line feed followed the carriage return at the end of the input
+		// within partial_line_waiting, so the carriage return ends the line
+		if err == io.EOF && reader.cr != nil && time.Since(timedIn.lastReadTime) >= h.Config.PartialLineWaitingDuration {
+			if line, sz, _ := reader.nextFinal(); sz != 0 {
+				text, bytesRead, isPartial, err = readlineString(line, sz, false, reader)
+			}
+		}
+
+		// The end of the input is reached before partial_line_waiting
+		// expires while the line is incomplete. Incomplete lines already
+		// published are not checked again, so reading backs off.
+		if err == io.EOF && h.partialLineTimeout() && time.Since(timedIn.lastReadTime) >= partialLineWaiting {
+			if line, sz, _ := reader.partial(); sz > lastPartialLen {
+				text, bytesRead, isPartial, err = readlineString(line, sz, true, reader)
+			}
+		}
 
 		if err != nil {
 
+			// Lines buffered by multiline are dropped. The offset only covers
+			// published events, so the incomplete event is read again on restart.
+			if err == errStopped {
+				logp.Info("Harvester for file %s stopped", h.Path)
+				stopErr = err
+				return
+			}
+
+			// A hung read can not be aborted, so reading is not retried
+			if err == errReadTimeout {
+				logp.Err("Stop Harvesting. Reading %s did not return within %v", h.Path, h.Config.ReadDeadlineDuration)
+				stopErr = err
+				h.publishError(err)
+				return
+			}
+
+			// Retry transient read errors, e.g. on network file systems. Reading
+			// continues at the offset of the last complete line, dropping all
+			// buffered input.
+			if err != io.EOF && readErrors < h.Config.ReadErrorRetries {
+				readErrors++
+				logp.Warn("Error reading from %s. Retry %d of %d. Error: %s", h.Path, readErrors, h.Config.ReadErrorRetries, err)
+
+				h.backOff()
+				if err := h.retrySeekOffset(); err != nil {
+					logp.Err("Stop Harvesting. Can not retry reading %s: %s", h.Path, err)
+					stopErr = err
+					// lines of the pending multiline event were read completely
+					h.flushPending(lastReadTime, &info)
+					return
+				}
+
+				if h.multiline != nil {
+					h.multiline.flush()
+				}
+				if h.dedup != nil {
+					h.dedup.flush()
+				}
+				lastPartialLen = 0
+				if err := newReader(); err != nil {
+					logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+					stopErr = err
+					return
+				}
+				continue
+			}
+
+			// Publish buffered multiline event if no new line has been added
+			// for multiline.timeout
+			if h.multiline != nil && h.multiline.timedOut() {
+				h.flushMultiline(lastReadTime, &info)
+			}
+
+			// Publish repeated lines once dedup_window has passed
+			if h.dedup != nil && h.dedup.timedOut() {
+				h.flushDedup(lastReadTime, &info)
+			}
+
+			// NUL bytes at the end of the file are not written yet. Read them
+			// again after backing off.
+			if err == io.EOF && h.Config.SkipNullPadding && reader.pendingNullPadding() {
+				if seeker, ok := h.file.(io.Seeker); ok {
+					n := reader.dropPending()
+					logp.Debug("harvester", "Skipping %d bytes ending with NUL padding at end of file: %s", n, h.Path)
+					seeker.Seek(-int64(n), os.SEEK_CUR)
+				}
+			}
+
 			// In case of err = io.EOF returns nil
 			err = h.handleReadlineError(lastReadTime, err)
 
 			if err != nil {
-				logp.Err("File reading error. Stopping harvester. Error: %s", err)
+				stopErr = err
+				if err == io.EOF {
+					logp.Info("End of file reached: %s. Stopping harvester.", h.Path)
+				} else if err == errInactive || err == errEmpty {
+					logp.Info("Closing file: %s", h.Path)
+				} else {
+					logp.Err("File reading error. Stopping harvester. Error: %s", err)
+					if h.stopReason(err) == StopReasonError {
+						h.publishError(err)
+					}
+				}
+				h.flushPending(lastReadTime, &info)
+				if h.Config.FlushPartialOnClose && (err == io.EOF || err == errInactive) {
+					h.flushPartial(reader, lastReadTime, &info)
+				}
 				return
 			}
 
@@ -102,9 +455,88 @@ func (h *Harvester) Harvest() {
 		}
 
 		lastReadTime = time.Now()
+		readErrors = 0
+
+		// Incomplete lines exceeding max_partial_bytes are published, as slowly
+		// arriving bytes keep partial_line_waiting from expiring. The bytes are
+		// dropped from the reader, so the offset advances past them and the rest
+		// of the line is published separately.
+		unterminated := false
+		if isPartial && h.Config.MaxPartialBytes > 0 && bytesRead >= h.Config.MaxPartialBytes {
+			logp.Debug("harvester", "Incomplete line of %d bytes exceeds max_partial_bytes (%d) and is published: %s", bytesRead, h.Config.MaxPartialBytes, h.Path)
+			if h.Config.RawBytes != "" {
+				h.partialRaw = reader.rawPartial()
+				readOffset += int64(bytesRead)
+			}
+			reader.dropPartial()
+			isPartial, unterminated = false, true
+		}
+
+		// With partial_line_policy discard, lines not completed in time are
+		// dropped. The offset advances past them, so the rest of the line is
+		// read as a line of its own.
+		if isPartial && h.Config.PartialLinePolicy == config.PartialLinePolicyDiscard {
+			logp.Warn("Discarding incomplete line of %d bytes not completed within partial_line_waiting: %s", bytesRead, h.Path)
+			if h.Config.RawBytes != "" {
+				readOffset += int64(bytesRead)
+			}
+			reader.dropPartial()
+			h.Offset += int64(bytesRead)
+			h.stats.partialDiscarded()
+			lastPartialLen = 0
+			continue
+		}
+
+		// Check for the file being truncated and rewritten while reading. Lines
+		// read from the buffer might span old and new content and are dropped.
+		linesSinceCheck++
+		if h.file.Continuable() && linesSinceCheck >= truncationCheckLines {
+			linesSinceCheck = 0
+
+			truncated, err := h.checkTruncated()
+			if err != nil {
+				logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+				stopErr = err
+				return
+			}
+			if truncated {
+				// discard buffered lines and continue reading at the new offset
+				if h.multiline != nil {
+					h.multiline.flush()
+				}
+				if h.dedup != nil {
+					h.dedup.flush()
+				}
+				lastPartialLen = 0
+				if err := newReader(); err != nil {
+					logp.Err("Stop Harvesting. Unexpected Error: %s", err)
+					stopErr = err
+					return
+				}
+				continue
+			}
+		}
+
+		if h.Config.RawBytes != "" && !unterminated {
+			if isPartial {
+				h.partialRaw = reader.rawPartial()
+			} else {
+				h.queueRaw(readOffset, reader.rawLine())
+				readOffset += int64(bytesRead)
+			}
+		}
+
+		if h.Config.MaxBytes > 0 && bytesRead > h.Config.MaxBytes {
+			logp.Debug("harvester", "Line of %d bytes exceeds max_bytes (%d) and was truncated: %s", bytesRead, h.Config.MaxBytes, h.Path)
+		}
 
 		// Reset Backoff
-		h.backoff = h.Config.BackoffDuration
+		h.resetBackoff()
+
+		if !isPartial {
+			h.stats.lineRead(bytesRead, lastReadTime)
+			h.Metrics.lineRead(bytesRead)
+		}
 
 		if isPartial {
 			if bytesRead <= lastPartialLen {
@@ -118,49 +550,466 @@ func (h *Harvester) Harvest() {
 			lastPartialLen = 0
 		}
 
-		// Sends text to spooler
-		event := &input.FileEvent{
-			ReadTime:     lastReadTime,
-			Source:       &h.Path,
-			InputType:    h.Config.InputType,
-			DocumentType: h.Config.DocumentType,
-			Offset:       h.Offset,
-			Bytes:        bytesRead,
-			Text:         &text,
-			Fields:       &h.Config.Fields,
-			Fileinfo:     &info,
-			IsPartial:    isPartial,
+		if h.headerLines > 0 {
+			// drop header line, partial header lines are not published either
+			if !isPartial {
+				h.headerLines--
+				h.Offset += int64(bytesRead)
+			}
+			continue
+		}
+
+		// drop oversized lines entirely instead of truncating them to max_bytes.
+		// Finish pending events first, as offset is advanced
+		if !isPartial && !unterminated && h.Config.DropLinesOver > 0 && bytesRead > h.Config.DropLinesOver {
+			logp.Debug("harvester", "Dropping line of %d bytes exceeding drop_lines_over (%d) at offset %d: %s", bytesRead, h.Config.DropLinesOver, h.Offset, h.Path)
+			h.flushPending(lastReadTime, &info)
+			h.Offset += int64(bytesRead)
+			continue
+		}
+
+		text = h.trimLine(text)
+
+		if !isPartial {
+			var ok bool
+			text, ok, err = h.checkEncoding(text, reader.invalidLine())
+			if err != nil {
+				logp.Err("Stop Harvesting. Invalid input for encoding '%s' in file %s at offset %d", h.Config.Encoding, h.Path, h.Offset)
+				stopErr = err
+				h.publishError(err)
+				return
+			}
+			if !ok || h.isEmptyLine(text) {
+				// drop line. Finish pending multiline event first, as offset is advanced
+				h.flushPending(lastReadTime, &info)
+				h.Offset += int64(bytesRead)
+				continue
+			}
+		}
+
+		if h.multiline != nil {
+			if isPartial || unterminated {
+				// partial lines are published as is. Finish current multiline event first.
+				h.flushMultiline(lastReadTime, &info)
+			} else {
+				var complete bool
+				text, bytesRead, complete = h.multiline.add(text, bytesRead)
+				if !complete {
+					continue
+				}
+			}
+		}
+
+		// The line ending is only known for events of single lines
+		if h.Config.AddLineEnding && h.multiline == nil {
+			h.lineEnding = lineEndingName(reader.ending)
 		}
+
+		if h.dedup != nil {
+			if isPartial || unterminated {
+				// partial lines are published as is. Finish pending event first.
+				h.flushDedup(lastReadTime, &info)
+			} else {
+				if !h.dedup.repeats(text) {
+					h.flushDedup(lastReadTime, &info)
+				}
+				h.dedup.add(text, bytesRead, h.lineEnding)
+				h.lineEnding = ""
+				continue
+			}
+		}
+
+		h.sendEvent(lastReadTime, text, bytesRead, isPartial, unterminated, &info)
+	}
+}
+
+// sendEvent sends text read from the current offset to the spooler, if not
+// dropped by the line processors. The offset is only updated if a
+// complete line has been processed. Unterminated marks the last line of a
+// closed file missing the line ending, which is handled as complete line.
+func (h *Harvester) sendEvent(readTime time.Time, text string, bytesRead int, isPartial bool, unterminated bool, info *os.FileInfo) {
+	lineEnding := h.lineEnding
+	h.lineEnding = ""
+	repeatCount := h.repeatCount
+	h.repeatCount = 0
+
+	var jsonFields common.MapStr
+	if h.Config.JSON != nil && !isPartial {
+		text, jsonFields = h.decodeJSON(text)
+	}
+
+	// Use the timestamp of the line as event time. Falls back to the read time
+	var timestampError string
+	if h.timestamp != nil && !isPartial {
+		ts, err := h.timestamp.parse(text)
+		if err == nil {
+			readTime = ts
+		} else {
+			logp.Debug("harvester", "Error parsing timestamp of line of %s: %v", h.Path, err)
+			if h.Config.Timestamp.AddErrorKey {
+				timestampError = fmt.Sprintf("Error parsing timestamp: %v", err)
+			}
+		}
+	}
+
+	text, ok := h.processLine(text)
+	if ok && h.sampledOut(h.Offset) {
+		ok = false
+	}
+	if !ok {
+		// drop line, but advance offset so the line is not read again
 		if !isPartial {
-			h.Offset += int64(bytesRead) // Update offset if complete line has been processed
+			h.Offset += int64(bytesRead)
+		}
+		return
+	}
+
+	// Extract fields from the processed line, so redacted parts are not
+	// extracted
+	var extractedFields common.MapStr
+	var extractError string
+	if h.extractor != nil && !isPartial {
+		var err error
+		extractedFields, err = h.extractor.extract(text)
+		if err != nil {
+			logp.Debug("harvester", "Error extracting fields of line of %s: %v", h.Path, err)
+			if h.Config.Extract.AddErrorKey {
+				extractError = fmt.Sprintf("Error extracting fields: %v", err)
+			}
+		}
+	}
+
+	// Wait for max_events_per_second. The offset is not updated if the
+	// harvester is stopped while waiting, so the line is sent again on restart.
+	if h.limiter != nil && !h.limiter.wait(h.done) {
+		return
+	}
+
+	// copied, as the source changes if a renamed file is followed
+	source := h.Source
+	event := &input.FileEvent{
+		ReadTime:     readTime,
+		Source:       &source,
+		InputType:    h.Config.InputType,
+		DocumentType: h.Config.DocumentType,
+		Offset:       h.Offset,
+		Bytes:        bytesRead,
+		Text:         &text,
+		Fields:       h.eventFields(h.Offset, text),
+		Fileinfo:     info,
+		FileStateOS:  h.fileStateOS,
+		IsPartial:    isPartial,
+		Unterminated: unterminated,
+		JSONFields:   jsonFields,
+
+		TimestampError:  timestampError,
+		ExtractedFields: extractedFields,
+		ExtractError:    extractError,
+	}
+
+	if h.Config.AddFileIdentity && h.fileStateOS != nil {
+		event.Inode, event.Device = h.fileStateOS.Identity()
+	}
+
+	if h.Config.AddReadLatency {
+		event.SetReadLatency(h.readLatency)
+	}
+
+	if h.Config.AddSequence {
+		h.sequence++
+		event.Sequence = h.sequence
+	}
+
+	if h.Config.AddLineEnding {
+		event.LineEnding = lineEnding
+	}
+
+	if h.Config.AddEventID {
+		event.EventID = h.eventID(h.Offset, text)
+	}
+
+	if h.Config.AddEndOffset {
+		event.EndOffset = h.Offset + int64(bytesRead)
+	}
+
+	if h.Config.AddEncoding {
+		event.Encoding = h.encodingName
+	}
+
+	if h.Config.AddStartReason {
+		event.StartReason = h.startReason
+	}
+
+	event.RepeatCount = repeatCount
+
+	if h.Config.SampleRate > 1 {
+		event.SampleRate = h.Config.SampleRate
+	}
+
+	if h.Config.RawBytes != "" {
+		if isPartial || unterminated {
+			event.RawBytes = h.partialRaw
+		} else {
+			event.RawBytes = h.takeRaw(h.Offset, bytesRead)
 		}
+		if h.Config.RawBytes == config.RawBytesReplace {
+			event.Text = nil
+		}
+	}
+
+	if h.Config.CompressTextOver > 0 && event.Text != nil && len(text) > h.Config.CompressTextOver {
+		compressed, err := compressText(text)
+		if err != nil {
+			logp.Err("Error compressing line of %s, sending it uncompressed: %v", h.Path, err)
+		} else {
+			event.Text = &compressed
+			event.TextEncoding = input.TextEncodingGzipBase64
+		}
+	}
+
+	event.SetFieldsUnderRoot(h.Config.FieldsUnderRoot)
+	if h.Config.JSON != nil {
+		event.SetJSONKeysUnderRoot(h.Config.JSON.KeysUnderRoot)
+	}
+	if h.extractor != nil {
+		event.SetExtractKeysUnderRoot(h.Config.Extract.KeysUnderRoot)
+	}
+
+	// ship the new event downstream
+	if !h.publish(event) {
+		return
+	}
+
+	if !isPartial {
+		h.Offset += int64(bytesRead) // Update offset if complete line has been processed
+	}
+	h.stats.eventSent()
+}
+
+// publishError sends an event reporting err, if publish_errors is set, so
+// failures to read a file can be alerted on. The error is published as message
+// and error field.
+func (h *Harvester) publishError(err error) {
+	if !h.Config.PublishErrors {
+		return
+	}
+
+	text := err.Error()
+	source := h.Source
+	event := &input.FileEvent{
+		ReadTime:     time.Now(),
+		Source:       &source,
+		InputType:    h.Config.InputType,
+		DocumentType: h.Config.DocumentType,
+		Offset:       h.Offset,
+		Text:         &text,
+		Fields:       h.eventFields(h.Offset, ""),
+		Error:        text,
+	}
+	event.SetFieldsUnderRoot(h.Config.FieldsUnderRoot)
+
+	h.publish(event)
+}
+
+// publish sends the event to the spooler and a copy to each secondary spooler.
+// With tee_policy drop, busy secondary spoolers miss the event. With
+// ordered_delivery, publish waits until the event was published. Returns false
+// if the harvester is stopped before the event is sent to the spooler.
+func (h *Harvester) publish(event *input.FileEvent) bool {
+	// Each event is sent to all spoolers before the next one, so every
+	// spooler receives the events in order. The secondary spoolers get a
+	// copy, so consumers can not affect each other through a shared event.
+	// Copies are taken before requesting the ack, which only the spooler
+	// gives.
+	teeEvents := make([]input.FileEvent, len(h.TeeChans))
+	for i := range h.TeeChans {
+		teeEvents[i] = *event
+	}
+
+	var acked <-chan struct{}
+	if h.Config.OrderedDelivery {
+		acked = event.RequestAck()
+	}
+
+	if !h.sendToSpooler(h.SpoolerChan, event) {
+		return false
+	}
+
+	for i, tee := range h.TeeChans {
+		if h.Config.TeePolicy == config.TeePolicyDrop {
+			select {
+			case tee <- &teeEvents[i]:
+			default:
+				h.stats.teeDropped()
+				logp.Debug("harvester", "Secondary spooler is busy, dropping event of %s", h.Path)
+			}
+			continue
+		}
+
+		// The offset follows the primary spooler, which already got the event
+		if !h.sendToSpooler(tee, &teeEvents[i]) {
+			break
+		}
+	}
+
+	if acked != nil {
+		// The event is in the spooler and is sent again on restart if not
+		// published, so the offset advances even if stopped while waiting.
+		select {
+		case <-acked:
+		case <-h.done:
+		}
+	}
+	return true
+}
+
+// sendToSpooler sends event to spooler. If the spooler does not accept the
+// event within spooler_send_timeout, a warning is logged and sending is
+// retried. Returns false if the harvester is stopped before the event is sent.
+func (h *Harvester) sendToSpooler(spooler chan *input.FileEvent, event *input.FileEvent) bool {
+	select {
+	case spooler <- event:
+		return true
+	default:
+	}
+
+	// spooler is busy, record the time blocked
+	start := time.Now()
+	defer func() {
+		h.Metrics.spoolerBlockedFor(time.Since(start))
+	}()
+
+	var timeout <-chan time.Time
+	for {
+		if h.Config.SpoolerSendTimeoutDuration > 0 {
+			timeout = time.After(h.Config.SpoolerSendTimeoutDuration)
+		}
+
+		select {
+		case spooler <- event:
+			return true
+		case <-h.done:
+			return false
+		case <-timeout:
+			logp.Warn("Harvester for file %s blocked sending event to spooler for more than %v",
+				h.Path, h.Config.SpoolerSendTimeoutDuration)
+		}
+	}
+}
+
+// flushPending sends the events buffered by multiline and dedup, e.g. before
+// the offset is advanced past a dropped line or the harvester stops
+func (h *Harvester) flushPending(readTime time.Time, info *os.FileInfo) {
+	if h.multiline != nil {
+		h.flushMultiline(readTime, info)
+	}
+	if h.dedup != nil {
+		h.flushDedup(readTime, info)
+	}
+}
+
+// flushMultiline sends the lines buffered by multiline as one event
+func (h *Harvester) flushMultiline(readTime time.Time, info *os.FileInfo) {
+	text, bytesRead, ok := h.multiline.flush()
+	if ok {
+		h.sendEvent(readTime, text, bytesRead, false, false, info)
+	}
+}
+
+// partialLineTimeout returns true if lines not completed within
+// partial_line_waiting are published or dropped, according to
+// partial_line_policy. Otherwise incomplete lines are kept until completed.
+func (h *Harvester) partialLineTimeout() bool {
+	policy := h.Config.PartialLinePolicy
+	return policy == config.PartialLinePolicyEmit || policy == config.PartialLinePolicyDiscard
+}
+
+// flushPartial sends the bytes of a line missing the line ending when the file
+// is closed. The event is marked as partial, but the offset is advanced past
+// the line, so it is not sent again.
+func (h *Harvester) flushPartial(reader *lineReader, readTime time.Time, info *os.FileInfo) {
+	line, sz, err := reader.partial()
+	if err != nil || sz == 0 {
+		return
+	}
+
+	text, _, _, _ := readlineString(line, sz, true, reader)
+	h.partialRaw = reader.rawPartial()
+	reader.dropPartial()
+	h.sendEvent(readTime, text, sz, false, true, info)
+}
+
+// backOff checks the backoff variable and sleeps for the given time
+// It also recalculate and sets the next backoff duration
+func (h *Harvester) backOff() {
+	if h.adaptiveBackoff != nil {
+		if backoff, ok := h.adaptiveBackoff.update(time.Now()); ok {
+			h.backoff = backoff
+		}
+	}
+
+	backoff := jitter(h.backoff, h.Config.BackoffJitter)
+	h.Metrics.backedOff(backoff)
+
+	// Wait before trying to read file which reached EOF again. Returns early
+	// if harvester is stopped.
+	select {
+	case <-h.done:
+		return
+	case <-time.After(backoff):
+	}
+
+	// Increment backoff up to maxBackoff
+	h.backoff = growBackoff(h.backoff, h.Config.BackoffFactor, h.Config.MaxBackoffDuration)
+}
 
-		event.SetFieldsUnderRoot(h.Config.FieldsUnderRoot)
-		h.SpoolerChan <- event // ship the new event downstream
+// resetBackoff is called after a line was read. The backoff is reset to its
+// minimum, or with adaptive_backoff updated on the next EOF.
+func (h *Harvester) resetBackoff() {
+	if h.adaptiveBackoff != nil {
+		h.adaptiveBackoff.lineRead()
+		return
 	}
+	h.backoff = h.Config.BackoffDuration
 }
 
-// backOff checks the backoff variable and sleeps for the given time
-// It also recalculate and sets the next backoff duration
-func (h *Harvester) backOff() {
-	// Wait before trying to read file which reached EOF again
-	time.Sleep(h.backoff)
-
-	// Increment backoff up to maxBackoff
-	if h.backoff < h.Config.MaxBackoffDuration {
-		h.backoff = h.backoff * time.Duration(h.Config.BackoffFactor)
-		if h.backoff > h.Config.MaxBackoffDuration {
-			h.backoff = h.Config.MaxBackoffDuration
-		}
+// jitter randomizes d within +-fraction of d, so harvesters with the same
+// backoff settings do not wake up in lockstep.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
 	}
+	return d + time.Duration((2*rand.Float64()-1)*fraction*float64(d))
 }
 
 // open does open the file given under h.Path and assigns the file handler to h.file
+// The name of the encoding used, e.g. detected from the BOM, is kept for events.
+// Frames are not decoded, so no encoding is reported for them.
 func (h *Harvester) open() (encoding.Encoding, error) {
+	enc, err := h.openSource()
+	if err == nil && h.Config.InputType != config.FramedInputType {
+		h.encodingName = encoding.Name(enc)
+	}
+	return enc, err
+}
+
+func (h *Harvester) openSource() (encoding.Encoding, error) {
 	// Special handling that "-" means to read from standard input
 	if h.Path == "-" {
 		return h.openStdin()
 	}
+	if IsFDPath(h.Path) {
+		return h.openFD()
+	}
+	if IsSocketPath(h.Path) {
+		return h.openSocket()
+	}
+	if IsSFTPPath(h.Path) {
+		return h.openSFTP()
+	}
+	if h.ProspectorConfig.Concat {
+		return h.openConcat()
+	}
 	return h.openFile()
 }
 
@@ -169,22 +1018,150 @@ func (h *Harvester) openStdin() (encoding.Encoding, error) {
 	return h.encoding(h.file)
 }
 
+// openRetriesExceeded checks if opening was retried max_open_retries times.
+// Negative values retry forever. Without max_open_retries set, opening is not
+// retried.
+func (h *Harvester) openRetriesExceeded(retries int) bool {
+	max := h.Config.MaxOpenRetries
+	return max == nil || (*max >= 0 && retries >= *max)
+}
+
+// openSocket connects to the Unix domain socket given by h.Path. Connecting
+// is retried up to max_open_retries times.
+func (h *Harvester) openSocket() (encoding.Encoding, error) {
+	for retries := 0; ; retries++ {
+		source, err := newSocketSource(h.Path)
+		if err == nil {
+			logp.Debug("harvester", "harvest: socket %q", h.Path)
+			h.Offset = 0
+			h.file = source
+			return h.encoding(source)
+		}
+
+		logp.Err("Failed connecting to %s: %s", h.Path, err)
+
+		if h.openRetriesExceeded(retries) {
+			return nil, fmt.Errorf("Giving up connecting to %s after %d retries: %v", h.Path, retries, err)
+		}
+
+		select {
+		case <-h.done:
+			return nil, errStopped
+		case <-time.After(h.Config.OpenRetryBackoffDuration):
+		}
+	}
+}
+
+// openConcat opens the files matching the glob pattern h.Path as one stream,
+// continuing at h.Offset. Opening is retried up to max_open_retries times
+// until a file matches.
+func (h *Harvester) openConcat() (encoding.Encoding, error) {
+	for retries := 0; ; retries++ {
+		source, err := newConcatSource(h.Path, h.ProspectorConfig.ExcludeFilesRegexp, h.ProspectorConfig.CaseInsensitive)
+		if err == nil {
+			var encoding encoding.Encoding
+			encoding, err = h.encoding(source)
+			if err == nil {
+				if h.Offset > 0 {
+					_, err = source.Seek(h.Offset, os.SEEK_SET)
+				} else {
+					h.Offset, err = source.Seek(0, os.SEEK_CUR)
+				}
+			}
+			if err != nil {
+				source.Close()
+				return nil, err
+			}
+
+			logp.Debug("harvester", "harvest: concatenated files %q position:%d", h.Path, h.Offset)
+			h.file = source
+			return encoding, nil
+		}
+
+		logp.Err("Failed opening %s: %s", h.Path, err)
+
+		if h.openRetriesExceeded(retries) {
+			return nil, fmt.Errorf("Giving up opening %s after %d retries: %v", h.Path, retries, err)
+		}
+
+		select {
+		case <-h.done:
+			return nil, errStopped
+		case <-time.After(h.Config.OpenRetryBackoffDuration):
+		}
+	}
+}
+
 func (h *Harvester) openFile() (encoding.Encoding, error) {
 	var file *os.File
 	var err error
 	var encoding encoding.Encoding
 
-	// TODO: This is currently end endless retry, should be set to a max?
-	// retry on failure.
-	for {
+	// The path might have been excluded after the prospector started the harvester
+	if input.MatchPath(h.ProspectorConfig.ExcludeFilesRegexp, h.Path) {
+		return nil, fmt.Errorf("Given file is excluded by exclude_files: %s", h.Path)
+	}
+
+	// Symlinks are followed on open, harvesting the target file. The state is
+	// tracked by the identity of the opened target, so replacing the link
+	// starts a new harvester.
+	if input.IsSymlink(h.Path) {
+		if h.Config.Symlinks != nil && !*h.Config.Symlinks {
+			return nil, fmt.Errorf("Given file is a symlink, but symlinks is disabled: %s", h.Path)
+		}
+
+		// Loops and long chains are not retried, as they do not resolve by
+		// waiting. Missing targets are retried below.
+		if _, err := input.ResolveSymlink(h.Path, h.maxSymlinkDepth()); err == input.ErrSymlinkTooDeep {
+			return nil, fmt.Errorf("Failed resolving symlink %s: %v (max_symlink_depth: %d)", h.Path, err, h.maxSymlinkDepth())
+		}
+	}
+
+	// retry on failure, up to max_open_retries times
+	for retries := 0; ; retries++ {
 		file, err = input.ReadOpen(h.Path)
 		if err == nil {
+			if h.Config.AllowNonRegularFiles && isPipe(file) {
+				return h.openPipe(file)
+			}
+
 			// Check we are not following a rabbit hole (symlinks, etc.)
 			if !input.IsRegularFile(file) {
 				file.Close()
 				return nil, errors.New("Given file is not a regular file.")
 			}
 
+			if h.Config.MaxFileSize > 0 {
+				if err := h.checkFileSize(file); err != nil {
+					file.Close()
+					return nil, err
+				}
+			}
+
+			// The prospector starts a new harvester once the file is modified again
+			if h.Config.SkipFutureFiles {
+				if info, err := file.Stat(); err == nil && h.modifiedInFuture(info) {
+					file.Close()
+					return nil, errFutureFile
+				}
+			}
+
+			// Files are read from the output of the configured decompress command
+			if h.Config.DecompressCmd != "" {
+				return h.openCommand(file)
+			}
+
+			// Compressed files are read from the uncompressed stream
+			var compressed bool
+			compressed, err = isGzipFile(file)
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			if compressed {
+				return h.openGzip(file)
+			}
+
 			encoding, err = h.encoding(file)
 			if err == nil {
 				break
@@ -194,11 +1171,21 @@ func (h *Harvester) openFile() (encoding.Encoding, error) {
 			if err != transform.ErrShortSrc {
 				return nil, err
 			}
-			logp.Info("Initialising encoding for '%v' failed due to file being to short")
+			logp.Info("Initialising encoding for '%v' failed due to file being to short", h.Path)
 		}
 
 		logp.Err("Failed opening %s: %s", h.Path, err)
-		time.Sleep(5 * time.Second)
+
+		if h.openRetriesExceeded(retries) {
+			return nil, fmt.Errorf("Giving up opening %s after %d retries: %v", h.Path, retries, err)
+		}
+
+		// wait for next retry, unless the harvester is stopped
+		select {
+		case <-h.done:
+			return nil, errStopped
+		case <-time.After(h.Config.OpenRetryBackoffDuration):
+		}
 	}
 
 	// update file offset
@@ -213,18 +1200,195 @@ func (h *Harvester) openFile() (encoding.Encoding, error) {
 	return encoding, nil
 }
 
+// maxSymlinkDepth returns max_symlink_depth, falling back to the default if
+// not set.
+func (h *Harvester) maxSymlinkDepth() int {
+	if h.Config.MaxSymlinkDepth > 0 {
+		return h.Config.MaxSymlinkDepth
+	}
+	return config.DefaultMaxSymlinkDepth
+}
+
+// modifiedInFuture checks if the file was modified more than
+// future_mtime_skew ahead of the local time, e.g. by a host with a skewed
+// clock. Such files never get older than ignore_older. A warning is logged
+// once per harvester.
+func (h *Harvester) modifiedInFuture(info os.FileInfo) bool {
+	ahead := info.ModTime().Sub(time.Now())
+	if ahead <= h.Config.FutureMtimeSkewDuration {
+		return false
+	}
+
+	if !h.futureModTimeLogged {
+		h.futureModTimeLogged = true
+		if h.Config.SkipFutureFiles {
+			logp.Warn("Skipping file %s modified %v in the future, exceeding future_mtime_skew (%v)", h.Path, ahead, h.Config.FutureMtimeSkewDuration)
+		} else {
+			logp.Warn("File %s was modified %v in the future, exceeding future_mtime_skew (%v). It is not closed by ignore_older before its modification time has passed.", h.Path, ahead, h.Config.FutureMtimeSkewDuration)
+		}
+	}
+	return true
+}
+
+// checkFileSize checks the size of file against max_file_size. Larger files
+// are skipped, returning errTooLarge. With max_file_size_tail, only the last
+// max_file_size_tail bytes of uncompressed files are read instead. The first
+// line read is dropped, as it is likely incomplete.
+func (h *Harvester) checkFileSize(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	if size <= h.Config.MaxFileSize {
+		return nil
+	}
+
+	// offsets of compressed files refer to the uncompressed content
+	compressed, err := isGzipFile(file)
+	if err != nil {
+		return err
+	}
+
+	if h.Config.MaxFileSizeTail == 0 || compressed || h.Config.DecompressCmd != "" {
+		logp.Warn("Skipping file %s of %d bytes exceeding max_file_size (%d)", h.Path, size, h.Config.MaxFileSize)
+		return errTooLarge
+	}
+
+	offset := size - h.Config.MaxFileSizeTail
+	if h.Offset >= offset {
+		return nil
+	}
+
+	logp.Warn("File %s of %d bytes exceeds max_file_size (%d). Reading last %d bytes only",
+		h.Path, size, h.Config.MaxFileSize, h.Config.MaxFileSizeTail)
+
+	// the tail starts with a complete line if the byte before is a newline
+	var last [1]byte
+	if _, err := file.ReadAt(last[:], offset-1); err != nil {
+		return err
+	}
+	h.headerLines = 0
+	if last[0] != '\n' {
+		h.headerLines = 1
+	}
+
+	h.Offset = offset
+	h.startReason = StartReasonMaxFileSizeTail
+	return nil
+}
+
+// openCommand assigns a reader for the output of decompress_cmd run on file
+// to h.file. Offsets are tracked on the decompressed output.
+func (h *Harvester) openCommand(file *os.File) (encoding.Encoding, error) {
+	source, err := newCommandSource(file, h.Config.DecompressCmd, h.Offset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	encoding, err := h.encoding(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+
+	logp.Debug("harvester", "harvest: %q decompressed by %q (offset:%d)", h.Path, h.Config.DecompressCmd, h.Offset)
+	h.file = source
+	return encoding, nil
+}
+
+// openGzip assigns a reader for the uncompressed content of file to h.file.
+// Offsets are tracked on the uncompressed stream.
+func (h *Harvester) openGzip(file *os.File) (encoding.Encoding, error) {
+	source, err := newGzipSource(file, h.Offset)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	encoding, err := h.encoding(source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+
+	logp.Debug("harvester", "harvest: gzip compressed file %q (offset:%d)", h.Path, h.Offset)
+	h.file = source
+	return encoding, nil
+}
+
+// openPipe assigns a named pipe or character device to h.file. Pipes are not
+// seekable, so reading starts with the data currently available and the offset
+// only counts the bytes read by this harvester.
+func (h *Harvester) openPipe(file *os.File) (encoding.Encoding, error) {
+	// restrict encoding factories to the non seekable interface
+	encoding, err := h.encoding(pipeSource{file})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	logp.Debug("harvester", "harvest: pipe %q", h.Path)
+	h.Offset = 0
+	h.file = fileSource{file}
+	return encoding, nil
+}
+
 func (h *Harvester) initFileOffset(file *os.File) error {
 	offset, err := file.Seek(0, os.SEEK_CUR)
 
 	if h.Offset > 0 {
 		// continue from last known offset
 
+		// The saved offset can be behind the end of the file, e.g. if the
+		// file was replaced by a smaller one while filebeat was not running
+		// or the registry was not written properly on shutdown.
+		if info, statErr := file.Stat(); statErr == nil && info.Mode().IsRegular() && info.Size() < h.Offset {
+			logp.Warn("Saved offset %d exceeds size %d of file %s. Reading from beginning of file.",
+				h.Offset, info.Size(), h.Path)
+			h.Offset = 0
+			h.headerLines = h.Config.SkipHeaderLines
+			h.startReason = StartReasonReset
+		} else if h.startReason == "" {
+			// not set to max_file_size_tail by checkFileSize
+			h.startReason = StartReasonResume
+		}
+
 		logp.Debug("harvester",
 			"harvest: %q position:%d (offset snapshot:%d)", h.Path, h.Offset, offset)
 		_, err = file.Seek(h.Offset, os.SEEK_SET)
-	} else if h.Config.TailFiles {
+	} else if h.Config.StartOffset > 0 {
+		// start reading new file at configured offset
+
+		h.startReason = StartReasonStartOffset
+		h.Offset = h.Config.StartOffset
+		if info, statErr := file.Stat(); statErr == nil && info.Size() < h.Offset {
+			logp.Warn("start_offset %d exceeds size %d of file %s. Reading from end of file.",
+				h.Offset, info.Size(), h.Path)
+			h.Offset = info.Size()
+		}
+
+		logp.Debug("harvester",
+			"harvest: %q start offset:%d (offset snapshot:%d)", h.Path, h.Offset, offset)
+		_, err = file.Seek(h.Offset, os.SEEK_SET)
+	} else if h.TailFiles && h.Config.TailLines > 0 {
+		// start at the last lines if file is new and tail_lines config is set
+
+		h.startReason = StartReasonTail
+		h.Offset, err = seekTailLines(file, h.Config.TailLines)
+		if err == nil && h.Offset < offset {
+			// do not read a byte order mark read by the encoding factory again
+			h.Offset, err = file.Seek(offset, os.SEEK_SET)
+		}
+
+		logp.Debug("harvester",
+			"harvest: (tailing %d lines) %q position:%d (offset snapshot:%d)", h.Config.TailLines, h.Path, h.Offset, offset)
+	} else if h.TailFiles {
 		// tail file if file is new and tail_files config is set
 
+		h.startReason = StartReasonTail
 		logp.Debug("harvester",
 			"harvest: (tailing) %q (offset snapshot:%d)", h.Path, offset)
 		h.Offset, err = file.Seek(0, os.SEEK_END)
@@ -233,6 +1397,7 @@ func (h *Harvester) initFileOffset(file *os.File) error {
 		// get offset from file in case of encoding factory was
 		// required to read some data.
 
+		h.startReason = StartReasonBeginning
 		logp.Debug("harvester", "harvest: %q (offset snapshot:%d)", h.Path, offset)
 		h.Offset = offset
 	}
@@ -245,17 +1410,32 @@ func (h *Harvester) initFileOffset(file *os.File) error {
 // If error is EOF, it will check for:
 // * File truncated
 // * Older then ignore_older
+// * Older then close_older
+// * close_eof enabled
+// * File replaced by another file
 // * General file error
 //
 // If none of the above cases match, no error will be returned and file is kept open
 //
 // In case of a general error, the error itself is returned
 func (h *Harvester) handleReadlineError(lastTimeRead time.Time, err error) error {
-	if err != io.EOF || !h.file.Continuable() {
+	if err == io.EOF && !h.file.Continuable() {
+		// Source will not grow (e.g. compressed file) -> stop at EOF
+		return err
+	}
+
+	if err != io.EOF {
 		logp.Err("Unexpected state reading from %s; error: %s", h.Path, err)
 		return err
 	}
 
+	// Sockets are redialed on the next read after backing off. Offsets have
+	// no meaning, so truncation and inactivity checks do not apply.
+	if _, ok := h.file.(*socketSource); ok {
+		h.backOff()
+		return nil
+	}
+
 	// Refetch fileinfo to check if the file was truncated or disappeared.
 	// Errors if the file was removed/rotated after reading and before
 	// calling the stat function
@@ -265,26 +1445,108 @@ func (h *Harvester) handleReadlineError(lastTimeRead time.Time, err error) error
 		return statErr
 	}
 
-	// Handle fails if file was truncated
-	if info.Size() < h.Offset {
-		seeker, ok := h.file.(io.Seeker)
-		if !ok {
-			logp.Err("Can not seek source")
+	// Handle fails if file was truncated. Pipes have no size to compare with.
+	if info.Mode().IsRegular() && info.Size() < h.Offset {
+		if shrinkErr := h.handleShrink(info); shrinkErr != nil {
+			if _, ok := shrinkErr.(*stopError); ok {
+				return shrinkErr
+			}
+			logp.Err("Can not seek source: %s", shrinkErr)
 			return err
 		}
+		return nil
+	}
 
-		logp.Debug("harvester", "File was truncated as offset (%s) > size (%s). Begin reading file from offset 0: %s", h.Offset, info.Size(), h.Path)
+	// Concatenated files are harvested until the harvester is stopped, as
+	// the file names are not known to the prospector to restart harvesting.
+	if source, ok := h.file.(*concatSource); ok {
+		if path, offset, changed := source.checkChanged(); changed {
+			if !h.ProspectorConfig.ConcatRereadChanged {
+				logp.Warn("File %s changed after it was read. Changes are not read: %s", path, h.Path)
+			} else {
+				logp.Info("File %s changed after it was read. Reading again from offset %d: %s", path, offset, h.Path)
+				if _, seekErr := source.Seek(offset, os.SEEK_SET); seekErr != nil {
+					logp.Err("Can not seek source: %s", seekErr)
+					return seekErr
+				}
+				h.Offset = offset
+				return nil
+			}
+		}
 
-		h.Offset = 0
-		seeker.Seek(h.Offset, os.SEEK_SET)
+		if h.Config.CloseEOF {
+			return err
+		}
+		h.backOff()
 		return nil
 	}
 
+	// Handle file rewritten with content of the same or a bigger size
+	if h.Config.FingerprintSize > 0 && info.Mode().IsRegular() {
+		changed, fpErr := h.fingerprintChanged()
+		if fpErr != nil {
+			logp.Err("Can not read fingerprint of %s: %s", h.Path, fpErr)
+			return fpErr
+		}
+		if changed {
+			logp.Debug("harvester", "Fingerprint of the first %d bytes changed: %s", h.Config.FingerprintSize, h.Path)
+			if seekErr := h.resetOffset(info); seekErr != nil {
+				logp.Err("Can not seek source: %s", seekErr)
+				return err
+			}
+			return nil
+		}
+	}
+
+	if h.Config.CloseEOF {
+		// Stop on first EOF instead of waiting for the file to grow
+		return err
+	}
+
+	if info.Mode().IsRegular() && h.modifiedInFuture(info) && h.Config.SkipFutureFiles {
+		return &stopError{StopReasonFutureFile,
+			fmt.Sprintf("Stop harvesting as file was modified in the future: %s; Modification time: %s", h.Path, info.ModTime())}
+	}
+
 	age := time.Since(lastTimeRead)
-	if age > h.ProspectorConfig.IgnoreOlderDuration {
+
+	// On network file systems the modification time can be more reliable than
+	// the time of the last read, e.g. shortly after startup.
+	ignoreAge := age
+	if h.ProspectorConfig.IgnoreOlderUseMtime {
+		ignoreAge = time.Since(info.ModTime())
+	}
+
+	if ignoreAge > h.ProspectorConfig.IgnoreOlderDuration {
 		// If the file hasn't change for longer the ignore_older, harvester stops
 		// and file handle will be closed.
-		return fmt.Errorf("Stop harvesting as file is older then ignore_older: %s; Last change was: %s ", h.Path, age)
+		return &stopError{StopReasonIgnoreOlder,
+			fmt.Sprintf("Stop harvesting as file is older then ignore_older: %s; Last change was: %s ", h.Path, ignoreAge)}
+	}
+
+	if h.Config.CloseOlderDuration > 0 && age > h.Config.CloseOlderDuration {
+		// Release the file handle of inactive files. The prospector resumes
+		// harvesting from the last offset as soon as the file is modified.
+		logp.Debug("harvester", "File is inactive for longer than close_older (%v): %s", h.Config.CloseOlderDuration, h.Path)
+		return errInactive
+	}
+
+	if h.Config.EmptyFileTimeoutDuration > 0 && h.Offset == 0 && info.Mode().IsRegular() &&
+		info.Size() == 0 && age > h.Config.EmptyFileTimeoutDuration {
+		// Release the file handle of files still empty. Like for close_older,
+		// the prospector starts harvesting from offset 0 once the file is modified.
+		logp.Debug("harvester", "File is empty for longer than empty_file_timeout (%v): %s", h.Config.EmptyFileTimeoutDuration, h.Path)
+		return errEmpty
+	}
+
+	// Check if the path points to another file than the one being harvested,
+	// e.g. after rotation. Stop so the prospector starts a new harvester for it,
+	// unless the renamed file is followed.
+	if pathInfo, statErr := os.Stat(h.Path); statErr == nil && !os.SameFile(info, pathInfo) {
+		if !h.Config.FollowRenamed {
+			return &stopError{StopReasonReplaced, fmt.Sprintf("Stop harvesting as file was replaced: %s", h.Path)}
+		}
+		h.followRename(info)
 	}
 
 	// On windows, check if the file name exists (see #93)
@@ -293,83 +1555,290 @@ func (h *Harvester) handleReadlineError(lastTimeRead time.Time, err error) error
 		if statErr != nil {
 			logp.Info("Unexpected force close specific error reading from %s; error: %s", h.Path, statErr)
 			// Return directly on windows -> file is closing
-			return fmt.Errorf("Force closing file: %s", h.Path)
+			return &stopError{StopReasonForceClose, fmt.Sprintf("Force closing file: %s", h.Path)}
 		}
 	}
 
+	h.heartbeat(lastTimeRead, info)
+
 	// Do nothing in case it is just EOF, keep reading the file after backing off
 	h.backOff()
 	return nil
 }
 
+// followRename looks up the new path of the harvested file after its path was
+// replaced by another file, e.g. app.log.1 after rotating app.log. Only the
+// directory of the old path is searched. The new path is used as source of
+// further events, so their state is stored for the renamed file. If the file
+// is not found, e.g. because it was moved to another directory, the old path
+// is kept.
+func (h *Harvester) followRename(info os.FileInfo) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(h.Path), "*"))
+	if err != nil {
+		return
+	}
+
+	for _, path := range matches {
+		if pathInfo, err := os.Stat(path); err == nil && os.SameFile(info, pathInfo) {
+			logp.Info("File %s was renamed to %s. Continue reading renamed file", h.Path, path)
+			h.stats.setPath(path)
+			h.Path = path
+			h.Source = path
+			if h.Config.NormalizeSource {
+				h.Source = NormalizeSource(path)
+			}
+			return
+		}
+	}
+
+	logp.Debug("harvester", "File %s was replaced, renamed file not found. Continue reading", h.Path)
+}
+
+// checkTruncated checks if the file size dropped below the current offset,
+// e.g. because the file was truncated and rewritten while being read. If so,
+// shrink_policy is applied.
+func (h *Harvester) checkTruncated() (bool, error) {
+	info, err := h.file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !info.Mode().IsRegular() || info.Size() >= h.Offset {
+		return false, nil
+	}
+	return true, h.handleShrink(info)
+}
+
+// handleShrink applies shrink_policy to a file whose size dropped below the
+// current offset. By default reading restarts at the beginning of the file.
+func (h *Harvester) handleShrink(info os.FileInfo) error {
+	switch h.Config.ShrinkPolicy {
+	case config.ShrinkPolicyIgnore:
+		return h.clampOffset(info)
+	case config.ShrinkPolicyStop:
+		return &stopError{StopReasonShrunk,
+			fmt.Sprintf("Stop harvesting as file shrunk to %d bytes below offset %d: %s", info.Size(), h.Offset, h.Path)}
+	default:
+		return h.resetOffset(info)
+	}
+}
+
+// clampOffset moves the read pointer and offset to the end of a file that
+// shrunk, so only content appended afterwards is read.
+func (h *Harvester) clampOffset(info os.FileInfo) error {
+	seeker, ok := h.file.(io.Seeker)
+	if !ok {
+		return errNotSeekable
+	}
+
+	logp.Debug("harvester", "File shrunk as offset (%d) > size (%d). Continue reading at end of file: %s", h.Offset, info.Size(), h.Path)
+
+	h.Offset = info.Size()
+	_, err := seeker.Seek(h.Offset, os.SEEK_SET)
+	return err
+}
+
+// resetOffset moves the read pointer and offset to the beginning of the
+// truncated file.
+func (h *Harvester) resetOffset(info os.FileInfo) error {
+	seeker, ok := h.file.(io.Seeker)
+	if !ok {
+		return errNotSeekable
+	}
+
+	logp.Debug("harvester", "File was truncated as offset (%d) > size (%d). Begin reading file from offset 0: %s", h.Offset, info.Size(), h.Path)
+
+	h.Offset = 0
+	h.headerLines = h.Config.SkipHeaderLines
+	h.fingerprint = nil // taken from the new content on next EOF
+	if _, err := seeker.Seek(h.Offset, os.SEEK_SET); err != nil {
+		return err
+	}
+
+	h.notifyLifecycle(LifecycleTruncated, "")
+	return nil
+}
+
+// retrySeekOffset calls seekOffset, retrying up to read_error_retries times
+// after backing off, as seeking can fail transiently on network file systems
+// as well.
+func (h *Harvester) retrySeekOffset() error {
+	err := h.seekOffset()
+	for retries := 0; err != nil && err != errNotSeekable && retries < h.Config.ReadErrorRetries; retries++ {
+		logp.Warn("Error seeking %s to offset %d. Retry %d of %d. Error: %s", h.Path, h.Offset, retries+1, h.Config.ReadErrorRetries, err)
+		h.backOff()
+		select {
+		case <-h.done:
+			return errStopped
+		default:
+		}
+		err = h.seekOffset()
+	}
+	return err
+}
+
+// seekOffset moves the read pointer back to the current offset, the end of
+// the last line processed.
+func (h *Harvester) seekOffset() error {
+	seeker, ok := h.file.(io.Seeker)
+	if !ok || !h.file.Continuable() {
+		return errNotSeekable
+	}
+
+	_, err := seeker.Seek(h.Offset, os.SEEK_SET)
+	return err
+}
+
+// Stop signals the harvester to stop reading. The harvester closes the file
+// and pushes its last offset once it returned from the current read or backoff.
 func (h *Harvester) Stop() {
+	if !h.stopped() {
+		close(h.done)
+	}
+}
+
+// stopped returns true if Stop was called
+func (h *Harvester) stopped() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
 }
 
 /*** Utility Functions ***/
 
-// isLine checks if the given byte array is a line, means has a line ending \n
-func isLine(line []byte) bool {
+// isLine checks if the given byte array is a line, means has a line ending delimiter.
+// If cr is set, a line ending with a carriage return is a line as well.
+func isLine(line []byte, delimiter []byte, cr bool) bool {
 	if line == nil || len(line) == 0 {
 		return false
 	}
 
-	if line[len(line)-1] != '\n' {
+	if cr && line[len(line)-1] == '\r' {
+		return true
+	}
+
+	if !bytes.HasSuffix(line, delimiter) {
 		return false
 	}
 	return true
 }
 
 // lineEndingChars returns the number of line ending chars the given by array has
-// In case of Unix/Linux files, it is -1, in case of Windows mostly -2
-func lineEndingChars(line []byte) int {
-	if !isLine(line) {
+// In case of Unix/Linux files, it is -1, in case of Windows mostly -2.
+// For other delimiters than \n, it is the length of the delimiter.
+// If cr is set, a single carriage return is a line ending as well.
+func lineEndingChars(line []byte, delimiter []byte, cr bool) int {
+	if !isLine(line, delimiter, cr) {
 		return 0
 	}
 
-	if line[len(line)-1] == '\n' {
+	if cr && line[len(line)-1] == '\r' {
+		return 1
+	}
+
+	if len(delimiter) == 1 && delimiter[0] == '\n' {
 		if len(line) > 1 && line[len(line)-2] == '\r' {
 			return 2
 		}
 
 		return 1
 	}
-	return 0
+	return len(delimiter)
 }
 
 // readLine reads a full line into buffer and returns it.
-// In case of partial lines, readLine waits for a maximum of partialLineWaiting seconds for new segments to arrive.
+// In case of partial lines, readLine waits for a maximum of partialLineWaiting seconds for new segments to arrive,
+// checking for new segments every pollInterval. A negative partialLineWaiting waits until the line is completed.
+// Incomplete lines exceeding the limit of the reader are returned as partial
+// lines at once, also at the end of the input.
+// If done is closed while waiting, errStopped is returned.
 // This could potentialy be improved / replaced by https://github.com/elastic/libbeat/tree/master/common/streambuf
 func readLine(
 	reader *lineReader,
 	lastReadTime *time.Time,
 	partialLineWaiting time.Duration,
+	pollInterval time.Duration,
+	done <-chan struct{},
 ) (string, int, bool, error) {
 	for {
 		line, sz, err := reader.next()
-		if err != nil {
-			if err == io.EOF {
-				return "", 0, false, err
-			}
+		if sz != 0 {
+			return readlineString(line, sz, false, reader)
 		}
 
-		if sz != 0 {
-			return readlineString(line, sz, false)
+		if reader.partialExceeded() {
+			line, sz, err = reader.partial()
+			return readlineString(line, sz, true, reader)
+		}
+
+		if err != nil && err != streambuf.ErrNoMoreBytes {
+			return "", 0, false, err
 		}
 
 		// test for no file updates longer than partialLineWaiting
-		if time.Since(*lastReadTime) >= partialLineWaiting {
+		if partialLineWaiting >= 0 && time.Since(*lastReadTime) >= partialLineWaiting {
 			// return all bytes read for current line to be processed.
 			// Line might grow with further read attempts
 			line, sz, err = reader.partial()
-			return readlineString(line, sz, true)
+			return readlineString(line, sz, true, reader)
 		}
 
 		// wait for file updates before reading new lines
-		time.Sleep(1 * time.Second)
+		select {
+		case <-done:
+			return "", 0, false, errStopped
+		case <-time.After(pollInterval):
+		}
 	}
 }
 
-func readlineString(bytes []byte, sz int, partial bool) (string, int, bool, error) {
-	s := string(bytes)[:len(bytes)-lineEndingChars(bytes)]
-	return s, sz, partial, nil
+func readlineString(bytes []byte, sz int, partial bool, reader *lineReader) (string, int, bool, error) {
+	end := len(bytes) - lineEndingChars(bytes, reader.delimiter, reader.cr != nil)
+	reader.ending = lineEnding(bytes[end:])
+
+	// Each line is stripped of its own line ending, so files mixing LF and
+	// CRLF lines are read correctly. A partial line ending with a carriage
+	// return was cut between the CR and LF of a CRLF line ending, so the CR is
+	// not part of the text either.
+	if partial && end == len(bytes) && end > 0 && bytes[end-1] == '\r' && len(reader.delimiter) == 1 && reader.delimiter[0] == '\n' {
+		end--
+	}
+	return string(bytes[:end]), sz, partial, nil
+}
+
+// lineEnding converts the line ending of a line to a string. Common line
+// endings are returned without allocating a string for every line.
+func lineEnding(ending []byte) string {
+	switch string(ending) {
+	case "":
+		return ""
+	case "\n":
+		return "\n"
+	case "\r\n":
+		return "\r\n"
+	case "\r":
+		return "\r"
+	default:
+		return string(ending)
+	}
+}
+
+// lineEndingName returns the name of the line ending published as line_ending.
+// Returns an empty string for lines without line ending.
+func lineEndingName(ending string) string {
+	switch ending {
+	case "":
+		return ""
+	case "\n":
+		return "lf"
+	case "\r\n":
+		return "crlf"
+	case "\r":
+		return "cr"
+	default:
+		return "delimiter"
+	}
 }
@@ -1,14 +1,25 @@
 package harvester
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/elastic/filebeat/config"
 	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/filebeat/input"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -56,10 +67,10 @@ func TestReadLine(t *testing.T) {
 	// Read only 10 bytes which is not the end of the file
 	timedIn := newTimedReader(readFile)
 	codec, _ := encoding.Plain(file)
-	reader, _ := newLineReader(timedIn, codec, 100)
+	reader, _ := newLineReader(timedIn, codec, 100, 0, "\n")
 
 	// Read third line
-	text, bytesread, isPartial, err := readLine(reader, &timedIn.lastReadTime, 0)
+	text, bytesread, isPartial, err := readLine(reader, &timedIn.lastReadTime, 0, time.Second, nil)
 
 	assert.Equal(t, text, firstLineString[0:len(firstLineString)-1])
 	assert.Equal(t, bytesread, len(firstLineString))
@@ -67,7 +78,7 @@ func TestReadLine(t *testing.T) {
 	assert.False(t, isPartial)
 
 	// read second line
-	text, bytesread, isPartial, err = readLine(reader, &timedIn.lastReadTime, 0)
+	text, bytesread, isPartial, err = readLine(reader, &timedIn.lastReadTime, 0, time.Second, nil)
 
 	assert.Equal(t, text, secondLineString[0:len(secondLineString)-1])
 	assert.Equal(t, bytesread, len(secondLineString))
@@ -75,42 +86,2099 @@ func TestReadLine(t *testing.T) {
 	assert.False(t, isPartial)
 
 	// Read third line, which doesn't exist
-	text, bytesread, isPartial, err = readLine(reader, &timedIn.lastReadTime, 0)
+	text, bytesread, isPartial, err = readLine(reader, &timedIn.lastReadTime, 0, time.Second, nil)
 	assert.Equal(t, "", text)
 	assert.Equal(t, bytesread, 0)
 	assert.Equal(t, err, io.EOF)
 	assert.False(t, isPartial)
 }
 
+var nl = []byte{'\n'}
+
 func TestIsLine(t *testing.T) {
 	notLine := []byte("This is not a line")
-	assert.False(t, isLine(notLine))
+	assert.False(t, isLine(notLine, nl, false))
 
 	notLine = []byte("This is not a line\n\r")
-	assert.False(t, isLine(notLine))
+	assert.False(t, isLine(notLine, nl, false))
 
 	notLine = []byte("This is \n not a line")
-	assert.False(t, isLine(notLine))
+	assert.False(t, isLine(notLine, nl, false))
 
 	line := []byte("This is a line \n")
-	assert.True(t, isLine(line))
+	assert.True(t, isLine(line, nl, false))
 
 	line = []byte("This is a line\r\n")
-	assert.True(t, isLine(line))
+	assert.True(t, isLine(line, nl, false))
 }
 
 func TestLineEndingChars(t *testing.T) {
 
 	line := []byte("Not ending line")
-	assert.Equal(t, 0, lineEndingChars(line))
+	assert.Equal(t, 0, lineEndingChars(line, nl, false))
 
 	line = []byte("N ending \n")
-	assert.Equal(t, 1, lineEndingChars(line))
+	assert.Equal(t, 1, lineEndingChars(line, nl, false))
 
 	line = []byte("RN ending \r\n")
-	assert.Equal(t, 2, lineEndingChars(line))
+	assert.Equal(t, 2, lineEndingChars(line, nl, false))
 
 	// This is an invalid option
 	line = []byte("NR ending \n\r")
-	assert.Equal(t, 0, lineEndingChars(line))
+	assert.Equal(t, 0, lineEndingChars(line, nl, false))
+
+	// Custom delimiters
+	line = []byte("NUL ending \x00")
+	assert.Equal(t, 1, lineEndingChars(line, []byte{0}, false))
+
+	line = []byte("RS ending \r\x1e")
+	assert.Equal(t, 1, lineEndingChars(line, []byte{0x1e}, false))
+
+	// lone carriage return only terminates lines if enabled
+	line = []byte("Mac line\r")
+	assert.False(t, isLine(line, nl, false))
+	assert.True(t, isLine(line, nl, true))
+	assert.Equal(t, 1, lineEndingChars(line, nl, true))
+
+	line = []byte("Windows line\r\n")
+	assert.Equal(t, 2, lineEndingChars(line, nl, true))
+}
+
+func TestReadLineMixedLineEndings(t *testing.T) {
+	type line struct {
+		text, ending string
+		sz           int
+	}
+	tests := []struct {
+		input string
+		cr    bool
+		lines []line
+	}{
+		{"lf\ncrlf\r\ncrlf\r\nlf\n\r\n", false, []line{
+			{"lf", "\n", 3}, {"crlf", "\r\n", 6}, {"crlf", "\r\n", 6}, {"lf", "\n", 3}, {"", "\r\n", 2},
+		}},
+		{"cr\rcrlf\r\nlf\n\r\r\n", true, []line{
+			{"cr", "\r", 3}, {"crlf", "\r\n", 6}, {"lf", "\n", 3}, {"", "\r", 1}, {"", "\r\n", 2},
+		}},
+	}
+
+	for _, test := range tests {
+		// one byte per read splits line endings across reads
+		for _, oneByte := range []bool{false, true} {
+			var in io.Reader = strings.NewReader(test.input)
+			if oneByte {
+				in = iotest.OneByteReader(in)
+			}
+			codec, _ := encoding.Plain(nil)
+			reader, err := newLineReader(newTimedReader(in), codec, 1024, 0, "\n")
+			assert.Nil(t, err)
+			if test.cr {
+				assert.Nil(t, reader.enableCR())
+			}
+
+			for i, expected := range test.lines {
+				text, sz, isPartial, err := readLine(reader, &time.Time{}, time.Hour, time.Millisecond, nil)
+				assert.Nil(t, err)
+				assert.False(t, isPartial)
+				assert.Equal(t, expected, line{text, reader.ending, sz}, "%q line %d", test.input, i)
+			}
+
+			_, _, _, err = readLine(reader, &time.Time{}, time.Hour, time.Millisecond, nil)
+			assert.Equal(t, io.EOF, err)
+		}
+	}
+}
+
+func TestReadLinePartialCR(t *testing.T) {
+	// CRLF line ending cut after the CR
+	codec, _ := encoding.Plain(nil)
+	reader, err := newLineReader(newTimedReader(strings.NewReader("lf\ncrlf\r")), codec, 1024, 0, "\n")
+	assert.Nil(t, err)
+
+	text, _, _, err := readLine(reader, &time.Time{}, time.Hour, time.Millisecond, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "lf", text)
+
+	line, sz, err := reader.partial()
+	assert.Nil(t, err)
+	text, sz, isPartial, _ := readlineString(line, sz, true, reader)
+	assert.True(t, isPartial)
+	assert.Equal(t, "crlf", text)
+	assert.Equal(t, 5, sz)
+	assert.Equal(t, "", reader.ending)
+}
+
+// emptyReader never returns any bytes, simulating a file waiting for new data
+type emptyReader struct{}
+
+func (emptyReader) Read(p []byte) (int, error) { return 0, nil }
+
+func TestReadLineStopped(t *testing.T) {
+	timedIn := newTimedReader(emptyReader{})
+	timedIn.lastReadTime = time.Now()
+	codec, _ := encoding.Plain(timedIn)
+	reader, _ := newLineReader(timedIn, codec, 100, 0, "\n")
+
+	done := make(chan struct{})
+	close(done)
+
+	// readLine must not wait for the partial line timeout if done is closed
+	_, _, _, err := readLine(reader, &timedIn.lastReadTime, time.Hour, time.Second, done)
+	assert.Equal(t, errStopped, err)
+}
+
+// errorReader fails every read, simulating an unavailable network file system
+type errorReader struct{}
+
+func (errorReader) Read(p []byte) (int, error) { return 0, errors.New("input/output error") }
+
+func TestReadLineError(t *testing.T) {
+	timedIn := newTimedReader(errorReader{})
+	codec, _ := encoding.Plain(timedIn)
+	reader, _ := newLineReader(timedIn, codec, 100, 0, "\n")
+
+	// read errors are returned to be handled by the harvester
+	_, _, _, err := readLine(reader, &timedIn.lastReadTime, time.Hour, time.Second, nil)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
+
+func TestSeekOffset(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-seek")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\npartial")
+
+	// read pointer is moved back to the end of the last complete line
+	h := &Harvester{
+		Offset: 7,
+		file:   fileSource{file},
+	}
+	assert.Nil(t, h.seekOffset())
+
+	content, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "partial", string(content))
+}
+
+// failingSeekSource fails the first failures seeks.
+type failingSeekSource struct {
+	fileSource
+	failures int
+}
+
+func (s *failingSeekSource) Seek(offset int64, whence int) (int64, error) {
+	if s.failures > 0 {
+		s.failures--
+		return 0, errors.New("seek failed")
+	}
+	return s.fileSource.Seek(offset, whence)
+}
+
+func TestRetrySeekOffset(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-seek")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\npartial")
+
+	var tests = []struct {
+		failures, retries int
+		success           bool
+	}{
+		{0, 0, true},
+		{1, 0, false},
+		{2, 2, true},
+		{3, 2, false},
+	}
+
+	for _, test := range tests {
+		source := &failingSeekSource{fileSource{file}, test.failures}
+		h := &Harvester{
+			Offset:  7,
+			file:    source,
+			Config:  &config.HarvesterConfig{ReadErrorRetries: test.retries},
+			backoff: time.Millisecond,
+			done:    make(chan struct{}),
+		}
+
+		err := h.retrySeekOffset()
+		assert.Equal(t, test.success, err == nil, "failures: %d, retries: %d", test.failures, test.retries)
+		if test.success {
+			pos, _ := file.Seek(0, os.SEEK_CUR)
+			assert.Equal(t, int64(7), pos)
+		}
+	}
+}
+
+func TestBackOffStopped(t *testing.T) {
+	h := &Harvester{
+		Config:  &config.HarvesterConfig{},
+		backoff: time.Hour,
+		done:    make(chan struct{}),
+	}
+	h.Stop()
+	h.Stop() // stopping twice must not panic
+
+	start := time.Now()
+	h.backOff()
+	assert.True(t, time.Since(start) < time.Minute)
+}
+
+func TestOpenFileMaxRetries(t *testing.T) {
+	maxRetries := 2
+	h := &Harvester{
+		Path: "/not/existing/file.log",
+		Config: &config.HarvesterConfig{
+			MaxOpenRetries:           &maxRetries,
+			OpenRetryBackoffDuration: time.Millisecond,
+		},
+		done: make(chan struct{}),
+	}
+
+	_, err := h.open()
+	assert.NotNil(t, err)
+	assert.Nil(t, h.file)
+}
+
+func TestOpenFileStopped(t *testing.T) {
+	maxRetries := -1
+	h := &Harvester{
+		Path: "/not/existing/file.log",
+		Config: &config.HarvesterConfig{
+			MaxOpenRetries:           &maxRetries,
+			OpenRetryBackoffDuration: time.Hour,
+		},
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		h.Stop()
+	}()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := h.open()
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		assert.Equal(t, errStopped, err)
+		assert.Nil(t, h.file)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for open to be aborted")
+	}
+}
+
+func TestHandleReadlineErrorCloseEOF(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-close-eof")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	h := &Harvester{
+		Path: file.Name(),
+		ProspectorConfig: config.ProspectorConfig{
+			IgnoreOlderDuration: time.Hour,
+		},
+		Config: &config.HarvesterConfig{
+			CloseEOF: true,
+		},
+		file: fileSource{file},
+		done: make(chan struct{}),
+	}
+
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCheckTruncated(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-truncated")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	h := &Harvester{
+		Path:   file.Name(),
+		Config: &config.HarvesterConfig{SkipHeaderLines: 1},
+		Offset: 14,
+		file:   fileSource{file},
+	}
+
+	truncated, err := h.checkTruncated()
+	assert.Nil(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, int64(14), h.Offset)
+
+	// truncate and rewrite shorter content
+	file.Truncate(0)
+	file.WriteAt([]byte("new\n"), 0)
+
+	truncated, err = h.checkTruncated()
+	assert.Nil(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, int64(0), h.Offset)
+
+	// rewritten file starts with a new header
+	assert.Equal(t, 1, h.headerLines)
+
+	content, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "new\n", string(content))
+}
+
+func TestShrinkPolicy(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-shrink")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\nline 3\n")
+
+	// file rewritten with the first lines only
+	file.Truncate(14)
+
+	h := &Harvester{
+		Path:   file.Name(),
+		Config: &config.HarvesterConfig{ShrinkPolicy: config.ShrinkPolicyIgnore},
+		Offset: 21,
+		file:   fileSource{file},
+	}
+
+	// continue at the new end of file
+	truncated, err := h.checkTruncated()
+	assert.Nil(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, int64(14), h.Offset)
+
+	file.WriteAt([]byte("line 4\n"), 14)
+	content, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "line 4\n", string(content))
+
+	// stop harvesting, keeping the offset
+	h.Config.ShrinkPolicy = config.ShrinkPolicyStop
+	h.Offset = 30
+	_, err = h.checkTruncated()
+	assert.NotNil(t, err)
+	assert.Equal(t, StopReasonShrunk, h.stopReason(err))
+	assert.Equal(t, int64(30), h.Offset)
+}
+
+func TestJitter(t *testing.T) {
+	backoff := 10 * time.Second
+	assert.Equal(t, backoff, jitter(backoff, 0))
+
+	for i := 0; i < 100; i++ {
+		d := jitter(backoff, 0.2)
+		assert.True(t, d >= 8*time.Second && d <= 12*time.Second, "jitter out of range: %v", d)
+	}
+}
+
+func TestInitFileOffsetStartOffset(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-start-offset")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	var tests = []struct {
+		offset         int64
+		startOffset    int64
+		expectedOffset int64
+	}{
+		{0, 7, 7},    // start at configured offset
+		{0, 100, 14}, // clamp to file size
+		{3, 7, 3},    // registrar state wins
+		{100, 0, 0},  // saved offset behind end of file
+		{0, 0, 0},
+	}
+
+	for _, test := range tests {
+		file.Seek(0, os.SEEK_SET)
+		h := &Harvester{
+			Path:   file.Name(),
+			Offset: test.offset,
+			Config: &config.HarvesterConfig{
+				StartOffset: test.startOffset,
+			},
+		}
+
+		err := h.initFileOffset(file)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedOffset, h.Offset)
+
+		pos, _ := file.Seek(0, os.SEEK_CUR)
+		assert.Equal(t, test.expectedOffset, pos)
+	}
+}
+
+func TestHarvestStaleOffset(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-stale-offset")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("header\nline 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:      1024,
+			CloseEOF:        true,
+			SkipHeaderLines: 1,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	// offset saved for a bigger file that was replaced
+	h.Offset = 1000
+
+	h.Harvest()
+	close(spooler)
+
+	var lines []string
+	for event := range spooler {
+		lines = append(lines, *event.Text)
+	}
+	assert.Equal(t, []string{"line 1", "line 2"}, lines)
+	assert.Equal(t, int64(21), h.Offset)
+}
+
+func TestHarvestTailLines(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-tail-lines")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\nline 3\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize: 1024,
+			CloseEOF:   true,
+			TailLines:  2,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "line 2", *events[0].Text)
+	assert.Equal(t, int64(7), events[0].Offset)
+	assert.Equal(t, "line 3", *events[1].Text)
+}
+
+func TestHarvestFlushPartialOnClose(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-partial")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nlast line")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:          1024,
+			CloseEOF:            true,
+			FlushPartialOnClose: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "line 1", *events[0].Text)
+	assert.Equal(t, "last line", *events[1].Text)
+	assert.True(t, events[1].Unterminated)
+	assert.Equal(t, true, events[1].ToMapStr()["partial"])
+
+	// offset includes the unterminated line
+	assert.Equal(t, int64(16), events[1].GetState().Offset)
+	assert.Equal(t, int64(16), h.Offset)
+}
+
+func TestOpenFileExcluded(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-excluded")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+
+	h := &Harvester{
+		Path: file.Name(),
+		ProspectorConfig: config.ProspectorConfig{
+			ExcludeFilesRegexp: []*regexp.Regexp{regexp.MustCompile("filebeat-excluded")},
+		},
+		Config:   &config.HarvesterConfig{},
+		encoding: encoding.Plain,
+		done:     make(chan struct{}),
+	}
+
+	_, err = h.open()
+	assert.NotNil(t, err)
+	assert.Nil(t, h.file)
+}
+
+func TestPublishBlockedSpooler(t *testing.T) {
+	spooler := make(chan *input.FileEvent)
+	h := &Harvester{
+		Path: "/var/log/app.log",
+		Config: &config.HarvesterConfig{
+			SpoolerSendTimeoutDuration: 10 * time.Millisecond,
+		},
+		SpoolerChan: spooler,
+		done:        make(chan struct{}),
+	}
+
+	// send is retried after timeout until spooler accepts the event
+	sent := make(chan bool)
+	go func() { sent <- h.publish(&input.FileEvent{}) }()
+	time.Sleep(50 * time.Millisecond)
+	<-spooler
+	assert.True(t, <-sent)
+
+	// event is not sent if harvester is stopped
+	go func() { sent <- h.publish(&input.FileEvent{}) }()
+	h.Stop()
+	assert.False(t, <-sent)
+}
+
+func TestHandleReadlineErrorIgnoreOlderMtime(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-mtime")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// file was last modified 2 hours ago, but just read
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(file.Name(), old, old)
+
+	h := &Harvester{
+		Path: file.Name(),
+		ProspectorConfig: config.ProspectorConfig{
+			IgnoreOlderDuration: time.Hour,
+		},
+		Config: &config.HarvesterConfig{
+			BackoffDuration: time.Millisecond,
+		},
+		file: fileSource{file},
+		done: make(chan struct{}),
+	}
+
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.Nil(t, err)
+
+	h.ProspectorConfig.IgnoreOlderUseMtime = true
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.NotNil(t, err)
+}
+
+func TestHandleReadlineErrorFutureFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-future")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// file written by a host with a clock 2 hours ahead
+	future := time.Now().Add(2 * time.Hour)
+	os.Chtimes(file.Name(), future, future)
+
+	h := &Harvester{
+		Path: file.Name(),
+		ProspectorConfig: config.ProspectorConfig{
+			IgnoreOlderDuration: time.Hour,
+			IgnoreOlderUseMtime: true,
+		},
+		Config: &config.HarvesterConfig{
+			BackoffDuration:         time.Millisecond,
+			FutureMtimeSkewDuration: time.Minute,
+		},
+		file: fileSource{file},
+		done: make(chan struct{}),
+	}
+
+	// never older than ignore_older
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.Nil(t, err)
+
+	h.Config.SkipFutureFiles = true
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.Equal(t, StopReasonFutureFile, h.stopReason(err))
+
+	// within the allowed skew
+	h.Config.FutureMtimeSkewDuration = 3 * time.Hour
+	err = h.handleReadlineError(time.Now(), io.EOF)
+	assert.Nil(t, err)
+}
+
+func TestHarvestSkipNullPadding(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-null-padding")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// file extended, but content not written yet
+	file.WriteString("line 1\n\x00\x00\x00\x00")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:         1024,
+			BackoffDuration:    10 * time.Millisecond,
+			MaxBackoffDuration: 10 * time.Millisecond,
+			BackoffFactor:      1,
+			SkipNullPadding:    true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	go h.Harvest()
+	defer h.Stop()
+
+	event := <-spooler
+	assert.Equal(t, "line 1", *event.Text)
+
+	time.Sleep(50 * time.Millisecond)
+	file.WriteAt([]byte("abc\n"), 7)
+
+	select {
+	case event = <-spooler:
+		assert.Equal(t, "abc", *event.Text)
+		assert.Equal(t, int64(7), event.Offset)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for event")
+	}
+}
+
+func TestHarvestHeartbeat(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-heartbeat")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:                1024,
+			BackoffDuration:           10 * time.Millisecond,
+			MaxBackoffDuration:        10 * time.Millisecond,
+			BackoffFactor:             1,
+			HeartbeatIntervalDuration: 50 * time.Millisecond,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	go h.Harvest()
+	defer h.Stop()
+
+	event := <-spooler
+	assert.Equal(t, "line 1", *event.Text)
+	read := time.Now()
+
+	select {
+	case event = <-spooler:
+		assert.True(t, event.Heartbeat)
+		assert.Nil(t, event.Text)
+		assert.Equal(t, int64(7), event.Offset)
+		assert.True(t, time.Since(read) >= 40*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for heartbeat")
+	}
+}
+
+func TestHarvestSkipHeaderLines(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-header")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("time,level,message\n1,INFO,started\n2,INFO,stopped\n")
+
+	harvest := func(offset int64) ([]*input.FileEvent, int64) {
+		spooler := make(chan *input.FileEvent, 3)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:      1024,
+				CloseEOF:        true,
+				SkipHeaderLines: 1,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+		h.Offset = offset
+
+		h.Harvest()
+		close(spooler)
+
+		var events []*input.FileEvent
+		for event := range spooler {
+			events = append(events, event)
+		}
+		return events, h.Offset
+	}
+
+	// fresh open skips the header
+	events, offset := harvest(0)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "1,INFO,started", *events[0].Text)
+	assert.Equal(t, int64(19), events[0].Offset)
+	assert.Equal(t, "2,INFO,stopped", *events[1].Text)
+	assert.Equal(t, int64(49), offset)
+
+	// resume from the offset of the second line does not skip it
+	events, offset = harvest(34)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "2,INFO,stopped", *events[0].Text)
+	assert.Equal(t, int64(49), offset)
+}
+
+func TestHarvestSequence(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-sequence")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:  1024,
+			CloseEOF:    true,
+			AddSequence: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	file.WriteString("line 1\nline 2\n")
+	h.Harvest()
+
+	// sequence continues when the file is opened again by the same harvester
+	file.WriteString("line 3\n")
+	h.Harvest()
+	close(spooler)
+
+	var sequence []uint64
+	for event := range spooler {
+		sequence = append(sequence, event.Sequence)
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, sequence)
+}
+
+func TestHarvestEndOffset(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-end-offset")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 22\r\nline 3\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:   1024,
+			CloseEOF:     true,
+			AddEndOffset: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var ranges [][2]int64
+	for event := range spooler {
+		ranges = append(ranges, [2]int64{event.Offset, event.EndOffset})
+	}
+	assert.Equal(t, [][2]int64{{0, 7}, {7, 16}, {16, 23}}, ranges)
+}
+
+func TestHarvestTrim(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-trim")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("\x01line 1;\n\x01;\n\x01line 2;\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:     1024,
+			CloseEOF:       true,
+			TrimPrefix:     "\x01",
+			TrimSuffix:     ";",
+			DropEmptyLines: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "line 1", *events[0].Text)
+	assert.Equal(t, "line 2", *events[1].Text)
+	assert.Equal(t, int64(12), events[1].Offset)
+
+	// offset covers the trimmed bytes
+	assert.Equal(t, int64(21), h.Offset)
+}
+
+func TestHarvestAddEncoding(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-encoding")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// "line 1\n" in UTF-16LE with BOM
+	file.Write([]byte{0xff, 0xfe, 'l', 0, 'i', 0, 'n', 0, 'e', 0, ' ', 0, '1', 0, '\n', 0})
+
+	spooler := make(chan *input.FileEvent, 1)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:  1024,
+			CloseEOF:    true,
+			Encoding:    "auto",
+			AddEncoding: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	event := <-spooler
+	if assert.NotNil(t, event) {
+		assert.Equal(t, "line 1", *event.Text)
+		assert.Equal(t, "utf-16le", event.Encoding)
+	}
+}
+
+func TestHarvestRawBytes(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-raw-bytes")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// invalid UTF-8, a multiline event, a dropped line and a line without line ending
+	file.Write([]byte("a\xff\r\nfirst\n  second\nDROP\nlast"))
+
+	harvest := func(mode string) []*input.FileEvent {
+		spooler := make(chan *input.FileEvent, 5)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:          1024,
+				CloseEOF:            true,
+				FlushPartialOnClose: true,
+				Encoding:            "utf-8",
+				ExcludeLines:        []string{"^DROP"},
+				RawBytes:            mode,
+				Multiline: &config.MultilineConfig{
+					Pattern:         `^[[:space:]]`,
+					Match:           "after",
+					TimeoutDuration: time.Hour,
+				},
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+		close(spooler)
+
+		var events []*input.FileEvent
+		for event := range spooler {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	events := harvest(config.RawBytesAdd)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "a\ufffd", *events[0].Text)
+	assert.Equal(t, []byte("a\xff\r\n"), events[0].RawBytes)
+	assert.Equal(t, "first\n  second", *events[1].Text)
+	assert.Equal(t, []byte("first\n  second\n"), events[1].RawBytes)
+	assert.Equal(t, []byte("last"), events[2].RawBytes)
+
+	events = harvest(config.RawBytesReplace)
+	assert.Equal(t, 3, len(events))
+	assert.Nil(t, events[0].Text)
+	assert.Equal(t, []byte("a\xff\r\n"), events[0].RawBytes)
+}
+
+func TestHarvestDedup(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-dedup")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("a\na\na\nb\nb\nc\n")
+
+	harvest := func(maxLines int) []*input.FileEvent {
+		spooler := make(chan *input.FileEvent, 6)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:          1024,
+				CloseEOF:            true,
+				DedupWindowDuration: time.Hour,
+				DedupMaxLines:       maxLines,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+		close(spooler)
+
+		// offset advanced past all suppressed lines
+		assert.Equal(t, int64(12), h.Offset)
+
+		var events []*input.FileEvent
+		for event := range spooler {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	events := harvest(0)
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "a", *events[0].Text)
+	assert.Equal(t, 3, events[0].RepeatCount)
+	assert.Equal(t, 6, events[0].Bytes)
+	assert.Equal(t, "b", *events[1].Text)
+	assert.Equal(t, int64(6), events[1].Offset)
+	assert.Equal(t, 2, events[1].RepeatCount)
+	assert.Equal(t, "c", *events[2].Text)
+	assert.Equal(t, 0, events[2].RepeatCount)
+
+	events = harvest(2)
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, 2, events[0].RepeatCount)
+	assert.Equal(t, "a", *events[1].Text)
+	assert.Equal(t, 0, events[1].RepeatCount)
+	assert.Equal(t, int64(4), events[1].Offset)
+}
+
+func TestHarvestMaxPartialBytes(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-partial")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nabcdefghij")
+
+	harvest := func(maxPartialBytes int) ([]*input.FileEvent, int64) {
+		spooler := make(chan *input.FileEvent, 2)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:      1024,
+				CloseEOF:        true,
+				MaxPartialBytes: maxPartialBytes,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+		close(spooler)
+
+		var events []*input.FileEvent
+		for event := range spooler {
+			events = append(events, event)
+		}
+		return events, h.Offset
+	}
+
+	// incomplete line below the limit is not published
+	events, offset := harvest(16)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, int64(7), offset)
+
+	events, offset = harvest(8)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "abcdefghij", *events[1].Text)
+	assert.Equal(t, int64(7), events[1].Offset)
+	assert.True(t, events[1].Unterminated)
+	assert.Equal(t, int64(17), offset)
+}
+
+func TestHarvestPartialLinePolicy(t *testing.T) {
+	harvest := func(policy string) (*Harvester, *os.File, chan *input.FileEvent) {
+		file, err := ioutil.TempFile("", "filebeat-partial-policy")
+		if err != nil {
+			t.Fatalf("Error creating temp file: %v", err)
+		}
+		file.WriteString("line 1\npart")
+
+		spooler := make(chan *input.FileEvent, 4)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:                 1024,
+				BackoffDuration:            time.Millisecond,
+				MaxBackoffDuration:         time.Millisecond,
+				BackoffFactor:              1,
+				PartialLineWaitingDuration: 20 * time.Millisecond,
+				PartialLinePollDuration:    time.Millisecond,
+				PartialLinePolicy:          policy,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		go h.Harvest()
+		return h, file, spooler
+	}
+
+	receive := func(spooler chan *input.FileEvent, text string, offset int64) *input.FileEvent {
+		select {
+		case event := <-spooler:
+			assert.Equal(t, text, *event.Text)
+			assert.Equal(t, offset, event.Offset)
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for %s", text)
+			return nil
+		}
+	}
+
+	// emit: the incomplete line is published flagged as partial, and again
+	// once completed
+	h, file, spooler := harvest(config.PartialLinePolicyEmit)
+	receive(spooler, "line 1", 0)
+	assert.True(t, receive(spooler, "part", 7).IsPartial)
+	file.WriteString("ial\n")
+	assert.False(t, receive(spooler, "partial", 7).IsPartial)
+	h.Stop()
+	file.Close()
+	os.Remove(file.Name())
+
+	// discard: the incomplete line is dropped, the rest is a line of its own
+	h, file, spooler = harvest(config.PartialLinePolicyDiscard)
+	receive(spooler, "line 1", 0)
+	for i := 0; h.Stats().Discarded == 0; i++ {
+		if i > 500 {
+			t.Fatal("Incomplete line not discarded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	file.WriteString("ial\n")
+	assert.False(t, receive(spooler, "ial", 11).IsPartial)
+	assert.Equal(t, uint64(1), h.Stats().Discarded)
+	h.Stop()
+	file.Close()
+	os.Remove(file.Name())
+
+	// wait_forever: the line is only published once completed
+	h, file, spooler = harvest(config.PartialLinePolicyWaitForever)
+	receive(spooler, "line 1", 0)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, len(spooler))
+	file.WriteString("ial\n")
+	assert.False(t, receive(spooler, "partial", 7).IsPartial)
+	h.Stop()
+	file.Close()
+	os.Remove(file.Name())
+}
+
+func TestHarvestDropLinesOver(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-drop-lines-over")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("short\n" + strings.Repeat("x", 100) + "\nafter\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:    1024,
+			CloseEOF:      true,
+			MaxBytes:      50,
+			DropLinesOver: 10,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+
+	// no truncated event for the long line
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "short", *events[0].Text)
+	assert.Equal(t, "after", *events[1].Text)
+	assert.Equal(t, int64(107), events[1].Offset)
+	assert.Equal(t, int64(113), h.Offset)
+}
+
+func TestHarvestFieldTemplates(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-field-templates")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize: 1024,
+			CloseEOF:   true,
+			Fields: map[string]string{
+				"dir":    "%{source|dir}",
+				"offset": "%{offset}",
+				"level":  "debug",
+			},
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, filepath.Dir(file.Name()), (*events[0].Fields)["dir"])
+	assert.Equal(t, "0", (*events[0].Fields)["offset"])
+	assert.Equal(t, "7", (*events[1].Fields)["offset"])
+	assert.Equal(t, "debug", (*events[1].Fields)["level"])
+}
+
+func TestHarvestCompressTextOver(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-compress-text")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	long := strings.Repeat("0123456789", 10)
+	file.WriteString("short\n" + long + "\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:       1024,
+			CloseEOF:         true,
+			CompressTextOver: 10,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "short", *events[0].Text)
+	assert.Equal(t, "", events[0].TextEncoding)
+
+	assert.Equal(t, input.TextEncodingGzipBase64, events[1].TextEncoding)
+	data, err := base64.StdEncoding.DecodeString(*events[1].Text)
+	assert.Nil(t, err)
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	text, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, long, string(text))
+
+	// offset covers the uncompressed line
+	assert.Equal(t, int64(107), h.Offset)
+}
+
+func TestHarvestEmptyFileTimeout(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-empty-file")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	spooler := make(chan *input.FileEvent, 1)
+	stat := NewFileStat(nil, 0)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:               1024,
+			BackoffDuration:          10 * time.Millisecond,
+			MaxBackoffDuration:       10 * time.Millisecond,
+			BackoffFactor:            1,
+			EmptyFileTimeoutDuration: 50 * time.Millisecond,
+		},
+		file.Name(), stat, spooler)
+	assert.Nil(t, err)
+
+	var reason string
+	h.Lifecycle = func(event LifecycleEvent) {
+		reason = event.Reason
+	}
+
+	// stops while the file is still empty and returns offset 0 to resume at
+	h.Harvest()
+	assert.Equal(t, StopReasonEmptyFile, reason)
+	assert.Equal(t, 0, len(spooler))
+	assert.Equal(t, int64(0), <-stat.Return)
+}
+
+func TestHarvestTee(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-tee")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	lines := []string{"line 1", "line 2", "line 3", "line 4"}
+	file.WriteString(strings.Join(lines, "\n") + "\n")
+
+	spooler := make(chan *input.FileEvent, len(lines))
+	tee := make(chan *input.FileEvent, len(lines))
+	slowTee := make(chan *input.FileEvent)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize: 1024,
+			CloseEOF:   true,
+		},
+		file.Name(), nil, spooler, tee, slowTee)
+	assert.Nil(t, err)
+
+	// the slow secondary spooler blocks all spoolers, but misses no events
+	var slow []*input.FileEvent
+	done := make(chan struct{})
+	go func() {
+		for event := range slowTee {
+			time.Sleep(10 * time.Millisecond)
+			slow = append(slow, event)
+		}
+		close(done)
+	}()
+
+	h.Harvest()
+	close(spooler)
+	close(tee)
+	close(slowTee)
+	<-done
+
+	var events, teeEvents []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+	for event := range tee {
+		teeEvents = append(teeEvents, event)
+	}
+
+	// all spoolers receive all events in order, each its own copy
+	for _, received := range [][]*input.FileEvent{events, teeEvents, slow} {
+		assert.Equal(t, len(lines), len(received))
+		for i, event := range received {
+			assert.Equal(t, lines[i], *event.Text)
+		}
+	}
+	assert.True(t, events[0] != teeEvents[0])
+	assert.Equal(t, events[3].Offset, slow[3].Offset)
+}
+
+func TestHarvestTeeDrop(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-tee-drop")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\nline 3\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	tee := make(chan *input.FileEvent, 1)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize: 1024,
+			CloseEOF:   true,
+			TeePolicy:  config.TeePolicyDrop,
+		},
+		file.Name(), nil, spooler, tee)
+	assert.Nil(t, err)
+
+	// the full secondary spooler misses events, the spooler gets all of them
+	h.Harvest()
+	assert.Equal(t, 3, len(spooler))
+	assert.Equal(t, 1, len(tee))
+	assert.Equal(t, "line 1", *(<-tee).Text)
+	assert.Equal(t, uint64(2), h.Stats().TeeDropped)
+	assert.Equal(t, int64(21), h.Offset)
+}
+
+func TestHarvestStartReason(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-start-reason")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	tests := []struct {
+		offset      int64
+		tailLines   int
+		startOffset int64
+		reason      string
+		events      int
+	}{
+		{0, 0, 0, StartReasonBeginning, 2},
+		{7, 0, 0, StartReasonResume, 1},
+		{100, 0, 0, StartReasonReset, 2},
+		{0, 1, 0, StartReasonTail, 1},
+		{0, 0, 7, StartReasonStartOffset, 1},
+	}
+
+	for _, test := range tests {
+		spooler := make(chan *input.FileEvent, 2)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:     1024,
+				CloseEOF:       true,
+				TailLines:      test.tailLines,
+				StartOffset:    test.startOffset,
+				AddStartReason: true,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+		h.Offset = test.offset
+
+		var started LifecycleEvent
+		h.Lifecycle = func(event LifecycleEvent) {
+			if event.Type == LifecycleStarted {
+				started = event
+			}
+		}
+
+		h.Harvest()
+		close(spooler)
+
+		assert.Equal(t, test.reason, started.Reason)
+		assert.Equal(t, test.events, len(spooler))
+		for event := range spooler {
+			assert.Equal(t, test.reason, event.StartReason)
+		}
+	}
+}
+
+func TestHarvestSampleRate(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-sample")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	for i := 0; i < 1000; i++ {
+		file.WriteString("debug line\n")
+	}
+
+	harvest := func() ([]int64, int64) {
+		spooler := make(chan *input.FileEvent, 1000)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:          1024,
+				CloseEOF:            true,
+				SampleRate:          10,
+				SampleDeterministic: true,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+		close(spooler)
+
+		var offsets []int64
+		for event := range spooler {
+			assert.Equal(t, 10, event.SampleRate)
+			offsets = append(offsets, event.Offset)
+		}
+		return offsets, h.Offset
+	}
+
+	offsets, offset := harvest()
+	assert.True(t, len(offsets) > 50 && len(offsets) < 150, "sent %d of 1000", len(offsets))
+
+	// offset advances past sampled out lines
+	assert.Equal(t, int64(11000), offset)
+
+	// the same lines are sent when reading the file again
+	again, _ := harvest()
+	assert.Equal(t, offsets, again)
+}
+
+func TestHarvestOrder(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-order")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	for i := 0; i < 1000; i++ {
+		file.WriteString("line " + strconv.Itoa(i) + "\n")
+	}
+
+	// small spooler, so sending blocks while lines are read quickly
+	spooler := make(chan *input.FileEvent, 4)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize: 1024,
+			CloseEOF:   true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	go func() {
+		h.Harvest()
+		close(spooler)
+	}()
+
+	i := 0
+	offset := int64(-1)
+	for event := range spooler {
+		assert.Equal(t, "line "+strconv.Itoa(i), *event.Text)
+		assert.True(t, event.Offset > offset)
+		offset = event.Offset
+		i++
+	}
+	assert.Equal(t, 1000, i)
+}
+
+func TestHarvestOrderedDelivery(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-ordered-delivery")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 0\nline 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:      1024,
+			CloseEOF:        true,
+			OrderedDelivery: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		h.Harvest()
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		event := <-spooler
+		assert.Equal(t, "line "+strconv.Itoa(i), *event.Text)
+
+		// the next event is only sent after the ack
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, 0, len(spooler))
+		event.Ack()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Harvester did not finish")
+	}
+	assert.Equal(t, int64(21), h.Offset)
+}
+
+func TestHarvestOrderedDeliveryStop(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-ordered-delivery")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 0\nline 1\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:      1024,
+			CloseEOF:        true,
+			OrderedDelivery: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		h.Harvest()
+		close(done)
+	}()
+
+	// a harvester waiting for an ack can be stopped
+	<-spooler
+	h.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Harvester waiting for ack did not stop")
+	}
+	assert.Equal(t, 0, len(spooler))
+}
+
+func TestHarvestDropEmptyLines(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-empty-lines")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\n\n  \nline 2\n\n")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:          1024,
+			CloseEOF:            true,
+			DropEmptyLines:      true,
+			DropWhitespaceLines: true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "line 1", *events[0].Text)
+	assert.Equal(t, "line 2", *events[1].Text)
+	assert.Equal(t, int64(11), events[1].Offset)
+
+	// offset advances past the dropped lines at the end of the file
+	assert.Equal(t, int64(19), h.Offset)
+}
+
+func TestHarvestLineEnding(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-line-ending")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("unix\nwindows\r\nlast")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:          1024,
+			CloseEOF:            true,
+			FlushPartialOnClose: true,
+			AddLineEnding:       true,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	h.Harvest()
+	close(spooler)
+
+	var endings []string
+	for event := range spooler {
+		endings = append(endings, event.LineEnding)
+	}
+
+	// the unterminated last line has no line ending
+	assert.Equal(t, []string{"lf", "crlf", ""}, endings)
+}
+
+func TestLineEndingName(t *testing.T) {
+	assert.Equal(t, "lf", lineEndingName("\n"))
+	assert.Equal(t, "crlf", lineEndingName("\r\n"))
+	assert.Equal(t, "cr", lineEndingName("\r"))
+	assert.Equal(t, "delimiter", lineEndingName("\x00"))
+	assert.Equal(t, "", lineEndingName(""))
+}
+
+func TestHarvestMultilineResume(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-multiline-resume")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("first\n  a\nsecond\n  b\n")
+
+	harvester := func(offset int64, closeEOF bool, spooler chan *input.FileEvent) *Harvester {
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:         1024,
+				CloseEOF:           closeEOF,
+				BackoffDuration:    10 * time.Millisecond,
+				MaxBackoffDuration: 10 * time.Millisecond,
+				BackoffFactor:      1,
+				Multiline: &config.MultilineConfig{
+					Pattern:         `^[[:space:]]`,
+					Match:           "after",
+					TimeoutDuration: time.Hour,
+				},
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+		h.Offset = offset
+		return h
+	}
+
+	// stop while the second event is incomplete
+	spooler := make(chan *input.FileEvent, 2)
+	h := harvester(0, false, spooler)
+	done := make(chan struct{})
+	go func() {
+		h.Harvest()
+		close(done)
+	}()
+
+	event := <-spooler
+	assert.Equal(t, "first\n  a", *event.Text)
+	time.Sleep(50 * time.Millisecond)
+	h.Stop()
+	<-done
+
+	// offset points to the start of the incomplete event
+	assert.Equal(t, int64(10), h.Offset)
+
+	// restart reads the complete event again
+	spooler = make(chan *input.FileEvent, 2)
+	h = harvester(h.Offset, true, spooler)
+	h.Harvest()
+	close(spooler)
+
+	event = <-spooler
+	assert.Equal(t, "second\n  b", *event.Text)
+	assert.Equal(t, int64(10), event.Offset)
+	assert.Equal(t, int64(21), h.Offset)
+}
+
+func TestHarvestResumeOldFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-resume-old")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	// lines written while filebeat was not running, longer ago than ignore_older
+	file.WriteString("line 1\nline 2\nline 3\n")
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(file.Name(), old, old)
+
+	spooler := make(chan *input.FileEvent, 10)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour, IgnoreOlderUseMtime: true},
+		&config.HarvesterConfig{BufferSize: 1024},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	var reason string
+	h.Lifecycle = func(event LifecycleEvent) {
+		reason = event.Reason
+	}
+
+	// resume at the offset stored in the registry
+	h.Offset = 7
+	h.Harvest()
+	close(spooler)
+
+	// pending lines are read before ignore_older applies
+	var lines []string
+	for event := range spooler {
+		lines = append(lines, *event.Text)
+	}
+	assert.Equal(t, []string{"line 2", "line 3"}, lines)
+	assert.Equal(t, StopReasonIgnoreOlder, reason)
+	assert.Equal(t, int64(21), h.Offset)
+}
+
+func TestHarvestSkipFutureFiles(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-skip-future")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	harvest := func(modTime time.Time) []string {
+		os.Chtimes(file.Name(), modTime, modTime)
+
+		spooler := make(chan *input.FileEvent, 10)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:              1024,
+				CloseEOF:                true,
+				SkipFutureFiles:         true,
+				FutureMtimeSkewDuration: time.Minute,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+		close(spooler)
+
+		var lines []string
+		for event := range spooler {
+			lines = append(lines, *event.Text)
+		}
+		return lines
+	}
+
+	assert.Nil(t, harvest(time.Now().Add(time.Hour)))
+	assert.Equal(t, []string{"line 1", "line 2"}, harvest(time.Now().Add(30*time.Second)))
+}
+
+func TestHarvestMaxFileSize(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-max-file-size")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\nline 3\n")
+
+	harvest := func(maxSize, tail int64) []string {
+		spooler := make(chan *input.FileEvent, 10)
+		h, err := NewHarvester(
+			config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+			&config.HarvesterConfig{
+				BufferSize:      1024,
+				CloseEOF:        true,
+				MaxFileSize:     maxSize,
+				MaxFileSizeTail: tail,
+			},
+			file.Name(), nil, spooler)
+		assert.Nil(t, err)
+
+		h.Harvest()
+		close(spooler)
+
+		var lines []string
+		for event := range spooler {
+			lines = append(lines, *event.Text)
+		}
+		return lines
+	}
+
+	assert.Equal(t, []string{"line 1", "line 2", "line 3"}, harvest(21, 0))
+	assert.Nil(t, harvest(20, 0))
+
+	// tail starting at a line
+	assert.Equal(t, []string{"line 2", "line 3"}, harvest(20, 14))
+
+	// incomplete first line of the tail is dropped
+	assert.Equal(t, []string{"line 3"}, harvest(20, 10))
+}
+
+func TestHarvestFollowRenamed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-follow-renamed")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("line 1\n"), 0644))
+
+	spooler := make(chan *input.FileEvent, 10)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:         1024,
+			FollowRenamed:      true,
+			BackoffDuration:    10 * time.Millisecond,
+			MaxBackoffDuration: 10 * time.Millisecond,
+			BackoffFactor:      1,
+			CloseOlderDuration: 300 * time.Millisecond,
+		},
+		path, nil, spooler)
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		h.Harvest()
+		close(done)
+	}()
+
+	event := <-spooler
+	assert.Equal(t, "line 1", *event.Text)
+
+	// rotate and write to the renamed file
+	renamed := filepath.Join(dir, "app.log.1")
+	assert.Nil(t, os.Rename(path, renamed))
+	assert.Nil(t, ioutil.WriteFile(path, []byte("new file\n"), 0644))
+	time.Sleep(100 * time.Millisecond)
+
+	file, err := os.OpenFile(renamed, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	file.WriteString("line 2\n")
+	file.Close()
+
+	// harvester stops after close_older
+	<-done
+	close(spooler)
+
+	event2 := <-spooler
+	assert.Equal(t, "line 2", *event2.Text)
+	assert.Equal(t, renamed, *event2.Source)
+	assert.Equal(t, int64(7), event2.Offset)
+
+	// source of events sent before the rename is not changed
+	assert.Equal(t, path, *event.Source)
+}
+
+// TestHarvestFollowRenamedStats takes snapshots while the path changes, to be
+// checked for data races with -race.
+func TestHarvestFollowRenamedStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-follow-renamed")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("line 1\n"), 0644))
+
+	spooler := make(chan *input.FileEvent, 10)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:         1024,
+			FollowRenamed:      true,
+			BackoffDuration:    10 * time.Millisecond,
+			MaxBackoffDuration: 10 * time.Millisecond,
+			BackoffFactor:      1,
+		},
+		path, nil, spooler)
+	assert.Nil(t, err)
+	assert.Equal(t, path, h.Stats().Path)
+
+	go h.Harvest()
+	defer h.Stop()
+	<-spooler
+
+	renamed := filepath.Join(dir, "app.log.1")
+	assert.Nil(t, os.Rename(path, renamed))
+	assert.Nil(t, ioutil.WriteFile(path, []byte("new file\n"), 0644))
+
+	timeout := time.After(5 * time.Second)
+	for h.Stats().Path != renamed {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for renamed path")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestHarvestCloseTimeout(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-close-timeout")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\npart")
+
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:           1024,
+			BackoffDuration:      10 * time.Millisecond,
+			MaxBackoffDuration:   10 * time.Millisecond,
+			BackoffFactor:        1,
+			CloseTimeoutDuration: 100 * time.Millisecond,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	var reason string
+	h.Lifecycle = func(event LifecycleEvent) {
+		reason = event.Reason
+	}
+
+	// stops although the file is still active
+	h.Harvest()
+	assert.Equal(t, StopReasonCloseTimeout, reason)
+	assert.Equal(t, 2, len(spooler))
+	assert.Equal(t, int64(14), h.Offset)
+
+	// the incomplete line is read by the next harvester
+	file.WriteString("ial\n")
+	h, err = NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{BufferSize: 1024, CloseEOF: true},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+	h.Offset = 14
+
+	h.Harvest()
+	close(spooler)
+
+	var events []*input.FileEvent
+	for event := range spooler {
+		events = append(events, event)
+	}
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "partial", *events[2].Text)
+	assert.Equal(t, int64(14), events[2].Offset)
+}
+
+func TestHarvestPublishErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-publish-errors")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	spooler := make(chan *input.FileEvent, 10)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{BufferSize: 1024, PublishErrors: true},
+		dir, nil, spooler)
+	assert.Nil(t, err)
+
+	// directories are rejected on open
+	h.Harvest()
+	close(spooler)
+
+	event := <-spooler
+	assert.NotNil(t, event)
+	assert.Equal(t, dir, *event.Source)
+	assert.Equal(t, "Given file is not a regular file.", event.Error)
+	assert.Equal(t, event.Error, *event.Text)
+	assert.Nil(t, <-spooler)
 }
@@ -0,0 +1,233 @@
+package harvester
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OtherSource is the source label of the metrics of all sources beyond the
+// maximum number of sources tracked.
+const OtherSource = "_other"
+
+// Upper bounds in seconds of the buckets of the backoff histogram
+var backoffBuckets = []float64{0.01, 0.1, 0.5, 1, 2, 5, 10, 30, 60}
+
+// Metrics collects the metrics of all harvesters labeled by prospector and
+// source, and exposes them in the Prometheus text format. The number of
+// sources is bounded, so harvesting many short lived files does not grow the
+// number of series without limit.
+type Metrics struct {
+	maxSources int
+
+	mutex   sync.Mutex
+	sources map[metricsKey]*SourceMetrics
+	count   map[string]int // number of sources tracked per prospector
+}
+
+type metricsKey struct {
+	prospector, source string
+}
+
+// SourceMetrics are the metrics of the harvesters of one source. All methods
+// can be called on nil, so harvesters without metrics need no checks.
+type SourceMetrics struct {
+	open           int64
+	linesRead      uint64
+	bytesRead      uint64
+	spoolerBlocked int64 // nanoseconds
+
+	mutex         sync.Mutex
+	backoffCounts []uint64 // per bucket of backoffBuckets, the last one is +Inf
+	backoffSum    float64
+}
+
+// NewMetrics creates the metrics for up to maxSources sources per prospector.
+// Harvesters of further sources are counted with the source label OtherSource.
+// A maxSources of 0 does not limit the number of sources.
+func NewMetrics(maxSources int) *Metrics {
+	return &Metrics{
+		maxSources: maxSources,
+		sources:    map[metricsKey]*SourceMetrics{},
+		count:      map[string]int{},
+	}
+}
+
+// Source returns the metrics of source harvested by prospector. Returns nil if
+// m is nil.
+func (m *Metrics) Source(prospector, source string) *SourceMetrics {
+	if m == nil {
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := metricsKey{prospector, source}
+	if s, ok := m.sources[key]; ok {
+		return s
+	}
+	if m.maxSources > 0 && m.count[prospector] >= m.maxSources {
+		key.source = OtherSource
+		if s, ok := m.sources[key]; ok {
+			return s
+		}
+	} else {
+		m.count[prospector]++
+	}
+
+	s := &SourceMetrics{backoffCounts: make([]uint64, len(backoffBuckets)+1)}
+	m.sources[key] = s
+	return s
+}
+
+func (s *SourceMetrics) harvesterStarted() {
+	if s != nil {
+		atomic.AddInt64(&s.open, 1)
+	}
+}
+
+func (s *SourceMetrics) harvesterStopped() {
+	if s != nil {
+		atomic.AddInt64(&s.open, -1)
+	}
+}
+
+func (s *SourceMetrics) lineRead(bytes int) {
+	if s != nil {
+		atomic.AddUint64(&s.linesRead, 1)
+		atomic.AddUint64(&s.bytesRead, uint64(bytes))
+	}
+}
+
+func (s *SourceMetrics) spoolerBlockedFor(d time.Duration) {
+	if s != nil {
+		atomic.AddInt64(&s.spoolerBlocked, int64(d))
+	}
+}
+
+// backedOff records a backoff of d in the histogram
+func (s *SourceMetrics) backedOff(d time.Duration) {
+	if s == nil {
+		return
+	}
+
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(backoffBuckets, seconds)
+
+	s.mutex.Lock()
+	s.backoffCounts[i]++
+	s.backoffSum += seconds
+	s.mutex.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Write(w)
+}
+
+// Write writes the metrics of all sources in the Prometheus text format,
+// sorted by prospector and source.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mutex.Lock()
+	keys := make([]metricsKey, 0, len(m.sources))
+	for key := range m.sources {
+		keys = append(keys, key)
+	}
+	m.mutex.Unlock()
+
+	sort.Sort(metricsKeys(keys))
+
+	families := []struct {
+		name, typ, help string
+		value           func(*SourceMetrics) float64
+	}{
+		{"filebeat_harvester_open", "gauge", "Number of running harvesters.",
+			func(s *SourceMetrics) float64 { return float64(atomic.LoadInt64(&s.open)) }},
+		{"filebeat_harvester_lines_read_total", "counter", "Number of lines read.",
+			func(s *SourceMetrics) float64 { return float64(atomic.LoadUint64(&s.linesRead)) }},
+		{"filebeat_harvester_bytes_read_total", "counter", "Number of bytes read.",
+			func(s *SourceMetrics) float64 { return float64(atomic.LoadUint64(&s.bytesRead)) }},
+		{"filebeat_harvester_spooler_blocked_seconds_total", "counter", "Time harvesters were blocked sending events to the spooler.",
+			func(s *SourceMetrics) float64 { return time.Duration(atomic.LoadInt64(&s.spoolerBlocked)).Seconds() }},
+	}
+
+	ew := &errWriter{w: w}
+	for _, f := range families {
+		fmt.Fprintf(ew, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, key := range keys {
+			fmt.Fprintf(ew, "%s{%s} %v\n", f.name, key.labels(), f.value(m.source(key)))
+		}
+	}
+
+	const backoff = "filebeat_harvester_backoff_seconds"
+	fmt.Fprintf(ew, "# HELP %s Backoff durations after reaching the end of a file.\n# TYPE %s histogram\n", backoff, backoff)
+	for _, key := range keys {
+		s := m.source(key)
+		s.mutex.Lock()
+		var count uint64
+		for i, n := range s.backoffCounts {
+			count += n
+			le := math.Inf(1)
+			if i < len(backoffBuckets) {
+				le = backoffBuckets[i]
+			}
+			fmt.Fprintf(ew, "%s_bucket{%s,le=\"%v\"} %d\n", backoff, key.labels(), le, count)
+		}
+		fmt.Fprintf(ew, "%s_sum{%s} %v\n", backoff, key.labels(), s.backoffSum)
+		fmt.Fprintf(ew, "%s_count{%s} %d\n", backoff, key.labels(), count)
+		s.mutex.Unlock()
+	}
+	return ew.err
+}
+
+func (m *Metrics) source(key metricsKey) *SourceMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.sources[key]
+}
+
+// labels formats the labels of key, escaping the label values
+func (k metricsKey) labels() string {
+	return fmt.Sprintf(`prospector="%s",source="%s"`, escapeLabel(k.prospector), escapeLabel(k.source))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+type metricsKeys []metricsKey
+
+func (k metricsKeys) Len() int      { return len(k) }
+func (k metricsKeys) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k metricsKeys) Less(i, j int) bool {
+	if k[i].prospector != k[j].prospector {
+		return k[i].prospector < k[j].prospector
+	}
+	return k[i].source < k[j].source
+}
+
+// errWriter keeps the first write error, so formatting can continue
+// unchecked.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
@@ -0,0 +1,96 @@
+package harvester
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSources(t *testing.T) {
+	m := NewMetrics(1)
+
+	a := m.Source("0", "/var/log/a.log")
+	assert.True(t, a == m.Source("0", "/var/log/a.log"))
+
+	// further sources are counted as other
+	other := m.Source("0", "/var/log/b.log")
+	assert.True(t, other != a)
+	assert.True(t, other == m.Source("0", "/var/log/c.log"))
+	assert.True(t, other == m.sources[metricsKey{"0", OtherSource}])
+
+	// limited per prospector
+	assert.True(t, other != m.Source("1", "/var/log/b.log"))
+
+	// harvesters without metrics
+	var none *Metrics
+	s := none.Source("0", "/var/log/a.log")
+	assert.Nil(t, s)
+	s.lineRead(10)
+	s.backedOff(time.Second)
+}
+
+func TestMetricsWrite(t *testing.T) {
+	m := NewMetrics(0)
+	s := m.Source("0", `/var/log/"a".log`)
+	s.harvesterStarted()
+	s.lineRead(10)
+	s.lineRead(5)
+	s.spoolerBlockedFor(1500 * time.Millisecond)
+	s.backedOff(time.Second)
+	s.backedOff(2 * time.Minute)
+
+	var buf bytes.Buffer
+	assert.Nil(t, m.Write(&buf))
+	out := buf.String()
+
+	labels := `prospector="0",source="/var/log/\"a\".log"`
+	for _, line := range []string{
+		"# TYPE filebeat_harvester_open gauge",
+		"filebeat_harvester_open{" + labels + "} 1",
+		"filebeat_harvester_lines_read_total{" + labels + "} 2",
+		"filebeat_harvester_bytes_read_total{" + labels + "} 15",
+		"filebeat_harvester_spooler_blocked_seconds_total{" + labels + "} 1.5",
+		"# TYPE filebeat_harvester_backoff_seconds histogram",
+		"filebeat_harvester_backoff_seconds_bucket{" + labels + `,le="0.5"} 0`,
+		"filebeat_harvester_backoff_seconds_bucket{" + labels + `,le="1"} 1`,
+		"filebeat_harvester_backoff_seconds_bucket{" + labels + `,le="60"} 1`,
+		"filebeat_harvester_backoff_seconds_bucket{" + labels + `,le="+Inf"} 2`,
+		"filebeat_harvester_backoff_seconds_sum{" + labels + "} 121",
+		"filebeat_harvester_backoff_seconds_count{" + labels + "} 2",
+	} {
+		assert.True(t, strings.Contains(out, line+"\n"), line)
+	}
+}
+
+func TestHarvestMetrics(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-metrics")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\nline 2\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{BufferSize: 1024, CloseEOF: true},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	m := NewMetrics(0)
+	h.Metrics = m.Source("0", h.Source)
+	h.Harvest()
+
+	assert.Equal(t, int64(0), h.Metrics.open)
+	assert.Equal(t, uint64(2), h.Metrics.linesRead)
+	assert.Equal(t, uint64(14), h.Metrics.bytesRead)
+}
@@ -0,0 +1,171 @@
+package harvester
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+)
+
+// multiline combines consecutive lines belonging to the same logical event
+// (e.g. stack traces) into one event. Whether a line is part of the current
+// event is decided by matching the line against the configured pattern.
+// Without pattern, up to maxLines lines are batched into one event
+// regardless of their content.
+type multiline struct {
+	pattern  *regexp.Regexp
+	negate   bool
+	before   bool // match: before -> matching lines are continued by the next line
+	maxLines int  // batch_lines
+	timeout  time.Duration
+	sep      string // multiline.separator
+
+	lines     []string
+	bytes     int
+	firstLine time.Time // time the first line was added to the current event
+	lastLine  time.Time // last time a line was added to the current event
+}
+
+// indentPattern matches continuation lines in mode indent
+var indentPattern = regexp.MustCompile(`^[ \t]`)
+
+func newMultiline(cfg *config.MultilineConfig) (*multiline, error) {
+	sep := "\n"
+	if cfg.Separator != nil {
+		sep = *cfg.Separator
+	}
+
+	switch cfg.Mode {
+	case "", "pattern":
+	case "indent":
+		// lines starting with whitespace are appended to the previous line
+		if cfg.Pattern != "" {
+			return nil, fmt.Errorf("multiline.pattern can not be used with multiline.mode indent")
+		}
+		m := &multiline{
+			pattern: indentPattern,
+			timeout: cfg.TimeoutDuration,
+			sep:     sep,
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown multiline.mode('%v'), must be 'pattern' or 'indent'", cfg.Mode)
+	}
+
+	if cfg.Pattern == "" {
+		return nil, fmt.Errorf("multiline.pattern must be set")
+	}
+
+	if err := config.CompileRegexp("multiline.pattern", &cfg.PatternRegexp, cfg.Pattern); err != nil {
+		return nil, err
+	}
+	pattern := cfg.PatternRegexp
+
+	var before bool
+	switch cfg.Match {
+	case "after":
+		before = false
+	case "before":
+		before = true
+	default:
+		return nil, fmt.Errorf("unknown multiline.match('%v'), must be 'before' or 'after'", cfg.Match)
+	}
+
+	m := &multiline{
+		pattern: pattern,
+		negate:  cfg.Negate,
+		before:  before,
+		timeout: cfg.TimeoutDuration,
+		sep:     sep,
+	}
+	return m, nil
+}
+
+// newBatch creates a multiline joining up to maxLines lines into one event.
+// Incomplete batches are published once timeout has passed since the first
+// line was added.
+func newBatch(maxLines int, timeout time.Duration) *multiline {
+	return &multiline{
+		maxLines: maxLines,
+		timeout:  timeout,
+		sep:      "\n",
+	}
+}
+
+// add adds a complete line of sz raw bytes to the current event. If adding the
+// line completes an event, the event text and the total number of raw bytes
+// it spans are returned.
+func (m *multiline) add(line string, sz int) (string, int, bool) {
+	if m.pattern == nil {
+		m.append(line, sz)
+		if len(m.lines) < m.maxLines {
+			return "", 0, false
+		}
+		return m.flush()
+	}
+
+	matches := m.pattern.MatchString(line) != m.negate
+
+	if m.before {
+		// matching lines are continued by the next line. A not matching line
+		// finishes the current event.
+		m.append(line, sz)
+		if matches {
+			return "", 0, false
+		}
+		return m.flush()
+	}
+
+	// match: after -> matching lines continue the current event. A not
+	// matching line starts a new event, finishing the current one.
+	if matches || len(m.lines) == 0 {
+		m.append(line, sz)
+		return "", 0, false
+	}
+
+	text, bytes, ok := m.flush()
+	m.append(line, sz)
+	return text, bytes, ok
+}
+
+func (m *multiline) append(line string, sz int) {
+	m.lastLine = time.Now()
+	if len(m.lines) == 0 {
+		m.firstLine = m.lastLine
+	}
+	m.lines = append(m.lines, line)
+	m.bytes += sz
+}
+
+// flush returns the current event and resets the internal state. Returns
+// false if no lines are buffered.
+func (m *multiline) flush() (string, int, bool) {
+	if len(m.lines) == 0 {
+		return "", 0, false
+	}
+
+	text := strings.Join(m.lines, m.sep)
+	bytes := m.bytes
+
+	m.lines = nil
+	m.bytes = 0
+	return text, bytes, true
+}
+
+// pending returns true if lines are buffered in the current event.
+func (m *multiline) pending() bool {
+	return len(m.lines) > 0
+}
+
+// timedOut returns true if lines are buffered and no new line has been added
+// for longer than the configured timeout. Batches time out once the timeout
+// has passed since their first line.
+func (m *multiline) timedOut() bool {
+	since := m.lastLine
+	if m.pattern == nil {
+		since = m.firstLine
+	}
+	return m.pending() && time.Since(since) >= m.timeout
+}
@@ -0,0 +1,199 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type multilineEvent struct {
+	text  string
+	bytes int
+}
+
+func addLines(m *multiline, lines []string) []multilineEvent {
+	var events []multilineEvent
+	for _, line := range lines {
+		text, sz, ok := m.add(line, len(line)+1)
+		if ok {
+			events = append(events, multilineEvent{text, sz})
+		}
+	}
+
+	if text, sz, ok := m.flush(); ok {
+		events = append(events, multilineEvent{text, sz})
+	}
+	return events
+}
+
+func TestMultilineAfter(t *testing.T) {
+	m, err := newMultiline(&config.MultilineConfig{
+		Pattern: `^[[:space:]]`,
+		Match:   "after",
+	})
+	assert.Nil(t, err)
+
+	events := addLines(m, []string{
+		"Exception in thread \"main\" java.lang.NullPointerException",
+		"        at com.example.myproject.Book.getTitle(Book.java:16)",
+		"        at com.example.myproject.Bootstrap.main(Bootstrap.java:14)",
+		"next event",
+	})
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "Exception in thread \"main\" java.lang.NullPointerException\n"+
+		"        at com.example.myproject.Book.getTitle(Book.java:16)\n"+
+		"        at com.example.myproject.Bootstrap.main(Bootstrap.java:14)", events[0].text)
+	assert.Equal(t, len(events[0].text)+1, events[0].bytes)
+	assert.Equal(t, "next event", events[1].text)
+}
+
+func TestMultilineBeforeNegate(t *testing.T) {
+	m, err := newMultiline(&config.MultilineConfig{
+		Pattern: `;$`,
+		Negate:  true,
+		Match:   "before",
+	})
+	assert.Nil(t, err)
+
+	events := addLines(m, []string{
+		"line 1",
+		"line 2;",
+		"line 3;",
+	})
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "line 1\nline 2;", events[0].text)
+	assert.Equal(t, "line 3;", events[1].text)
+}
+
+func TestMultilineIndent(t *testing.T) {
+	m, err := newMultiline(&config.MultilineConfig{Mode: "indent"})
+	assert.Nil(t, err)
+
+	events := addLines(m, []string{
+		"Traceback (most recent call last):",
+		"  File \"app.py\", line 3, in <module>",
+		"\tmain()",
+		"NameError: name 'main' is not defined",
+		"key:",
+		"    value",
+	})
+
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "Traceback (most recent call last):\n"+
+		"  File \"app.py\", line 3, in <module>\n"+
+		"\tmain()", events[0].text)
+	assert.Equal(t, "NameError: name 'main' is not defined", events[1].text)
+	assert.Equal(t, "key:\n    value", events[2].text)
+}
+
+func TestMultilineSeparator(t *testing.T) {
+	for _, sep := range []string{" ", " | ", ""} {
+		separator := sep
+		m, err := newMultiline(&config.MultilineConfig{
+			Mode:      "indent",
+			Separator: &separator,
+		})
+		assert.Nil(t, err)
+
+		events := addLines(m, []string{"key:", "  value 1", "  value 2", "next"})
+
+		assert.Equal(t, 2, len(events))
+		assert.Equal(t, "key:"+sep+"  value 1"+sep+"  value 2", events[0].text)
+		// bytes still count the raw lines including their line endings
+		assert.Equal(t, 5+10+10, events[0].bytes)
+		assert.Equal(t, "next", events[1].text)
+	}
+}
+
+func TestMultilineIndentTimeout(t *testing.T) {
+	m, err := newMultiline(&config.MultilineConfig{
+		Mode:            "indent",
+		TimeoutDuration: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	m.add("Traceback (most recent call last):", 35)
+	m.add("  File \"app.py\", line 3", 25)
+
+	// last event of a file is published after timeout
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, m.timedOut())
+
+	text, sz, ok := m.flush()
+	assert.True(t, ok)
+	assert.Equal(t, "Traceback (most recent call last):\n  File \"app.py\", line 3", text)
+	assert.Equal(t, 60, sz)
+}
+
+func TestMultilineTimeout(t *testing.T) {
+	m, err := newMultiline(&config.MultilineConfig{
+		Pattern:         `^[[:space:]]`,
+		Match:           "after",
+		TimeoutDuration: 10 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	_, _, ok := m.add("first", 6)
+	assert.False(t, ok)
+	assert.False(t, m.timedOut())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, m.timedOut())
+
+	text, sz, ok := m.flush()
+	assert.True(t, ok)
+	assert.Equal(t, "first", text)
+	assert.Equal(t, 6, sz)
+	assert.False(t, m.pending())
+}
+
+func TestMultilineInvalidConfig(t *testing.T) {
+	_, err := newMultiline(&config.MultilineConfig{Match: "after"})
+	assert.NotNil(t, err)
+
+	_, err = newMultiline(&config.MultilineConfig{Pattern: "(", Match: "after"})
+	assert.NotNil(t, err)
+
+	_, err = newMultiline(&config.MultilineConfig{Pattern: "^ ", Match: "around"})
+	assert.NotNil(t, err)
+
+	_, err = newMultiline(&config.MultilineConfig{Mode: "indent", Pattern: "^ "})
+	assert.NotNil(t, err)
+
+	_, err = newMultiline(&config.MultilineConfig{Mode: "block", Pattern: "^ ", Match: "after"})
+	assert.NotNil(t, err)
+}
+
+func TestBatch(t *testing.T) {
+	m := newBatch(3, time.Second)
+
+	events := addLines(m, []string{"a", "b", "c", "d", "e"})
+
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, "a\nb\nc", events[0].text)
+	assert.Equal(t, 6, events[0].bytes)
+	assert.Equal(t, "d\ne", events[1].text)
+	assert.Equal(t, 4, events[1].bytes)
+}
+
+func TestBatchTimeout(t *testing.T) {
+	m := newBatch(100, 30*time.Millisecond)
+
+	m.add("first", 6)
+	time.Sleep(20 * time.Millisecond)
+
+	// adding lines does not extend the batch timeout
+	m.add("second", 7)
+	assert.False(t, m.timedOut())
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, m.timedOut())
+
+	text, sz, ok := m.flush()
+	assert.True(t, ok)
+	assert.Equal(t, "first\nsecond", text)
+	assert.Equal(t, 13, sz)
+}
@@ -0,0 +1,75 @@
+package harvester
+
+import (
+	"sync"
+
+	"github.com/elastic/libbeat/logp"
+)
+
+// pauseGate blocks the read loop of a harvester while it is paused. Harvesters
+// not created by NewHarvester have no gate and are never paused.
+type pauseGate struct {
+	mutex  sync.Mutex
+	resume chan struct{} // closed by Resume, nil if not paused
+}
+
+// Pause stops the harvester from reading further lines until Resume is called,
+// e.g. to shed load by reading low priority files later. The file is kept open
+// and the offset is kept, so reading continues where it was paused. The line
+// being read when Pause is called is still sent.
+func (h *Harvester) Pause() {
+	if h.pause == nil {
+		return
+	}
+	h.pause.mutex.Lock()
+	defer h.pause.mutex.Unlock()
+	if h.pause.resume == nil {
+		h.pause.resume = make(chan struct{})
+	}
+}
+
+// Resume continues reading after Pause.
+func (h *Harvester) Resume() {
+	if h.pause == nil {
+		return
+	}
+	h.pause.mutex.Lock()
+	defer h.pause.mutex.Unlock()
+	if h.pause.resume != nil {
+		close(h.pause.resume)
+		h.pause.resume = nil
+	}
+}
+
+// Paused returns true if the harvester is paused.
+func (h *Harvester) Paused() bool {
+	if h.pause == nil {
+		return false
+	}
+	h.pause.mutex.Lock()
+	defer h.pause.mutex.Unlock()
+	return h.pause.resume != nil
+}
+
+// waitResumed blocks while the harvester is paused. Returns false if the
+// harvester is stopped while paused.
+func (h *Harvester) waitResumed() bool {
+	if h.pause == nil {
+		return true
+	}
+	h.pause.mutex.Lock()
+	resume := h.pause.resume
+	h.pause.mutex.Unlock()
+	if resume == nil {
+		return true
+	}
+
+	logp.Debug("harvester", "Harvester paused: %s", h.Path)
+	select {
+	case <-resume:
+		logp.Debug("harvester", "Harvester resumed: %s", h.Path)
+		return true
+	case <-h.done:
+		return false
+	}
+}
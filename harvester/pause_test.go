@@ -0,0 +1,85 @@
+package harvester
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvesterPause(t *testing.T) {
+	file, err := ioutil.TempFile("", "filebeat-pause")
+	if err != nil {
+		t.Fatalf("Error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	file.WriteString("line 1\n")
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:         1024,
+			BackoffDuration:    10 * time.Millisecond,
+			MaxBackoffDuration: 10 * time.Millisecond,
+			BackoffFactor:      1,
+		},
+		file.Name(), nil, spooler)
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		h.Harvest()
+		close(done)
+	}()
+
+	receive := func() *input.FileEvent {
+		select {
+		case event := <-spooler:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("No event received")
+			return nil
+		}
+	}
+	assert.Equal(t, "line 1", *receive().Text)
+
+	// no lines are read while paused
+	h.Pause()
+	assert.True(t, h.Paused())
+	time.Sleep(50 * time.Millisecond)
+	file.WriteString("line 2\n")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(spooler))
+
+	// reading continues at the offset paused at
+	h.Resume()
+	assert.False(t, h.Paused())
+	event := receive()
+	assert.Equal(t, "line 2", *event.Text)
+	assert.Equal(t, int64(7), event.Offset)
+
+	// paused harvesters can be stopped
+	h.Pause()
+	h.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Paused harvester did not stop")
+	}
+}
+
+func TestHarvesterPauseWithoutGate(t *testing.T) {
+	// harvesters not created by NewHarvester are never paused
+	h := &Harvester{}
+	h.Pause()
+	assert.False(t, h.Paused())
+	assert.True(t, h.waitResumed())
+	h.Resume()
+}
@@ -0,0 +1,118 @@
+// +build !windows
+
+package harvester
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-pipe")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pipe")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatalf("Error creating named pipe: %v", err)
+	}
+
+	// open read-write so opening the pipe for reading does not block
+	writer, err := os.OpenFile(path, os.O_RDWR, 0)
+	assert.Nil(t, err)
+	defer writer.Close()
+
+	h := &Harvester{
+		Path:     path,
+		Config:   &config.HarvesterConfig{},
+		encoding: encoding.Plain,
+		done:     make(chan struct{}),
+	}
+
+	// pipes are rejected by default
+	_, err = h.open()
+	assert.NotNil(t, err)
+
+	h.Config.AllowNonRegularFiles = true
+	h.Offset = 100
+	_, err = h.open()
+	assert.Nil(t, err)
+	defer h.file.Close()
+	assert.Equal(t, int64(0), h.Offset)
+	assert.True(t, h.file.Continuable())
+
+	writer.WriteString("line 1\n")
+	buf := make([]byte, 7)
+	_, err = io.ReadFull(h.file, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "line 1\n", string(buf))
+
+	// offset beyond size of pipe must not be handled as truncation
+	h.Offset = 7
+	truncated, err := h.checkTruncated()
+	assert.Nil(t, err)
+	assert.False(t, truncated)
+}
+
+func TestHarvestIdlePipeReadDeadline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-pipe")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pipe")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Fatalf("Error creating named pipe: %v", err)
+	}
+
+	writer, err := os.OpenFile(path, os.O_RDWR, 0)
+	assert.Nil(t, err)
+	defer writer.Close()
+
+	spooler := make(chan *input.FileEvent, 1)
+	h, err := NewHarvester(
+		config.ProspectorConfig{},
+		&config.HarvesterConfig{
+			BufferSize:           1024,
+			AllowNonRegularFiles: true,
+			ReadDeadlineDuration: 10 * time.Millisecond,
+		},
+		path, nil, spooler)
+	assert.Nil(t, err)
+
+	stopped := make(chan LifecycleEvent, 1)
+	h.Lifecycle = func(event LifecycleEvent) {
+		if event.Type == LifecycleStopped {
+			stopped <- event
+		}
+	}
+
+	go h.Harvest()
+	defer h.Stop()
+
+	// waiting for input longer than read_deadline does not stop the harvester
+	time.Sleep(50 * time.Millisecond)
+	writer.WriteString("line 1\n")
+
+	select {
+	case event := <-spooler:
+		assert.Equal(t, "line 1", *event.Text)
+	case event := <-stopped:
+		t.Fatalf("Harvester stopped: %v", event.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for event")
+	}
+}
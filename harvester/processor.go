@@ -0,0 +1,57 @@
+package harvester
+
+import (
+	"github.com/elastic/filebeat/config"
+)
+
+// LineProcessor processes the text of a line before the event is created.
+// A processor can modify the text or drop the line by returning false.
+type LineProcessor interface {
+	Process(line *string) (*string, bool)
+}
+
+// NewProcessors builds the chain of line processors configured in cfg. The
+// processors are applied in order: include_lines, exclude_lines, redact.
+func NewProcessors(cfg *config.HarvesterConfig) ([]LineProcessor, error) {
+	var processors []LineProcessor
+
+	err := config.CompileRegexps("include_lines", &cfg.IncludeLinesRegexp, cfg.IncludeLines)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.IncludeLinesRegexp) > 0 {
+		processors = append(processors, includeLines(cfg.IncludeLinesRegexp))
+	}
+
+	err = config.CompileRegexps("exclude_lines", &cfg.ExcludeLinesRegexp, cfg.ExcludeLines)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.ExcludeLinesRegexp) > 0 {
+		processors = append(processors, excludeLines(cfg.ExcludeLinesRegexp))
+	}
+
+	for i := range cfg.Redact {
+		processor, err := newRedactor(&cfg.Redact[i])
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, processor)
+	}
+
+	return processors, nil
+}
+
+// processLine applies all processors to text. Returns false if the line is
+// dropped by a processor.
+func (h *Harvester) processLine(text string) (string, bool) {
+	line := &text
+	for _, processor := range h.Processors {
+		var ok bool
+		line, ok = processor.Process(line)
+		if !ok {
+			return "", false
+		}
+	}
+	return *line, true
+}
@@ -0,0 +1,49 @@
+package harvester
+
+import (
+	"time"
+)
+
+// rateLimiter limits the number of events per second using a token bucket.
+// Up to one second worth of events can be sent in a burst.
+type rateLimiter struct {
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time // last time tokens were added
+}
+
+func newRateLimiter(eventsPerSecond int) *rateLimiter {
+	rate := float64(eventsPerSecond)
+	return &rateLimiter{
+		rate:   rate,
+		burst:  rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until the next event can be sent. Returns false if done is
+// closed while waiting.
+func (r *rateLimiter) wait(done <-chan struct{}) bool {
+	for {
+		now := time.Now()
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+		r.last = now
+
+		if r.tokens >= 1 {
+			r.tokens--
+			return true
+		}
+
+		delay := time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+		select {
+		case <-done:
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(50)
+
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		assert.True(t, limiter.wait(nil))
+	}
+
+	// burst of 50 events, 10 more events take 200ms
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+}
+
+func TestRateLimiterStopped(t *testing.T) {
+	limiter := newRateLimiter(1)
+	assert.True(t, limiter.wait(nil))
+
+	done := make(chan struct{})
+	close(done)
+	assert.False(t, limiter.wait(done))
+}
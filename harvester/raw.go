@@ -0,0 +1,36 @@
+package harvester
+
+// rawLine holds the raw bytes of a complete line read at offset until the
+// event containing the line is sent, if raw_bytes is set.
+type rawLine struct {
+	offset int64
+	bytes  []byte
+}
+
+// queueRaw records the raw bytes of the complete line starting at offset.
+// Lines before the current offset were dropped or sent and are removed.
+func (h *Harvester) queueRaw(offset int64, raw []byte) {
+	h.dropRaw(h.Offset)
+	h.rawLines = append(h.rawLines, rawLine{offset, raw})
+}
+
+// takeRaw returns the raw bytes of the lines from offset up to offset+size,
+// the lines of an event, and removes them.
+func (h *Harvester) takeRaw(offset int64, size int) []byte {
+	h.dropRaw(offset)
+
+	var raw []byte
+	end := offset + int64(size)
+	for len(h.rawLines) > 0 && h.rawLines[0].offset < end {
+		raw = append(raw, h.rawLines[0].bytes...)
+		h.rawLines = h.rawLines[1:]
+	}
+	return raw
+}
+
+// dropRaw removes the raw bytes of all lines before offset.
+func (h *Harvester) dropRaw(offset int64) {
+	for len(h.rawLines) > 0 && h.rawLines[0].offset < offset {
+		h.rawLines = h.rawLines[1:]
+	}
+}
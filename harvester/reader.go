@@ -2,6 +2,7 @@ package harvester
 
 import (
 	"io"
+	"sync"
 	"time"
 
 	"golang.org/x/text/encoding"
@@ -24,17 +25,43 @@ type lineReader struct {
 	rawInput   io.Reader
 	codec      encoding.Encoding
 	bufferSize int
+	maxBytes   int    // max number of raw bytes per line. Longer lines are truncated
+	maxPartial int    // max number of raw bytes of an incomplete line, if > 0
+	delimiter  []byte // decoded line delimiter
 
-	nl        []byte
+	nl        []byte // encoded line delimiter
+	cr        []byte // encoded carriage return, if a lone \r terminates lines
 	inBuffer  *streambuf.Buffer
-	outBuffer *streambuf.Buffer
-	inOffset  int // input buffer read offset
-	byteCount int // number of bytes decoded from input buffer into output buffer
-	decoder   transform.Transformer
+	line      []byte // decoded bytes of the current line, reused for all lines
+	inOffset  int    // input buffer read offset
+	byteCount int    // number of bytes decoded from input buffer into line buffer
+	decoder   *invalidDetector
+	skip      bool   // drop input until end of line, as line has been truncated
+	readBuf   []byte // buffer for reading from rawInput. Grows up to maxBytes
+	decodeBuf []byte
+	ending    string // line ending stripped from the last line returned
+
+	captureRaw bool   // keep the raw bytes of lines, e.g. for raw_bytes
+	raw        []byte // raw bytes decoded for the current line
+	lastRaw    []byte // raw bytes of the last line returned by next
+
+	lastInvalid bool // last line returned by next contains invalid byte sequences
 }
 
 const maxConsecutiveEmptyReads = 100
 
+// Line buffers of line readers no longer used are kept for reuse by new line
+// readers, e.g. of harvesters started for rotated files. Buffers grown by long
+// lines beyond maxPooledLineSize are left to the garbage collector.
+const maxPooledLineSize = 64 << 10
+
+var linePool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
 func newTimedReader(reader io.Reader) *timedReader {
 	r := &timedReader{
 		reader: reader,
@@ -65,10 +92,12 @@ func newLineReader(
 	input io.Reader,
 	codec encoding.Encoding,
 	bufferSize int,
+	maxBytes int,
+	delimiter string,
 ) (*lineReader, error) {
 	l := &lineReader{}
 
-	if err := l.init(input, codec, bufferSize); err != nil {
+	if err := l.init(input, codec, bufferSize, maxBytes, delimiter); err != nil {
 		return nil, err
 	}
 
@@ -79,60 +108,138 @@ func (l *lineReader) init(
 	input io.Reader,
 	codec encoding.Encoding,
 	bufferSize int,
+	maxBytes int,
+	delimiter string,
 ) error {
 	l.rawInput = input
 	l.codec = codec
 	l.bufferSize = bufferSize
+	l.maxBytes = maxBytes
+
+	if delimiter == "" {
+		delimiter = "\n"
+	}
+	l.delimiter = []byte(delimiter)
 
-	l.codec.NewEncoder()
-	nl, _, err := transform.Bytes(l.codec.NewEncoder(), []byte{'\n'})
+	nl, _, err := transform.Bytes(l.codec.NewEncoder(), l.delimiter)
 	if err != nil {
 		return err
 	}
 
 	l.nl = nl
-	l.decoder = l.codec.NewDecoder()
+	l.decoder = newInvalidDetector(l.codec)
+	l.readBuf = make([]byte, bufferSize)
+	l.decodeBuf = make([]byte, 1024)
 	l.inBuffer = streambuf.New(nil)
-	l.outBuffer = streambuf.New(nil)
+	l.line = (*linePool.Get().(*[]byte))[:0]
+	return nil
+}
+
+// release returns the line buffer for reuse by other line readers. The reader
+// must not be used afterwards.
+func (l *lineReader) release() {
+	if l.line != nil && cap(l.line) <= maxPooledLineSize {
+		buf := l.line[:0]
+		linePool.Put(&buf)
+	}
+	l.line = nil
+}
+
+// enableRaw keeps the raw input bytes of each line before decoding. Bytes
+// dropped as the line exceeds max_bytes are not kept.
+func (l *lineReader) enableRaw() {
+	l.captureRaw = true
+}
+
+// limitPartial makes readLine return incomplete lines as partial lines once
+// maxPartial raw input bytes of the line were read.
+func (l *lineReader) limitPartial(maxPartial int) {
+	l.maxPartial = maxPartial
+}
+
+// partialExceeded checks if the raw input bytes of the current incomplete line
+// exceed the limit set by limitPartial.
+func (l *lineReader) partialExceeded() bool {
+	return l.maxPartial > 0 && l.byteCount+l.inBuffer.Len() >= l.maxPartial
+}
+
+// rawLine returns the raw input bytes of the last line returned by next,
+// including the line ending.
+func (l *lineReader) rawLine() []byte {
+	return l.lastRaw
+}
+
+// invalidLine checks if the decoder found byte sequences invalid in the
+// encoding in the last line returned by next.
+func (l *lineReader) invalidLine() bool {
+	return l.lastInvalid
+}
+
+// rawPartial returns the raw input bytes of the incomplete line decoded by
+// partial so far.
+func (l *lineReader) rawPartial() []byte {
+	return l.raw
+}
+
+// enableCR makes a lone carriage return terminate lines in addition to the
+// line feed delimiter, e.g. for files with classic Mac line endings.
+func (l *lineReader) enableCR() error {
+	cr, _, err := transform.Bytes(l.codec.NewEncoder(), []byte("\r"))
+	if err != nil {
+		return err
+	}
+	l.cr = cr
 	return nil
 }
 
+// next returns the next complete line including the line delimiter, and the
+// number of raw input bytes consumed. The returned bytes are only valid until
+// the next call of a reader method, as the line buffer is reused.
 func (l *lineReader) next() ([]byte, int, error) {
+	return l.nextLine(false)
+}
+
+// nextFinal returns the next complete line like next, but a carriage return at
+// the end of the input terminates the line. It is used once no line feed
+// followed the carriage return within partial_line_waiting.
+func (l *lineReader) nextFinal() ([]byte, int, error) {
+	return l.nextLine(true)
+}
+
+func (l *lineReader) nextLine(final bool) ([]byte, int, error) {
 	for {
 		// read next 'potential' line from input buffer/reader
-		err := l.advance()
+		err := l.advance(final)
 		if err != nil {
 			return nil, 0, err
 		}
 
-		// check last decoded byte really being '\n'
-		buf := l.outBuffer.Bytes()
-		if buf[len(buf)-1] == '\n' {
+		// check last decoded bytes really being the line delimiter
+		if isLine(l.line, l.delimiter, l.cr != nil) {
 			break
 		}
 	}
 
-	// output buffer contains complete line ending with '\n'. Extract
-	// byte slice from buffer and reset output buffer.
-	bytes, err := l.outBuffer.Collect(l.outBuffer.Len())
-	l.outBuffer.Reset()
-	if err != nil {
-		panic(err)
-	}
+	// line buffer contains complete line ending with delimiter. Return the
+	// line and reset the buffer for the next line.
+	bytes := l.line
+	l.line = l.line[:0]
 
 	// return and reset consumed bytes count
 	sz := l.byteCount
 	l.byteCount = 0
+	l.lastRaw, l.raw = l.raw, nil
+	l.lastInvalid, l.decoder.invalid = l.decoder.invalid, false
 	return bytes, sz, nil
 }
 
-func (l *lineReader) advance() error {
-	var idx int
+func (l *lineReader) advance(final bool) error {
+	var idx, delimLen int
 	var err error
 
-	// fill inBuffer until '\n' sequence has been found in input buffer
+	// fill inBuffer until delimiter sequence has been found in input buffer
 	for {
-		idx = l.inBuffer.IndexFrom(l.inOffset, l.nl)
+		idx, delimLen = l.indexDelimiter(final)
 		if idx >= 0 {
 			break
 		}
@@ -141,20 +248,41 @@ func (l *lineReader) advance() error {
 			return err
 		}
 
+		// line exceeds max_bytes -> truncate line and drop buffered input. Keep
+		// last bytes in buffer, as these might be part of the delimiter sequence.
+		if l.maxBytes > 0 && (l.skip || l.byteCount+l.inBuffer.Len() > l.maxBytes) {
+			end := l.inBuffer.Len() - (len(l.nl) - 1)
+			if end > 0 {
+				if err := l.truncate(end); err != nil {
+					return err
+				}
+			}
+		}
+
 		// increase search offset to reduce iterations on buffer when looping
 		newOffset := l.inBuffer.Len() - len(l.nl)
 		if newOffset > l.inOffset {
 			l.inOffset = newOffset
 		}
 
-		// try to read more bytes into buffer
-		n := 0
-		buf := make([]byte, l.bufferSize)
-		n, err := l.rawInput.Read(buf)
-		l.inBuffer.Append(buf[:n])
+		// the incomplete line does not fit into the read buffer. Double the
+		// buffer up to max_bytes, so long lines need fewer reads. With short
+		// lines the buffer keeps its initial size.
+		if l.inBuffer.Len() >= len(l.readBuf) && len(l.readBuf) < l.maxBytes {
+			size := 2 * len(l.readBuf)
+			if size > l.maxBytes {
+				size = l.maxBytes
+			}
+			l.readBuf = make([]byte, size)
+		}
+
+		// try to read more bytes into buffer. The read buffer is reused, so the
+		// bytes are copied into the input buffer.
+		n, err := l.rawInput.Read(l.readBuf)
+		l.inBuffer.Write(l.readBuf[:n])
 		if n == 0 && err != nil {
 			// return error only if no bytes have been received. Otherwise try to
-			// parse '\n' before returning the error.
+			// parse delimiter before returning the error.
 			return err
 		}
 
@@ -164,9 +292,19 @@ func (l *lineReader) advance() error {
 		}
 	}
 
-	// found encoded byte sequence for '\n' in buffer
-	// -> decode input sequence into outBuffer
-	sz, err := l.decode(idx + len(l.nl))
+	// found encoded byte sequence for delimiter in buffer. If line is too long,
+	// truncate line and finish line with delimiter
+	if l.maxBytes > 0 && (l.skip || l.byteCount+idx+delimLen > l.maxBytes) {
+		if err := l.truncate(idx + delimLen); err != nil {
+			return err
+		}
+		l.skip = false
+		l.line = append(l.line, l.delimiter...)
+		return nil
+	}
+
+	// -> decode input sequence into line buffer
+	sz, err := l.decode(idx + delimLen)
 
 	// consume transformed bytes from input buffer
 	err = l.inBuffer.Advance(sz)
@@ -174,16 +312,43 @@ func (l *lineReader) advance() error {
 
 	l.inOffset = idx + 1 - sz // continue scanning input buffer from last position + 1
 	if l.inOffset < 0 {
-		// fix inOffset if '\n' has encoding > 8bits + fill line has been decoded
+		// fix inOffset if delimiter has encoding > 8bits + fill line has been decoded
 		l.inOffset = 0
 	}
 
 	return err
 }
 
+// indexDelimiter returns the index and length of the next line delimiter in
+// the input buffer, or -1 if no delimiter was found. A carriage return at the
+// end of the buffer might be followed by a line feed and is only returned if
+// final is set.
+func (l *lineReader) indexDelimiter(final bool) (int, int) {
+	idx := l.inBuffer.IndexFrom(l.inOffset, l.nl)
+	if l.cr == nil {
+		return idx, len(l.nl)
+	}
+
+	crIdx := l.inBuffer.IndexFrom(l.inOffset, l.cr)
+	if crIdx < 0 || (idx >= 0 && idx < crIdx) {
+		return idx, len(l.nl)
+	}
+
+	// \r\n is terminated by the line feed
+	end := crIdx + len(l.cr)
+	if idx == end {
+		return idx, len(l.nl)
+	}
+
+	if end == l.inBuffer.Len() && !final {
+		return -1, 0
+	}
+	return crIdx, len(l.cr)
+}
+
 func (l *lineReader) decode(end int) (int, error) {
 	var err error
-	buffer := make([]byte, 1024)
+	buffer := l.decodeBuf
 	inBytes := l.inBuffer.Bytes()
 	start := 0
 
@@ -193,7 +358,7 @@ func (l *lineReader) decode(end int) (int, error) {
 		nDst, nSrc, err = l.decoder.Transform(buffer, inBytes[start:end], false)
 		start += nSrc
 
-		l.outBuffer.Write(buffer[:nDst])
+		l.line = append(l.line, buffer[:nDst]...)
 
 		if err != nil {
 			if err == transform.ErrShortDst { // continue transforming
@@ -204,12 +369,45 @@ func (l *lineReader) decode(end int) (int, error) {
 	}
 
 	l.byteCount += start
+	if l.captureRaw {
+		l.raw = append(l.raw, inBytes[:start]...)
+	}
 	return start, err
 }
 
+// truncate decodes input bytes up to maxBytes into the line buffer and
+// drops all other bytes up to end from the input buffer. Dropped bytes are
+// still accounted for in byteCount, so offsets point past the full line.
+func (l *lineReader) truncate(end int) error {
+	consumed := 0
+	if !l.skip {
+		limit := l.maxBytes - l.byteCount
+		if limit > end {
+			limit = end
+		}
+
+		if limit > 0 {
+			var err error
+			consumed, err = l.decode(limit)
+			if err != nil && err != transform.ErrShortSrc {
+				return err
+			}
+		}
+		l.skip = true
+	}
+
+	l.byteCount += end - consumed
+	l.inBuffer.Advance(end)
+	l.inBuffer.Reset()
+	l.inOffset = 0
+	return nil
+}
+
 // partial returns current state of decoded input bytes and amount of bytes
 // processed so far. If decoder has detected an error in input stream, the error
-// will be returned.
+// will be returned. Bytes of a multibyte character not completely read yet
+// stay in the input buffer, so reading can continue after EOF without
+// reinitializing the decoder.
 func (l *lineReader) partial() ([]byte, int, error) {
 	// decode all input buffer
 	sz, err := l.decode(l.inBuffer.Len())
@@ -221,17 +419,37 @@ func (l *lineReader) partial() ([]byte, int, error) {
 		l.inOffset = 0
 	}
 
-	// return current state of outBuffer, but do not consume any content yet
-	bytes := l.outBuffer.Bytes()
+	// return current state of line buffer, but do not consume any content yet
 	sz = l.byteCount
-	return bytes, sz, err
+	return l.line, sz, err
+}
+
+// pendingNullPadding checks if the input of the current incomplete line ends
+// with NUL characters. Some file systems extend files with NUL bytes before
+// the actual content is written.
+func (l *lineReader) pendingNullPadding() bool {
+	bytes, _, _ := l.partial()
+	return len(bytes) > 0 && bytes[len(bytes)-1] == 0
+}
+
+// dropPending drops all buffered input of the current incomplete line,
+// returning the number of raw input bytes dropped.
+func (l *lineReader) dropPending() int {
+	sz := l.dropPartial() + l.inBuffer.Len()
+	l.inBuffer.Advance(l.inBuffer.Len())
+	l.inBuffer.Reset()
+	l.inOffset = 0
+	l.skip = false
+	l.decoder.Reset()
+	return sz
 }
 
-// dropPartial drops current output buffer of decoded characters returning total number
+// dropPartial drops current line buffer of decoded characters returning total number
 // of input bytes consumed
 func (l *lineReader) dropPartial() int {
-	l.outBuffer.Advance(l.outBuffer.Len())
-	l.outBuffer.Reset()
+	l.line = l.line[:0]
+	l.raw = nil
+	l.decoder.invalid = false
 	sz := l.byteCount
 	l.byteCount = 0
 	return sz
@@ -3,7 +3,9 @@ package harvester
 import (
 	"bytes"
 	"math/rand"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/elastic/filebeat/harvester/encoding"
 	"github.com/stretchr/testify/assert"
@@ -49,7 +51,7 @@ func TestReaderEncodings(t *testing.T) {
 		}
 
 		// create line reader
-		reader, err := newLineReader(buffer, codec, 1024)
+		reader, err := newLineReader(buffer, codec, 1024, 0, "\n")
 		if err != nil {
 			t.Errorf("failed to initialize reader: %v", err)
 			continue
@@ -102,7 +104,7 @@ func TestReaderPartialWithEncodings(t *testing.T) {
 		codec, _ := codecFactory(buffer)
 
 		writer := transform.NewWriter(buffer, codec.NewEncoder())
-		reader, err := newLineReader(buffer, codec, 1024)
+		reader, err := newLineReader(buffer, codec, 1024, 0, "\n")
 		if err != nil {
 			t.Errorf("failed to initialize reader: %v", err)
 			continue
@@ -200,7 +202,7 @@ func testReadLines(t *testing.T, inputLines [][]byte) {
 	// initialize reader
 	buffer := bytes.NewBuffer(inputStream)
 	codec, _ := encoding.Plain(buffer)
-	reader, err := newLineReader(buffer, codec, buffer.Len())
+	reader, err := newLineReader(buffer, codec, buffer.Len(), 0, "\n")
 	if err != nil {
 		t.Fatalf("Error initializing reader: %v", err)
 	}
@@ -213,7 +215,8 @@ func testReadLines(t *testing.T, inputLines [][]byte) {
 			t.Fatalf("failed to read all lines from test: %v", err)
 		}
 
-		lines = append(lines, bytes)
+		// the line buffer is reused by the next read
+		lines = append(lines, append([]byte(nil), bytes...))
 	}
 
 	// validate
@@ -226,3 +229,299 @@ func testReadLines(t *testing.T, inputLines [][]byte) {
 func testReadLine(t *testing.T, line []byte) {
 	testReadLines(t, [][]byte{line})
 }
+
+func TestReadTruncatedLines(t *testing.T) {
+	// buffer sizes smaller and bigger than max_bytes
+	for _, bufferSize := range []int{3, 1024} {
+		input := "short\n" + "this line is too long\n" + "next\n"
+		buffer := bytes.NewBufferString(input)
+		codec, _ := encoding.Plain(buffer)
+		reader, err := newLineReader(buffer, codec, bufferSize, 10, "\n")
+		if err != nil {
+			t.Fatalf("Error initializing reader: %v", err)
+		}
+
+		expected := []struct {
+			line string
+			sz   int
+		}{
+			{"short\n", 6},
+			{"this line \n", 22},
+			{"next\n", 5},
+		}
+		for _, exp := range expected {
+			line, sz, err := reader.next()
+			assert.Nil(t, err)
+			assert.Equal(t, exp.line, string(line))
+			assert.Equal(t, exp.sz, sz)
+		}
+	}
+}
+
+func TestReadCustomDelimiter(t *testing.T) {
+	for _, name := range []string{"plain", "utf-16le"} {
+		codecFactory, _ := encoding.FindEncoding(name)
+		buffer := bytes.NewBuffer(nil)
+		codec, _ := codecFactory(buffer)
+
+		writer := transform.NewWriter(buffer, codec.NewEncoder())
+		writer.Write([]byte("record 1\x1erecord\n2\x1e"))
+
+		reader, err := newLineReader(buffer, codec, 1024, 0, "\x1e")
+		if err != nil {
+			t.Fatalf("Error initializing reader: %v", err)
+		}
+
+		for _, expected := range []string{"record 1\x1e", "record\n2\x1e"} {
+			line, _, err := reader.next()
+			assert.Nil(t, err)
+			assert.Equal(t, expected, string(line))
+		}
+	}
+}
+
+func TestReadCRLineEndings(t *testing.T) {
+	for _, name := range []string{"plain", "utf-16le"} {
+		codecFactory, _ := encoding.FindEncoding(name)
+		buffer := bytes.NewBuffer(nil)
+		codec, _ := codecFactory(buffer)
+
+		writer := transform.NewWriter(buffer, codec.NewEncoder())
+		writer.Write([]byte("line 1\rline 2\r\nline 3\nline 4\r"))
+
+		reader, err := newLineReader(buffer, codec, 1024, 0, "\n")
+		if err != nil {
+			t.Fatalf("Error initializing reader: %v", err)
+		}
+		err = reader.enableCR()
+		assert.Nil(t, err)
+
+		for _, expected := range []string{"line 1\r", "line 2\r\n", "line 3\n"} {
+			line, _, err := reader.next()
+			assert.Nil(t, err, name)
+			assert.Equal(t, expected, string(line), name)
+		}
+
+		// carriage return at end of input might be followed by a line feed
+		_, sz, err := reader.next()
+		assert.NotNil(t, err, name)
+		assert.Equal(t, 0, sz, name)
+
+		line, _, err := reader.nextFinal()
+		assert.Nil(t, err, name)
+		assert.Equal(t, "line 4\r", string(line), name)
+	}
+}
+
+func TestReadCRLFSplitAtEOF(t *testing.T) {
+	codec, _ := encoding.Plain(nil)
+	buffer := bytes.NewBuffer(nil)
+	reader, err := newLineReader(buffer, codec, 1024, 0, "\n")
+	if err != nil {
+		t.Fatalf("Error initializing reader: %v", err)
+	}
+	assert.Nil(t, reader.enableCR())
+
+	// end of file between carriage return and line feed
+	buffer.WriteString("a\r")
+	_, sz, err := reader.next()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, sz)
+
+	buffer.WriteString("\nb\n")
+	for _, expected := range []string{"a\r\n", "b\n"} {
+		line, _, err := reader.next()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(line))
+	}
+
+	_, sz, err = reader.next()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, sz)
+}
+
+func TestReadSplitCharacterAtEOF(t *testing.T) {
+	codecFactory, _ := encoding.FindEncoding("utf-16le")
+	encoded := bytes.NewBuffer(nil)
+	codec, _ := codecFactory(encoded)
+
+	// surrogate pair spanning 4 bytes
+	writer := transform.NewWriter(encoded, codec.NewEncoder())
+	writer.Write([]byte("smile \U0001F600 done\n"))
+	raw := encoded.Bytes()
+
+	buffer := bytes.NewBuffer(nil)
+	reader, err := newLineReader(buffer, codec, 1024, 0, "\n")
+	if err != nil {
+		t.Fatalf("Error initializing reader: %v", err)
+	}
+
+	// end of file falls in the middle of a character, then in the middle of
+	// the surrogate pair. Incomplete characters stay buffered until complete.
+	start := 0
+	for _, end := range []int{13, 14, 15, len(raw)} {
+		buffer.Write(raw[start:end])
+		start = end
+
+		if end < len(raw) {
+			_, sz, err := reader.next()
+			assert.NotNil(t, err)
+			assert.Equal(t, 0, sz)
+
+			// publishing a partial line does not consume the incomplete character
+			partial, _, _ := reader.partial()
+			assert.True(t, utf8.Valid(partial))
+		}
+	}
+
+	line, sz, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "smile \U0001F600 done\n", string(line))
+	assert.Equal(t, 28, sz)
+}
+
+func TestReadBufferGrowth(t *testing.T) {
+	codec, _ := encoding.Plain(nil)
+
+	// short lines keep the initial buffer size
+	short := bytes.Repeat([]byte("short line\n"), 10000)
+	reader, err := newLineReader(bytes.NewReader(short), codec, 16<<10, 1<<20, "\n")
+	assert.Nil(t, err)
+	for {
+		if _, _, err := reader.next(); err != nil {
+			break
+		}
+	}
+	assert.Equal(t, 16<<10, len(reader.readBuf))
+
+	long := append(bytes.Repeat([]byte{'a'}, 64<<10), '\n')
+	reader, err = newLineReader(bytes.NewReader(long), codec, 16<<10, 1<<20, "\n")
+	assert.Nil(t, err)
+	line, sz, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, long, line)
+	assert.Equal(t, len(long), sz)
+	assert.Equal(t, 64<<10, len(reader.readBuf))
+
+	// the buffer grows up to max_bytes only
+	reader, err = newLineReader(bytes.NewReader(long), codec, 16<<10, 20<<10, "\n")
+	assert.Nil(t, err)
+	line, _, err = reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, 20<<10+1, len(line))
+	assert.Equal(t, 20<<10, len(reader.readBuf))
+}
+
+func TestReadReusesLineBuffer(t *testing.T) {
+	codec, _ := encoding.Plain(nil)
+	reader, err := newLineReader(strings.NewReader("line 1\nline 2\n"), codec, 1024, 0, "\n")
+	assert.Nil(t, err)
+
+	first, _, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "line 1\n", string(first))
+
+	second, _, err := reader.next()
+	assert.Nil(t, err)
+	assert.Equal(t, "line 2\n", string(second))
+	assert.True(t, &first[0] == &second[0], "line buffer not reused")
+
+	reader.release()
+	assert.Nil(t, reader.line)
+}
+
+// BenchmarkReadMixedLineLengths reads mostly short lines with some long lines
+// mixed in, as found in application logs containing stack traces or dumps.
+func BenchmarkReadMixedLineLengths(b *testing.B) {
+	var input []byte
+	for i := 0; i < 1000; i++ {
+		length := 80
+		if i%100 == 0 {
+			length = 64 << 10
+		}
+		input = append(input, bytes.Repeat([]byte{'a'}, length)...)
+		input = append(input, '\n')
+	}
+
+	codec, _ := encoding.Plain(nil)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := newLineReader(bytes.NewReader(input), codec, 16<<10, 10<<20, "\n")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for {
+			if _, _, err := reader.next(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkReadLongLinesFixed and BenchmarkReadLongLinesGrow read lines of
+// 1MB with the read buffer fixed at the buffer size and growing up to
+// max_bytes.
+func BenchmarkReadLongLinesFixed(b *testing.B) { benchmarkReadLongLines(b, 0) }
+func BenchmarkReadLongLinesGrow(b *testing.B)  { benchmarkReadLongLines(b, 10<<20) }
+
+func benchmarkReadLongLines(b *testing.B, maxBytes int) {
+	var input []byte
+	for i := 0; i < 16; i++ {
+		input = append(input, bytes.Repeat([]byte{'a'}, 1<<20)...)
+		input = append(input, '\n')
+	}
+
+	codec, _ := encoding.Plain(nil)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := newLineReader(bytes.NewReader(input), codec, 16<<10, maxBytes, "\n")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for {
+			if _, _, err := reader.next(); err != nil {
+				break
+			}
+		}
+		reader.release()
+	}
+}
+
+// BenchmarkReadLine reads short lines as written by most applications,
+// including the conversion of each line to the text of the event.
+func BenchmarkReadLine(b *testing.B) {
+	var input []byte
+	for i := 0; i < 1000; i++ {
+		input = append(input, bytes.Repeat([]byte{'a'}, 80)...)
+		input = append(input, '\r', '\n')
+	}
+
+	codec, _ := encoding.Plain(nil)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, err := newLineReader(bytes.NewReader(input), codec, 16<<10, 0, "\n")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for {
+			line, sz, err := reader.next()
+			if err != nil {
+				break
+			}
+			readlineString(line, sz, false, reader)
+		}
+		reader.release()
+	}
+}
@@ -0,0 +1,58 @@
+package harvester
+
+import (
+	"regexp"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/libbeat/common"
+)
+
+// redactor replaces all matches of the pattern in a line with the
+// replacement. The replacement can refer to capture groups, e.g. ${1}.
+type redactor struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func newRedactor(cfg *config.RedactConfig) (*redactor, error) {
+	if err := config.CompileRegexp("redact", &cfg.PatternRegexp, cfg.Pattern); err != nil {
+		return nil, err
+	}
+	return &redactor{pattern: cfg.PatternRegexp, replacement: cfg.Replacement}, nil
+}
+
+func (r *redactor) Process(line *string) (*string, bool) {
+	text := r.redact(*line)
+	return &text, true
+}
+
+func (r *redactor) redact(text string) string {
+	return r.pattern.ReplaceAllString(text, r.replacement)
+}
+
+// redactJSON applies the redact patterns to all string values of the decoded
+// JSON fields, including values of nested objects and arrays. Keys are kept.
+func (h *Harvester) redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, processor := range h.Processors {
+			if r, ok := processor.(*redactor); ok {
+				v = r.redact(v)
+			}
+		}
+		return v
+	case common.MapStr:
+		for key, elem := range v {
+			v[key] = h.redactJSON(elem)
+		}
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = h.redactJSON(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = h.redactJSON(elem)
+		}
+	}
+	return value
+}
@@ -0,0 +1,54 @@
+package harvester
+
+import (
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	var err error
+	h := Harvester{}
+
+	h.Processors, err = NewProcessors(&config.HarvesterConfig{
+		Redact: []config.RedactConfig{
+			{Pattern: `\b(?:\d[ -]?){12}(\d{4})\b`, Replacement: "XXXX-XXXX-XXXX-${1}"},
+			// overlaps with the card number, which is already redacted
+			{Pattern: `\d{4}`, Replacement: "####"},
+			{Pattern: `password=\S+`, Replacement: "password=<redacted>"},
+		},
+	})
+	assert.Nil(t, err)
+
+	text, ok := h.processLine("payment card=4111 1111 1111 1234 password=secret")
+	assert.True(t, ok)
+	assert.Equal(t, "payment card=XXXX-XXXX-XXXX-#### password=<redacted>", text)
+
+	text, ok = h.processLine("nothing to redact")
+	assert.True(t, ok)
+	assert.Equal(t, "nothing to redact", text)
+}
+
+func TestRedactFilteredFirst(t *testing.T) {
+	var err error
+	h := Harvester{}
+
+	// filters see the original line
+	h.Processors, err = NewProcessors(&config.HarvesterConfig{
+		IncludeLines: []string{"secret"},
+		Redact:       []config.RedactConfig{{Pattern: "secret", Replacement: "***"}},
+	})
+	assert.Nil(t, err)
+
+	text, ok := h.processLine("my secret")
+	assert.True(t, ok)
+	assert.Equal(t, "my ***", text)
+}
+
+func TestRedactInvalidPattern(t *testing.T) {
+	_, err := NewProcessors(&config.HarvesterConfig{
+		Redact: []config.RedactConfig{{Pattern: "("}},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,28 @@
+package harvester
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+)
+
+// sampledOut checks if the event starting at offset is dropped by
+// sample_rate, keeping 1 in sample_rate events. Events are picked at random,
+// or with sample_deterministic by the hash of their source and offset, so the
+// same events are kept if they are read again, e.g. after a restart.
+func (h *Harvester) sampledOut(offset int64) bool {
+	rate := h.Config.SampleRate
+	if rate <= 1 {
+		return false
+	}
+
+	if !h.Config.SampleDeterministic {
+		return rand.Intn(rate) != 0
+	}
+
+	// FNV hashes of the offsets of consecutive lines are not evenly
+	// distributed modulo small rates, so a cryptographic hash is used.
+	sum := sha256.Sum256([]byte(h.Source + ":" + strconv.FormatInt(offset, 10)))
+	return binary.BigEndian.Uint64(sum[:8])%uint64(rate) != 0
+}
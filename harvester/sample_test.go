@@ -0,0 +1,43 @@
+package harvester
+
+import (
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampledOut(t *testing.T) {
+	h := &Harvester{
+		Source: "/var/log/debug.log",
+		Config: &config.HarvesterConfig{},
+	}
+
+	// disabled
+	for offset := int64(0); offset < 100; offset++ {
+		assert.False(t, h.sampledOut(offset))
+	}
+
+	count := func() int {
+		n := 0
+		for offset := int64(0); offset < 10000; offset++ {
+			if !h.sampledOut(offset) {
+				n++
+			}
+		}
+		return n
+	}
+
+	h.Config.SampleRate = 10
+	n := count()
+	assert.True(t, n > 800 && n < 1200, "kept %d of 10000", n)
+
+	h.Config.SampleDeterministic = true
+	n = count()
+	assert.True(t, n > 800 && n < 1200, "kept %d of 10000", n)
+
+	// the same events are kept again
+	for offset := int64(0); offset < 100; offset++ {
+		assert.Equal(t, h.sampledOut(offset), h.sampledOut(offset))
+	}
+}
@@ -0,0 +1,325 @@
+package harvester
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/libbeat/logp"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpScheme marks paths of remote files read over SFTP, e.g.
+// sftp://user@host:22/var/log/app.log
+const sftpScheme = "sftp://"
+
+// sftpDialTimeout limits the time to establish the SSH connection
+const sftpDialTimeout = 30 * time.Second
+
+// IsSFTPPath returns true if path refers to a remote file using the sftp://
+// scheme.
+func IsSFTPPath(path string) bool {
+	return strings.HasPrefix(path, sftpScheme)
+}
+
+// parseSFTPPath splits a path like sftp://user@host:port/path into the user,
+// the address to dial and the remote path. The port defaults to 22, the user
+// to defaultUser.
+func parseSFTPPath(path, defaultUser string) (user, addr, remotePath string, err error) {
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme != "sftp" || u.Host == "" || u.Path == "" {
+		return "", "", "", fmt.Errorf("invalid sftp path '%v', must be sftp://[user@]host[:port]/path", path)
+	}
+
+	user = defaultUser
+	if u.User != nil && u.User.Username() != "" {
+		user = u.User.Username()
+	}
+
+	addr = u.Host
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		// no port given. Brackets of IPv6 addresses are added back by JoinHostPort
+		addr = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]"), "22")
+	}
+	return user, addr, u.Path, nil
+}
+
+// newSSHClientConfig creates the SSH client configuration of the credentials
+// given in cfg. The host key is checked against the known_hosts file.
+func newSSHClientConfig(user string, cfg *config.SFTPConfig) (*ssh.ClientConfig, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("sftp options must be set to read sftp:// paths")
+	}
+
+	hostKeyCallback, err := knownhosts.New(cfg.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sftp.known_hosts: %v", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		key, err := ioutil.ReadFile(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp.private_key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp.private_key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpDialTimeout,
+	}, nil
+}
+
+// sftpSource reads a remote file over SFTP. If the connection drops, EOF is
+// returned and the connection is reestablished on the next read, continuing
+// at the offset read up to, so the harvester backs off between reconnection
+// attempts. Like local files, the source is seekable.
+type sftpSource struct {
+	path   string // path as configured, used as name
+	addr   string // host:port of the SSH server
+	remote string // path of the file on the server
+	config *ssh.ClientConfig
+
+	conn   *ssh.Client
+	client *sftp.Client
+	file   *sftp.File
+	offset int64       // offset of the next read
+	info   os.FileInfo // last known info of the remote file
+}
+
+func newSFTPSource(path string, cfg *config.SFTPConfig) (*sftpSource, error) {
+	var defaultUser string
+	if cfg != nil {
+		defaultUser = cfg.User
+	}
+	user, addr, remote, err := parseSFTPPath(path, defaultUser)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConfig, err := newSSHClientConfig(user, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sftpSource{path: path, addr: addr, remote: remote, config: sshConfig}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// dial connects to the server and opens the remote file at the current
+// offset.
+func (s *sftpSource) dial() error {
+	conn, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	file, err := client.Open(s.remote)
+	if err == nil {
+		s.info, err = file.Stat()
+	}
+	if err == nil {
+		_, err = file.Seek(s.offset, os.SEEK_SET)
+	}
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return err
+	}
+
+	s.conn = conn
+	s.client = client
+	s.file = file
+	return nil
+}
+
+// disconnect closes the connection after an error. The next read reconnects.
+func (s *sftpSource) disconnect(err error) {
+	logp.Info("Connection to %s closed: %s", s.path, err)
+	s.Close()
+	s.conn, s.client, s.file = nil, nil, nil
+}
+
+// Read reads from the remote file. Connection errors are reported as EOF.
+func (s *sftpSource) Read(b []byte) (int, error) {
+	if s.file == nil {
+		if err := s.dial(); err != nil {
+			logp.Debug("harvester", "Failed to reconnect to %s: %s", s.path, err)
+			return 0, io.EOF
+		}
+		logp.Info("Reconnected to %s at offset %d", s.path, s.offset)
+	}
+
+	n, err := s.file.Read(b)
+	s.offset += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	s.disconnect(err)
+	return n, io.EOF
+}
+
+// ReadAt reads len(b) bytes at offset, keeping the offset of the next read.
+func (s *sftpSource) ReadAt(b []byte, offset int64) (int, error) {
+	if s.file == nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if _, err := s.file.Seek(offset, os.SEEK_SET); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.file, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if _, seekErr := s.file.Seek(s.offset, os.SEEK_SET); seekErr != nil && err == nil {
+		err = seekErr
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next read. Seeking relative to the end uses the
+// last known size if not connected.
+func (s *sftpSource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += s.offset
+	case os.SEEK_END:
+		info, err := s.Stat()
+		if err != nil {
+			return s.offset, err
+		}
+		offset += info.Size()
+	default:
+		return s.offset, errNotSeekable
+	}
+
+	if s.file != nil {
+		if _, err := s.file.Seek(offset, os.SEEK_SET); err != nil {
+			return s.offset, err
+		}
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+func (s *sftpSource) Close() error {
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+	}
+	if s.client != nil {
+		s.client.Close()
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
+
+func (s *sftpSource) Name() string      { return s.path }
+func (s *sftpSource) Continuable() bool { return true }
+
+// Stat returns the info of the remote file. While not connected or if the
+// connection drops, the last known info is returned.
+func (s *sftpSource) Stat() (os.FileInfo, error) {
+	if s.file == nil {
+		return s.info, nil
+	}
+
+	info, err := s.file.Stat()
+	if err != nil {
+		s.disconnect(err)
+		return s.info, nil
+	}
+	s.info = info
+	return info, nil
+}
+
+// openSFTP connects to the server of the sftp:// path h.Path and opens the
+// remote file, continuing at h.Offset. Connecting is retried up to
+// max_open_retries times.
+func (h *Harvester) openSFTP() (encoding.Encoding, error) {
+	for retries := 0; ; retries++ {
+		source, err := newSFTPSource(h.Path, h.Config.SFTP)
+		if err == nil {
+			var enc encoding.Encoding
+			enc, err = h.encoding(source)
+			if err == nil {
+				err = h.initSFTPOffset(source)
+			}
+			if err != nil {
+				source.Close()
+				return nil, err
+			}
+
+			logp.Debug("harvester", "harvest: sftp %q position:%d", h.Path, h.Offset)
+			h.file = source
+			return enc, nil
+		}
+
+		logp.Err("Failed connecting to %s: %s", h.Path, err)
+
+		if h.openRetriesExceeded(retries) {
+			return nil, fmt.Errorf("Giving up connecting to %s after %d retries: %v", h.Path, retries, err)
+		}
+
+		select {
+		case <-h.done:
+			return nil, errStopped
+		case <-time.After(h.Config.OpenRetryBackoffDuration):
+		}
+	}
+}
+
+// initSFTPOffset seeks to the saved offset. If the remote file is smaller,
+// e.g. because it was rotated while filebeat was not running, reading starts
+// at the beginning.
+func (h *Harvester) initSFTPOffset(source *sftpSource) error {
+	if h.Offset > 0 && source.info.Size() < h.Offset {
+		logp.Warn("Saved offset %d exceeds size %d of file %s. Reading from beginning of file.",
+			h.Offset, source.info.Size(), h.Path)
+		h.Offset = 0
+		h.headerLines = h.Config.SkipHeaderLines
+		h.startReason = StartReasonReset
+	}
+
+	if h.Offset > 0 {
+		_, err := source.Seek(h.Offset, os.SEEK_SET)
+		return err
+	}
+
+	// do not read a byte order mark read by the encoding factory again
+	var err error
+	h.Offset, err = source.Seek(0, os.SEEK_CUR)
+	return err
+}
@@ -0,0 +1,248 @@
+// +build !windows
+
+package harvester
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestIsSFTPPath(t *testing.T) {
+	assert.True(t, IsSFTPPath("sftp://host/var/log/app.log"))
+	assert.False(t, IsSFTPPath("/var/log/app.log"))
+	assert.False(t, IsSFTPPath("unix:///run/app.sock"))
+}
+
+func TestParseSFTPPath(t *testing.T) {
+	tests := []struct {
+		path, user, addr, remote string
+		err                      bool
+	}{
+		{"sftp://host/var/log/app.log", "filebeat", "host:22", "/var/log/app.log", false},
+		{"sftp://admin@host:2222/var/log/app.log", "admin", "host:2222", "/var/log/app.log", false},
+		{"sftp://[::1]/app.log", "filebeat", "[::1]:22", "/app.log", false},
+		{"sftp://[::1]:2222/app.log", "filebeat", "[::1]:2222", "/app.log", false},
+		{"sftp://host", "", "", "", true},
+		{"sftp:///var/log/app.log", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		user, addr, remote, err := parseSFTPPath(test.path, "filebeat")
+		if test.err {
+			assert.NotNil(t, err, test.path)
+			continue
+		}
+		assert.Nil(t, err, test.path)
+		assert.Equal(t, test.user, user, test.path)
+		assert.Equal(t, test.addr, addr, test.path)
+		assert.Equal(t, test.remote, remote, test.path)
+	}
+}
+
+// sftpTestServer serves the local file system over SFTP with password
+// authentication. All connections can be dropped to test reconnecting.
+type sftpTestServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func newSFTPTestServer(t *testing.T) *sftpTestServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("Error creating signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "filebeat" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("invalid user or password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	s := &sftpTestServer{listener: listener, config: config, hostKey: signer.PublicKey()}
+	go s.serve()
+	return s
+}
+
+func (s *sftpTestServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *sftpTestServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						return
+					}
+					server.Serve()
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+// dropConnections closes all open connections.
+func (s *sftpTestServer) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *sftpTestServer) Close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func TestHarvestSFTPReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-sftp")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newSFTPTestServer(t)
+	defer server.Close()
+	addr := server.listener.Addr().String()
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{addr}, server.hostKey) + "\n"
+	if err := ioutil.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatalf("Error writing known_hosts: %v", err)
+	}
+
+	logFile := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(logFile, []byte("line 1\nline 2\n"), 0600); err != nil {
+		t.Fatalf("Error writing log file: %v", err)
+	}
+
+	path := sftpScheme + addr + logFile
+	spooler := make(chan *input.FileEvent, 3)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:         1024,
+			BackoffDuration:    10 * time.Millisecond,
+			MaxBackoffDuration: 10 * time.Millisecond,
+			BackoffFactor:      1,
+			SFTP: &config.SFTPConfig{
+				User:       "filebeat",
+				Password:   "secret",
+				KnownHosts: knownHosts,
+			},
+		},
+		path, nil, spooler)
+	assert.Nil(t, err)
+
+	// continue after the first line
+	h.Offset = 7
+
+	go h.Harvest()
+	defer h.Stop()
+
+	receive := func(text string, offset int64) {
+		select {
+		case event := <-spooler:
+			assert.Equal(t, text, *event.Text)
+			assert.Equal(t, offset, event.Offset)
+			assert.Equal(t, path, *event.Source)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for event")
+		}
+	}
+	receive("line 2", 7)
+
+	// lines written while disconnected are read after reconnecting
+	server.dropConnections()
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Error opening log file: %v", err)
+	}
+	file.WriteString("line 3\n")
+	file.Close()
+
+	receive("line 3", 14)
+	assert.Equal(t, 0, len(spooler))
+}
+
+func TestHarvestSFTPUnknownHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-sftp")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newSFTPTestServer(t)
+	defer server.Close()
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := ioutil.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatalf("Error writing known_hosts: %v", err)
+	}
+
+	_, err = newSFTPSource(sftpScheme+server.listener.Addr().String()+"/app.log", &config.SFTPConfig{
+		User:       "filebeat",
+		Password:   "secret",
+		KnownHosts: knownHosts,
+	})
+	assert.NotNil(t, err)
+}
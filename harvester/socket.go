@@ -0,0 +1,104 @@
+package harvester
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/libbeat/logp"
+)
+
+// unixScheme marks paths of Unix domain sockets, e.g. unix:///run/app.sock
+const unixScheme = "unix://"
+
+// socketReadTimeout limits the time a read blocks waiting for data, so the
+// harvester can check for being stopped.
+const socketReadTimeout = time.Second
+
+// IsSocketPath returns true if path refers to a Unix domain socket using the
+// unix:// scheme.
+func IsSocketPath(path string) bool {
+	return strings.HasPrefix(path, unixScheme)
+}
+
+// socketSource reads the stream of a Unix domain socket. If the connection is
+// closed, EOF is returned and the socket is redialed on the next read, so the
+// harvester backs off between reconnection attempts. As offsets have no
+// meaning for sockets, the source is not seekable.
+type socketSource struct {
+	path string // path of the socket file
+	conn net.Conn
+	info os.FileInfo // last known info of the socket file
+}
+
+func newSocketSource(path string) (*socketSource, error) {
+	s := &socketSource{path: strings.TrimPrefix(path, unixScheme)}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *socketSource) dial() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("unix", s.path, socketReadTimeout)
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	s.info = info
+	return nil
+}
+
+// Read reads from the current connection. Closed connections and timeouts
+// waiting for data are reported as EOF.
+func (s *socketSource) Read(b []byte) (int, error) {
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			logp.Debug("harvester", "Failed to redial socket %s: %s", s.path, err)
+			return 0, io.EOF
+		}
+		logp.Info("Reconnected to socket %s", s.path)
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	n, err := s.conn.Read(b)
+	if err == nil || n > 0 {
+		return n, nil
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return 0, io.EOF
+	}
+
+	logp.Info("Connection to socket %s closed: %s", s.path, err)
+	s.conn.Close()
+	s.conn = nil
+	return 0, io.EOF
+}
+
+func (s *socketSource) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *socketSource) Name() string      { return unixScheme + s.path }
+func (s *socketSource) Continuable() bool { return true }
+
+// Stat returns the info of the socket file. If the socket file was removed,
+// e.g. while the service restarts, the last known info is returned.
+func (s *socketSource) Stat() (os.FileInfo, error) {
+	if info, err := os.Stat(s.path); err == nil {
+		s.info = info
+	}
+	return s.info, nil
+}
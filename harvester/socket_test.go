@@ -0,0 +1,74 @@
+// +build !windows
+
+package harvester
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSocketPath(t *testing.T) {
+	assert.True(t, IsSocketPath("unix:///run/app.sock"))
+	assert.False(t, IsSocketPath("/var/log/app.log"))
+	assert.False(t, IsSocketPath("-"))
+}
+
+func TestHarvestSocketReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-socket")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Error listening on socket: %v", err)
+	}
+	defer listener.Close()
+
+	// every connection sends one line and is closed
+	go func() {
+		for _, line := range []string{"line 1\n", "line 2\n"} {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(line))
+			conn.Close()
+		}
+	}()
+
+	spooler := make(chan *input.FileEvent, 2)
+	h, err := NewHarvester(
+		config.ProspectorConfig{IgnoreOlderDuration: time.Hour},
+		&config.HarvesterConfig{
+			BufferSize:         1024,
+			BackoffDuration:    10 * time.Millisecond,
+			MaxBackoffDuration: 10 * time.Millisecond,
+			BackoffFactor:      1,
+		},
+		unixScheme+path, nil, spooler)
+	assert.Nil(t, err)
+
+	go h.Harvest()
+	defer h.Stop()
+
+	for _, expected := range []string{"line 1", "line 2"} {
+		select {
+		case event := <-spooler:
+			assert.Equal(t, expected, *event.Text)
+			assert.Equal(t, unixScheme+path, *event.Source)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for event")
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package harvester
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// harvesterStats collects throughput metrics and the read state of a
+// harvester. Fields are updated atomically, so a snapshot can be taken while
+// harvesting.
+type harvesterStats struct {
+	linesRead    uint64
+	bytesRead    uint64
+	eventsSent   uint64
+	teeDrops     uint64
+	discards     uint64
+	lastReadTime int64 // unix time in nanoseconds
+	offset       int64
+	backoff      int64        // current backoff duration
+	path         atomic.Value // current path, changed by follow_renamed
+}
+
+// HarvesterStats is a snapshot of the metrics and read state of a single
+// harvester
+type HarvesterStats struct {
+	Path         string
+	LinesRead    uint64
+	BytesRead    uint64
+	EventsSent   uint64
+	TeeDropped   uint64 // events dropped for busy secondary spoolers with tee_policy drop
+	Discarded    uint64 // incomplete lines dropped with partial_line_policy discard
+	LastReadTime time.Time
+	Offset       int64
+	Backoff      time.Duration
+}
+
+func (s *harvesterStats) lineRead(bytes int, readTime time.Time) {
+	atomic.AddUint64(&s.linesRead, 1)
+	atomic.AddUint64(&s.bytesRead, uint64(bytes))
+	atomic.StoreInt64(&s.lastReadTime, readTime.UnixNano())
+}
+
+func (s *harvesterStats) eventSent() {
+	atomic.AddUint64(&s.eventsSent, 1)
+}
+
+func (s *harvesterStats) teeDropped() {
+	atomic.AddUint64(&s.teeDrops, 1)
+}
+
+func (s *harvesterStats) partialDiscarded() {
+	atomic.AddUint64(&s.discards, 1)
+}
+
+// setPath publishes the path of the harvested file
+func (s *harvesterStats) setPath(path string) {
+	s.path.Store(path)
+}
+
+// update publishes the read state owned by the harvest loop
+func (s *harvesterStats) update(offset int64, backoff time.Duration) {
+	atomic.StoreInt64(&s.offset, offset)
+	atomic.StoreInt64(&s.backoff, int64(backoff))
+}
+
+// Stats returns a snapshot of the harvester metrics. It is safe to be called
+// while the harvester is running. Offset and Backoff are updated once per
+// read loop iteration. Path changes if follow_renamed finds the renamed file.
+func (h *Harvester) Stats() HarvesterStats {
+	stats := HarvesterStats{
+		LinesRead:  atomic.LoadUint64(&h.stats.linesRead),
+		BytesRead:  atomic.LoadUint64(&h.stats.bytesRead),
+		EventsSent: atomic.LoadUint64(&h.stats.eventsSent),
+		TeeDropped: atomic.LoadUint64(&h.stats.teeDrops),
+		Discarded:  atomic.LoadUint64(&h.stats.discards),
+		Offset:     atomic.LoadInt64(&h.stats.offset),
+		Backoff:    time.Duration(atomic.LoadInt64(&h.stats.backoff)),
+	}
+
+	// Harvesters not created by NewHarvester only publish the path once
+	// follow_renamed changes it
+	if path, ok := h.stats.path.Load().(string); ok {
+		stats.Path = path
+	} else {
+		stats.Path = h.Path
+	}
+
+	if ts := atomic.LoadInt64(&h.stats.lastReadTime); ts != 0 {
+		stats.LastReadTime = time.Unix(0, ts)
+	}
+	return stats
+}
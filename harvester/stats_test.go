@@ -0,0 +1,43 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHarvesterStats(t *testing.T) {
+	spooler := make(chan *input.FileEvent, 2)
+	h := &Harvester{
+		Path:        "/var/log/app.log",
+		Config:      &config.HarvesterConfig{},
+		SpoolerChan: spooler,
+	}
+
+	stats := h.Stats()
+	assert.Equal(t, uint64(0), stats.LinesRead)
+	assert.True(t, stats.LastReadTime.IsZero())
+
+	now := time.Now()
+	h.stats.lineRead(10, now)
+	h.stats.lineRead(5, now)
+	h.sendEvent(now, "line", 15, false, false, nil)
+
+	stats = h.Stats()
+	assert.Equal(t, "/var/log/app.log", stats.Path)
+	assert.Equal(t, uint64(2), stats.LinesRead)
+	assert.Equal(t, uint64(15), stats.BytesRead)
+	assert.Equal(t, uint64(1), stats.EventsSent)
+	assert.Equal(t, now.UnixNano(), stats.LastReadTime.UnixNano())
+
+	// read state is published by the harvest loop
+	assert.Equal(t, int64(0), stats.Offset)
+	h.stats.update(h.Offset, time.Second)
+
+	stats = h.Stats()
+	assert.Equal(t, int64(15), stats.Offset)
+	assert.Equal(t, time.Second, stats.Backoff)
+}
@@ -0,0 +1,95 @@
+// +build !windows
+
+package harvester
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/harvester/encoding"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-symlink")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "app-1.log")
+	link := filepath.Join(dir, "current.log")
+	assert.Nil(t, ioutil.WriteFile(target, []byte("line 1\n"), 0600))
+	assert.Nil(t, os.Symlink(target, link))
+	assert.True(t, input.IsSymlink(link))
+	assert.False(t, input.IsSymlink(target))
+
+	h := &Harvester{
+		Path:     link,
+		Config:   &config.HarvesterConfig{},
+		encoding: encoding.Plain,
+		done:     make(chan struct{}),
+	}
+
+	// symlinks can be disabled
+	symlinks := false
+	h.Config.Symlinks = &symlinks
+	_, err = h.open()
+	assert.NotNil(t, err)
+	assert.Nil(t, h.file)
+
+	// symlinks are followed by default
+	h.Config.Symlinks = nil
+	_, err = h.open()
+	assert.Nil(t, err)
+	defer h.file.Close()
+
+	// state is tracked by the identity of the target
+	info, err := h.file.Stat()
+	assert.Nil(t, err)
+	targetInfo, err := os.Stat(target)
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(info, targetInfo))
+}
+
+func TestOpenSymlinkLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-symlink")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	link := filepath.Join(dir, "loop.log")
+	assert.Nil(t, os.Symlink(link, link))
+
+	maxRetries := -1 // retry forever
+	h := &Harvester{
+		Path: link,
+		Config: &config.HarvesterConfig{
+			MaxOpenRetries: &maxRetries,
+		},
+		encoding: encoding.Plain,
+		done:     make(chan struct{}),
+	}
+
+	// the loop is not retried
+	result := make(chan error, 1)
+	go func() {
+		_, err := h.open()
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "symlink chain too deep")
+	case <-time.After(5 * time.Second):
+		close(h.done)
+		t.Fatal("Opening symlink loop did not return")
+	}
+}
@@ -0,0 +1,58 @@
+package harvester
+
+import (
+	"io"
+	"os"
+)
+
+// tailChunkSize is the number of bytes read at once when scanning backwards
+// for the start of the last lines of a file.
+const tailChunkSize = 4096
+
+// seekTailLines moves the read pointer of file to the start of the n-th line
+// before the end of file and returns the new offset. A line ending at the end
+// of file does not start another line. Files with less than n lines are read
+// from the beginning.
+func seekTailLines(file io.ReadSeeker, n int) (int64, error) {
+	size, err := file.Seek(0, os.SEEK_END)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(0)
+	buf := make([]byte, tailChunkSize)
+	found := 0
+	skipLast := true // line ending at the end of file
+	for end := size; end > 0 && offset == 0; {
+		start := end - tailChunkSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := file.Seek(start, os.SEEK_SET); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			return 0, err
+		}
+
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				skipLast = false
+				continue
+			}
+			if skipLast {
+				skipLast = false
+				continue
+			}
+			found++
+			if found == n {
+				offset = start + int64(i) + 1
+				break
+			}
+		}
+		end = start
+	}
+
+	return file.Seek(offset, os.SEEK_SET)
+}
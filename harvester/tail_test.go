@@ -0,0 +1,43 @@
+package harvester
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekTailLines(t *testing.T) {
+	var long bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&long, "line %d\n", i)
+	}
+
+	var tests = []struct {
+		content  string
+		n        int
+		expected string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"}, // last line without line ending
+		{"a\nb\nc\n", 3, "a\nb\nc\n"},
+		{"a\nb\nc\n", 10, "a\nb\nc\n"}, // less lines than n
+		{"a\n\n\n", 2, "\n\n"},         // empty lines count
+		{"", 2, ""},
+		{long.String(), 3, "line 997\nline 998\nline 999\n"},
+		{long.String(), 600, long.String()[strings.Index(long.String(), "line 400\n"):]},
+	}
+
+	for _, test := range tests {
+		reader := strings.NewReader(test.content)
+		offset, err := seekTailLines(reader, test.n)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(test.content)-len(test.expected)), offset)
+
+		rest := make([]byte, reader.Len())
+		reader.Read(rest)
+		assert.Equal(t, test.expected, string(rest))
+	}
+}
@@ -0,0 +1,71 @@
+package harvester
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"github.com/elastic/filebeat/config"
+)
+
+// expandPlaceholders replaces the placeholders in format with the values of
+// the event starting at offset. The filters dir and base return the directory
+// and the last element of a path value. Unknown placeholders and filters are
+// kept as is.
+func (h *Harvester) expandPlaceholders(format string, offset int64, text string) string {
+	return config.EventIDPlaceholder.ReplaceAllStringFunc(format, func(match string) string {
+		parts := config.EventIDPlaceholder.FindStringSubmatch(match)
+
+		var value string
+		switch parts[1] {
+		case "source":
+			value = h.Source
+		case "offset":
+			value = strconv.FormatInt(offset, 10)
+		case "line":
+			value = text
+		default:
+			return match
+		}
+
+		switch parts[2] {
+		case "":
+		case "dir":
+			value = filepath.Dir(value)
+		case "base":
+			value = filepath.Base(value)
+		default:
+			return match
+		}
+		return value
+	})
+}
+
+// templateFields returns the keys of the fields with values containing
+// placeholders.
+func templateFields(fields map[string]string) []string {
+	var keys []string
+	for key, value := range fields {
+		if config.EventIDPlaceholder.MatchString(value) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// eventFields returns the fields of the event starting at offset. Values
+// containing placeholders are expanded in a copy, as the fields are shared by
+// all events of the harvester.
+func (h *Harvester) eventFields(offset int64, text string) *map[string]string {
+	if len(h.fieldTemplates) == 0 {
+		return &h.fields
+	}
+
+	fields := make(map[string]string, len(h.fields))
+	for key, value := range h.fields {
+		fields[key] = value
+	}
+	for _, key := range h.fieldTemplates {
+		fields[key] = h.expandPlaceholders(fields[key], offset, text)
+	}
+	return &fields
+}
@@ -0,0 +1,38 @@
+package harvester
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	h := &Harvester{Source: "/var/log/app/app.log"}
+
+	assert.Equal(t, "/var/log/app/app.log:42", h.expandPlaceholders("%{source}:%{offset}", 42, "line"))
+	assert.Equal(t, "/var/log/app", h.expandPlaceholders("%{source|dir}", 42, "line"))
+	assert.Equal(t, "app.log", h.expandPlaceholders("%{source|base}", 42, "line"))
+	assert.Equal(t, "line", h.expandPlaceholders("%{line}", 42, "line"))
+
+	// unknown placeholders and filters are kept
+	assert.Equal(t, "%{host} %{source|upper}", h.expandPlaceholders("%{host} %{source|upper}", 42, "line"))
+	assert.Equal(t, "production", h.expandPlaceholders("production", 42, "line"))
+}
+
+func TestEventFields(t *testing.T) {
+	h := &Harvester{
+		Source: "/var/log/app/app.log",
+		fields: map[string]string{"env": "production", "app": "%{source|dir|}"},
+	}
+
+	// without templates the configured fields are shared
+	assert.True(t, h.eventFields(0, "") == &h.fields)
+
+	h.fields["app"] = "%{source|dir}"
+	h.fieldTemplates = templateFields(h.fields)
+	assert.Equal(t, []string{"app"}, h.fieldTemplates)
+
+	fields := h.eventFields(0, "")
+	assert.Equal(t, map[string]string{"env": "production", "app": "/var/log/app"}, *fields)
+	assert.Equal(t, "%{source|dir}", h.fields["app"])
+}
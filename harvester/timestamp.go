@@ -0,0 +1,47 @@
+package harvester
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+)
+
+const timestampErrorKey = "timestamp_error"
+
+// timestampParser extracts the event timestamp from a line. The pattern
+// selects the timestamp in the line, which is parsed using the configured
+// layout. Timestamps without time zone are parsed as local time.
+type timestampParser struct {
+	pattern *regexp.Regexp
+	layout  string
+}
+
+func newTimestampParser(cfg *config.TimestampConfig) (*timestampParser, error) {
+	if cfg.Layout == "" {
+		return nil, fmt.Errorf("timestamp.layout must be set")
+	}
+
+	if err := config.CompileRegexp("timestamp.pattern", &cfg.PatternRegexp, cfg.Pattern); err != nil {
+		return nil, err
+	}
+	pattern := cfg.PatternRegexp
+
+	return &timestampParser{pattern: pattern, layout: cfg.Layout}, nil
+}
+
+// parse returns the timestamp found in line. If the pattern contains a
+// capture group, the first group is parsed, otherwise the complete match.
+func (p *timestampParser) parse(line string) (time.Time, error) {
+	match := p.pattern.FindStringSubmatch(line)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("no timestamp found")
+	}
+
+	value := match[0]
+	if len(match) > 1 {
+		value = match[1]
+	}
+	return time.ParseInLocation(p.layout, value, time.Local)
+}
@@ -0,0 +1,64 @@
+package harvester
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/elastic/filebeat/input"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampParser(t *testing.T) {
+	p, err := newTimestampParser(&config.TimestampConfig{
+		Pattern: `^\[([^\]]+)\]`,
+		Layout:  "2006-01-02 15:04:05.000",
+	})
+	assert.Nil(t, err)
+
+	ts, err := p.parse("[2015-11-24 10:32:01.123] INFO started")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2015, 11, 24, 10, 32, 1, 123000000, time.Local), ts)
+
+	_, err = p.parse("no timestamp")
+	assert.NotNil(t, err)
+
+	_, err = p.parse("[24/11/2015] INFO started")
+	assert.NotNil(t, err)
+}
+
+func TestTimestampParserInvalidConfig(t *testing.T) {
+	_, err := newTimestampParser(&config.TimestampConfig{Pattern: "^"})
+	assert.NotNil(t, err)
+
+	_, err = newTimestampParser(&config.TimestampConfig{Pattern: "(", Layout: time.RFC3339})
+	assert.NotNil(t, err)
+}
+
+func TestSendEventTimestamp(t *testing.T) {
+	spooler := make(chan *input.FileEvent, 2)
+	h := &Harvester{
+		Config: &config.HarvesterConfig{
+			Timestamp: &config.TimestampConfig{
+				Pattern:     `^\S+`,
+				Layout:      time.RFC3339,
+				AddErrorKey: true,
+			},
+		},
+		SpoolerChan: spooler,
+	}
+	h.timestamp, _ = newTimestampParser(h.Config.Timestamp)
+
+	now := time.Now()
+	h.sendEvent(now, "2015-11-24T10:32:01Z started", 10, false, false, nil)
+	h.sendEvent(now, "started", 10, false, false, nil)
+
+	event := <-spooler
+	assert.Equal(t, time.Date(2015, 11, 24, 10, 32, 1, 0, time.UTC), event.ReadTime.UTC())
+	assert.Equal(t, "", event.TimestampError)
+
+	event = <-spooler
+	assert.Equal(t, now, event.ReadTime)
+	assert.NotEqual(t, "", event.TimestampError)
+	assert.NotNil(t, event.ToMapStr()[timestampErrorKey])
+}
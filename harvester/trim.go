@@ -0,0 +1,19 @@
+package harvester
+
+import "strings"
+
+// trimLine removes trim_prefix and trim_suffix once from line, then all
+// leading and trailing characters contained in trim_chars. Only the text is
+// changed, the offset still advances by the bytes read from the file.
+func (h *Harvester) trimLine(line string) string {
+	if h.Config.TrimPrefix != "" {
+		line = strings.TrimPrefix(line, h.Config.TrimPrefix)
+	}
+	if h.Config.TrimSuffix != "" {
+		line = strings.TrimSuffix(line, h.Config.TrimSuffix)
+	}
+	if h.Config.TrimChars != "" {
+		line = strings.Trim(line, h.Config.TrimChars)
+	}
+	return line
+}
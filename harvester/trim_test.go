@@ -0,0 +1,32 @@
+package harvester
+
+import (
+	"testing"
+
+	"github.com/elastic/filebeat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimLine(t *testing.T) {
+	var tests = []struct {
+		prefix, suffix, chars string
+		line                  string
+		expected              string
+	}{
+		{"", "", "", "\x01line;", "\x01line;"},
+		{"\x01", "", "", "\x01\x01line", "\x01line"}, // prefix removed once
+		{"", ";", "", "line;;", "line;"},             // suffix removed once
+		{"", "", "\x01;", "\x01;line;\x01", "line"},  // all chars removed from both ends
+		{"> ", ";", " ", ">  line ;", "line"},
+		{"", "", " ", "l i n e", "l i n e"},
+	}
+
+	for _, test := range tests {
+		h := &Harvester{Config: &config.HarvesterConfig{
+			TrimPrefix: test.prefix,
+			TrimSuffix: test.suffix,
+			TrimChars:  test.chars,
+		}}
+		assert.Equal(t, test.expected, h.trimLine(test.line))
+	}
+}
@@ -1,13 +1,21 @@
 package input
 
 import (
+	"encoding/base64"
+	"errors"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/elastic/libbeat/common"
 	"github.com/elastic/libbeat/logp"
 )
 
+// TextEncodingGzipBase64 is the text_encoding of messages gzip compressed and
+// base64 encoded with compress_text_over.
+const TextEncodingGzipBase64 = "gzip+base64"
+
 type File struct {
 	File      *os.File
 	FileInfo  os.FileInfo
@@ -26,9 +34,74 @@ type FileEvent struct {
 	Text         *string
 	Fields       *map[string]string
 	Fileinfo     *os.FileInfo
+	FileStateOS  *FileStateOS // identity of the file, e.g. inode and device
 	IsPartial    bool
+	Unterminated bool // last line of a closed file without line ending
+	JSONFields   common.MapStr
+
+	// error parsing the timestamp from the line, if timestamp.add_error_key is set
+	TimestampError string
+
+	// named groups of extract.pattern matched in the line, if extract is set
+	ExtractedFields common.MapStr
+
+	// error extracting fields from the line, if extract.add_error_key is set
+	ExtractError string
+
+	// file identity, if add_file_identity is set. File index and volume on Windows
+	Inode  uint64
+	Device uint64
+
+	// duration of reading the line, if add_read_latency is set
+	ReadLatency time.Duration
+
+	// number of the event within the harvester, starting at 1, if add_sequence is set
+	Sequence uint64
+
+	// line ending stripped from the line (lf, crlf, cr or delimiter), if add_line_ending is set
+	LineEnding string
+
+	// deterministic id of the event computed from event_id, if add_event_id is set
+	EventID string
+
+	// error reading the file, set for error events published with publish_errors
+	Error string
+
+	// offset after the last byte of the event, if add_end_offset is set
+	EndOffset int64
+
+	// name of the encoding the file was read with, if add_encoding is set
+	Encoding string
+
+	// why the harvester started reading at its start position, if add_start_reason is set
+	StartReason string
+
+	// undecoded bytes of the event in the file, if raw_bytes is set
+	RawBytes []byte
 
-	fieldsUnderRoot bool
+	// number of identical lines combined into the event, if dedup_window is set
+	RepeatCount int
+
+	// event without line sent after heartbeat_interval without new lines
+	Heartbeat bool
+
+	// encoding of Text, TextEncodingGzipBase64 if compress_text_over was exceeded
+	TextEncoding string
+
+	// 1 in SampleRate events is sent, if sample_rate is set
+	SampleRate int
+
+	fieldsUnderRoot   bool
+	jsonKeysUnderRoot bool
+	extractUnderRoot  bool
+	addReadLatency    bool
+	ack               *eventAck // set by RequestAck
+}
+
+// eventAck signals the harvester waiting for an event to be published
+type eventAck struct {
+	once sync.Once
+	done chan struct{}
 }
 
 type FileState struct {
@@ -46,15 +119,35 @@ func (f *FileEvent) GetState() *FileState {
 		offset += int64(f.Bytes)
 	}
 
+	fileStateOS := f.FileStateOS
+	if fileStateOS == nil {
+		fileStateOS = GetOSFileState(f.Fileinfo)
+	}
+
 	state := &FileState{
 		Source:      f.Source,
 		Offset:      offset,
-		FileStateOS: GetOSFileState(f.Fileinfo),
+		FileStateOS: fileStateOS,
 	}
 
 	return state
 }
 
+// RequestAck returns a channel closed once Ack is called for the event, so the
+// harvester can wait for the event to be published before sending the next one.
+func (f *FileEvent) RequestAck() <-chan struct{} {
+	f.ack = &eventAck{done: make(chan struct{})}
+	return f.ack.done
+}
+
+// Ack reports the event as published to the harvester waiting for it. Does
+// nothing if no ack was requested. Can be called multiple times.
+func (f *FileEvent) Ack() {
+	if f.ack != nil {
+		f.ack.once.Do(func() { close(f.ack.done) })
+	}
+}
+
 // SetFieldsUnderRoot sets whether the fields should be added
 // top level to the output documentation (fieldsUnderRoot = true) or
 // under a fields dictionary.
@@ -62,20 +155,139 @@ func (f *FileEvent) SetFieldsUnderRoot(fieldsUnderRoot bool) {
 	f.fieldsUnderRoot = fieldsUnderRoot
 }
 
+// SetJSONKeysUnderRoot sets whether the decoded JSON fields should be added
+// top level to the output document (jsonKeysUnderRoot = true) or under a json
+// dictionary.
+func (f *FileEvent) SetJSONKeysUnderRoot(jsonKeysUnderRoot bool) {
+	f.jsonKeysUnderRoot = jsonKeysUnderRoot
+}
+
+// SetExtractKeysUnderRoot sets whether the extracted fields should be added
+// top level to the output document or under an extract dictionary.
+func (f *FileEvent) SetExtractKeysUnderRoot(keysUnderRoot bool) {
+	f.extractUnderRoot = keysUnderRoot
+}
+
+// SetReadLatency sets the time it took to read the line and adds it to the
+// output document as read_latency_ms.
+func (f *FileEvent) SetReadLatency(latency time.Duration) {
+	f.ReadLatency = latency
+	f.addReadLatency = true
+}
+
 func (f *FileEvent) ToMapStr() common.MapStr {
 	event := common.MapStr{
 		"@timestamp": common.Time(f.ReadTime),
 		"source":     f.Source,
 		"offset":     f.Offset,
-		"message":    f.Text,
 		"type":       f.DocumentType,
 		"input_type": f.InputType,
 	}
 
-	if f.IsPartial {
+	// no message with raw_bytes: replace
+	if f.Text != nil {
+		event["message"] = f.Text
+	}
+
+	if f.IsPartial || f.Unterminated {
 		event["partial"] = true
 	}
 
+	if f.TimestampError != "" {
+		event["timestamp_error"] = f.TimestampError
+	}
+
+	if f.ExtractError != "" {
+		event["extract_error"] = f.ExtractError
+	}
+
+	if f.Inode != 0 {
+		event["inode"] = f.Inode
+		event["device"] = f.Device
+	}
+
+	if f.Sequence != 0 {
+		event["sequence"] = f.Sequence
+	}
+
+	if f.LineEnding != "" {
+		event["line_ending"] = f.LineEnding
+	}
+
+	if f.EventID != "" {
+		event["event_id"] = f.EventID
+	}
+
+	if f.Error != "" {
+		event["error"] = f.Error
+	}
+
+	if f.EndOffset != 0 {
+		event["end_offset"] = f.EndOffset
+	}
+
+	if f.Encoding != "" {
+		event["encoding"] = f.Encoding
+	}
+
+	if f.StartReason != "" {
+		event["start_reason"] = f.StartReason
+	}
+
+	if f.RepeatCount > 1 {
+		event["repeat_count"] = f.RepeatCount
+	}
+
+	if f.Heartbeat {
+		event["heartbeat"] = true
+	}
+
+	if f.TextEncoding != "" {
+		event["text_encoding"] = f.TextEncoding
+	}
+
+	if f.SampleRate > 1 {
+		event["sample_rate"] = f.SampleRate
+	}
+
+	if f.RawBytes != nil {
+		event["raw_bytes"] = base64.StdEncoding.EncodeToString(f.RawBytes)
+	}
+
+	if f.addReadLatency {
+		event["read_latency_ms"] = f.ReadLatency.Seconds() * 1000
+	}
+
+	if f.JSONFields != nil {
+		if f.jsonKeysUnderRoot {
+			for key, value := range f.JSONFields {
+				// in case of conflicts, overwrite
+				_, found := event[key]
+				if found {
+					logp.Debug("filebeat", "Overwriting %s key with JSON value", key)
+				}
+				event[key] = value
+			}
+		} else {
+			event["json"] = f.JSONFields
+		}
+	}
+
+	if f.ExtractedFields != nil {
+		if f.extractUnderRoot {
+			for key, value := range f.ExtractedFields {
+				// in case of conflicts, overwrite
+				_, found := event[key]
+				if found {
+					logp.Debug("filebeat", "Overwriting %s key with extracted value", key)
+				}
+				event[key] = value
+			}
+		} else {
+			event["extract"] = f.ExtractedFields
+		}
+	}
+
 	if f.Fields != nil {
 		if f.fieldsUnderRoot {
 			for key, value := range *f.Fields {
@@ -126,11 +338,60 @@ func IsSameFile(path string, info os.FileInfo) bool {
 	return os.SameFile(fileInfo, info)
 }
 
+// IsSymlink checks if path is a symbolic link. The link itself is not followed.
+func IsSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// ErrSymlinkTooDeep is returned by ResolveSymlink for symlink loops and chains
+// longer than the maximum depth.
+var ErrSymlinkTooDeep = errors.New("symlink chain too deep")
+
+// ResolveSymlink follows the chain of symlinks starting at path and returns the
+// path of the final target. At most maxDepth symlinks are followed. Loops and
+// longer chains return ErrSymlinkTooDeep. The target does not need to exist.
+func ResolveSymlink(path string, maxDepth int) (string, error) {
+	for depth := 0; ; depth++ {
+		info, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) && depth > 0 {
+				return path, nil
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		if depth >= maxDepth {
+			return "", ErrSymlinkTooDeep
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+}
+
 func IsRegularFile(file *os.File) bool {
 	f := &File{File: file}
 	return f.IsRegularFile()
 }
 
+// GetOSFileState returns the OS specific identity of the file. On unix
+// this is the inode and device.
+func (f *File) GetOSFileState() *FileStateOS {
+	return GetOSFileState(&f.FileInfo)
+}
+
 // Checks if the two files are the same.
 func (f1 *File) IsSameFile(f2 *File) bool {
 	return os.SameFile(f1.FileInfo, f2.FileInfo)
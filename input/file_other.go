@@ -33,6 +33,11 @@ func (fs *FileStateOS) IsSame(state *FileStateOS) bool {
 	return fs.Inode == state.Inode && fs.Device == state.Device
 }
 
+// Identity returns the inode and device of the file
+func (fs *FileStateOS) Identity() (inode uint64, device uint64) {
+	return fs.Inode, fs.Device
+}
+
 // SafeFileRotate safely rotates an existing file under path and replaces it with the tempfile
 func SafeFileRotate(path, tempfile string) error {
 	if e := os.Rename(tempfile, path); e != nil {
@@ -3,8 +3,10 @@
 package input
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,6 +23,10 @@ func TestGetOSFileState(t *testing.T) {
 
 	assert.True(t, state.Inode > 0)
 	assert.True(t, state.Device > 0)
+
+	inode, device := state.Identity()
+	assert.Equal(t, state.Inode, inode)
+	assert.Equal(t, state.Device, device)
 }
 
 func TestGetOSFileStateStat(t *testing.T) {
@@ -35,3 +41,43 @@ func TestGetOSFileStateStat(t *testing.T) {
 	assert.True(t, state.Inode > 0)
 	assert.True(t, state.Device > 0)
 }
+
+func TestResolveSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-symlink")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "app.log")
+	assert.Nil(t, ioutil.WriteFile(target, []byte("line 1\n"), 0600))
+
+	// link-3 -> link-2 -> link-1 -> app.log, with relative link targets
+	assert.Nil(t, os.Symlink("app.log", filepath.Join(dir, "link-1")))
+	for i := 2; i <= 3; i++ {
+		assert.Nil(t, os.Symlink(fmt.Sprintf("link-%d", i-1), filepath.Join(dir, fmt.Sprintf("link-%d", i))))
+	}
+
+	resolved, err := ResolveSymlink(filepath.Join(dir, "link-3"), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, target, resolved)
+
+	_, err = ResolveSymlink(filepath.Join(dir, "link-3"), 2)
+	assert.Equal(t, ErrSymlinkTooDeep, err)
+
+	// regular files are returned as is
+	resolved, err = ResolveSymlink(target, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, target, resolved)
+
+	// loops end at the maximum depth
+	loop := filepath.Join(dir, "loop")
+	assert.Nil(t, os.Symlink(loop, loop))
+	_, err = ResolveSymlink(loop, 10)
+	assert.Equal(t, ErrSymlinkTooDeep, err)
+
+	// dangling symlinks resolve to the missing target
+	missing := filepath.Join(dir, "missing.log")
+	assert.Nil(t, os.Symlink(missing, filepath.Join(dir, "dangling")))
+	resolved, err = ResolveSymlink(filepath.Join(dir, "dangling"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, missing, resolved)
+}
@@ -1,11 +1,14 @@
 package input
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/elastic/libbeat/common"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -110,6 +113,120 @@ func TestFileEventToMapStr(t *testing.T) {
 	mapStr := event.ToMapStr()
 	_, found := mapStr["fields"]
 	assert.False(t, found)
+	_, found = mapStr["inode"]
+	assert.False(t, found)
+	_, found = mapStr["read_latency_ms"]
+	assert.False(t, found)
+	_, found = mapStr["sequence"]
+	assert.False(t, found)
+
+	event = FileEvent{Sequence: 3}
+	assert.Equal(t, uint64(3), event.ToMapStr()["sequence"])
+	_, found = mapStr["line_ending"]
+	assert.False(t, found)
+
+	event = FileEvent{LineEnding: "crlf"}
+	assert.Equal(t, "crlf", event.ToMapStr()["line_ending"])
+	_, found = mapStr["event_id"]
+	assert.False(t, found)
+
+	event = FileEvent{EventID: "abc"}
+	assert.Equal(t, "abc", event.ToMapStr()["event_id"])
+	_, found = mapStr["error"]
+	assert.False(t, found)
+
+	event = FileEvent{Error: "read failed"}
+	assert.Equal(t, "read failed", event.ToMapStr()["error"])
+	_, found = mapStr["end_offset"]
+	assert.False(t, found)
+
+	event = FileEvent{Offset: 10, EndOffset: 17}
+	assert.Equal(t, int64(10), event.ToMapStr()["offset"])
+	assert.Equal(t, int64(17), event.ToMapStr()["end_offset"])
+	_, found = mapStr["encoding"]
+	assert.False(t, found)
+
+	event = FileEvent{Encoding: "utf-16le"}
+	assert.Equal(t, "utf-16le", event.ToMapStr()["encoding"])
+	_, found = mapStr["raw_bytes"]
+	assert.False(t, found)
+	_, found = mapStr["message"]
+	assert.False(t, found)
+
+	event = FileEvent{RawBytes: []byte{0xff, 'a', '\n'}}
+	assert.Equal(t, "/2EK", event.ToMapStr()["raw_bytes"])
+	_, found = mapStr["repeat_count"]
+	assert.False(t, found)
+
+	event = FileEvent{RepeatCount: 3}
+	assert.Equal(t, 3, event.ToMapStr()["repeat_count"])
+	_, found = mapStr["heartbeat"]
+	assert.False(t, found)
+
+	event = FileEvent{Heartbeat: true}
+	mapStr = event.ToMapStr()
+	assert.Equal(t, true, mapStr["heartbeat"])
+	_, found = mapStr["message"]
+	assert.False(t, found)
+	_, found = mapStr["text_encoding"]
+	assert.False(t, found)
+
+	event = FileEvent{TextEncoding: TextEncodingGzipBase64}
+	mapStr = event.ToMapStr()
+	assert.Equal(t, "gzip+base64", mapStr["text_encoding"])
+	_, found = mapStr["start_reason"]
+	assert.False(t, found)
+
+	event = FileEvent{StartReason: "resume"}
+	mapStr = event.ToMapStr()
+	assert.Equal(t, "resume", mapStr["start_reason"])
+	_, found = mapStr["sample_rate"]
+	assert.False(t, found)
+
+	event = FileEvent{SampleRate: 100}
+	assert.Equal(t, 100, event.ToMapStr()["sample_rate"])
+}
+
+func TestFileEventAck(t *testing.T) {
+	// no ack requested
+	event := FileEvent{}
+	event.Ack()
+
+	acked := event.RequestAck()
+	select {
+	case <-acked:
+		t.Fatal("Acked before Ack")
+	default:
+	}
+
+	event.Ack()
+	event.Ack()
+	_, open := <-acked
+	assert.False(t, open)
+}
+
+func TestFileEventToMapStrTimestampUTC(t *testing.T) {
+	// read time in a time zone other than UTC is published in UTC
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	event := FileEvent{ReadTime: time.Date(2016, 1, 24, 16, 6, 5, 71e6, zone)}
+
+	data, err := json.Marshal(event.ToMapStr()["@timestamp"])
+	assert.Nil(t, err)
+	assert.Equal(t, `"2016-01-24T14:06:05.071Z"`, string(data))
+}
+
+func TestFileEventToMapStrIdentity(t *testing.T) {
+	event := FileEvent{Inode: 42, Device: 7}
+	mapStr := event.ToMapStr()
+	assert.Equal(t, uint64(42), mapStr["inode"])
+	assert.Equal(t, uint64(7), mapStr["device"])
+}
+
+func TestFileEventToMapStrReadLatency(t *testing.T) {
+	event := FileEvent{}
+	event.SetReadLatency(1500 * time.Microsecond)
+	mapStr := event.ToMapStr()
+	assert.Equal(t, 1.5, mapStr["read_latency_ms"])
 }
 
 func TestFieldsUnderRoot(t *testing.T) {
@@ -131,3 +248,50 @@ func TestFieldsUnderRoot(t *testing.T) {
 	_, found = mapStr["fields"]
 	assert.True(t, found)
 }
+
+func TestJSONKeysUnderRoot(t *testing.T) {
+	text := "hello"
+	event := FileEvent{
+		Text: &text,
+		JSONFields: common.MapStr{
+			"level": "info",
+		},
+	}
+
+	mapStr := event.ToMapStr()
+	assert.Equal(t, common.MapStr{"level": "info"}, mapStr["json"])
+	_, found := mapStr["level"]
+	assert.False(t, found)
+
+	event.SetJSONKeysUnderRoot(true)
+	mapStr = event.ToMapStr()
+	_, found = mapStr["json"]
+	assert.False(t, found)
+	assert.Equal(t, "info", mapStr["level"])
+}
+
+func TestExtractKeysUnderRoot(t *testing.T) {
+	text := "GET /index.html"
+	event := FileEvent{
+		Text: &text,
+		ExtractedFields: common.MapStr{
+			"method": "GET",
+		},
+	}
+
+	mapStr := event.ToMapStr()
+	assert.Equal(t, common.MapStr{"method": "GET"}, mapStr["extract"])
+	_, found := mapStr["method"]
+	assert.False(t, found)
+	_, found = mapStr["extract_error"]
+	assert.False(t, found)
+
+	event.SetExtractKeysUnderRoot(true)
+	mapStr = event.ToMapStr()
+	_, found = mapStr["extract"]
+	assert.False(t, found)
+	assert.Equal(t, "GET", mapStr["method"])
+
+	event = FileEvent{Text: &text, ExtractError: "Error extracting fields: no match of extract.pattern"}
+	assert.Equal(t, event.ExtractError, event.ToMapStr()["extract_error"])
+}
@@ -45,6 +45,12 @@ func (fs *FileStateOS) IsSame(state *FileStateOS) bool {
 	return fs.IdxHi == state.IdxHi && fs.IdxLo == state.IdxLo && fs.Vol == state.Vol
 }
 
+// Identity returns the file index as inode and the volume serial number as
+// device. These are the values returned by GetFileInformationByHandle.
+func (fs *FileStateOS) Identity() (inode uint64, device uint64) {
+	return fs.IdxHi<<32 | fs.IdxLo, fs.Vol
+}
+
 // SafeFileRotate safely rotates an existing file under path and replaces it with the tempfile
 func SafeFileRotate(path, tempfile string) error {
 	old := path + ".old"
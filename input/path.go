@@ -0,0 +1,136 @@
+package input
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"unicode"
+)
+
+// Glob returns the paths matching the glob pattern like filepath.Glob. If
+// ignoreCase is set, letters in the pattern also match their other case, also
+// on case-sensitive filesystems.
+func Glob(pattern string, ignoreCase bool) ([]string, error) {
+	if ignoreCase {
+		pattern = FoldPattern(pattern)
+	}
+	return filepath.Glob(pattern)
+}
+
+// FoldPattern returns the glob pattern with each letter replaced by a
+// character class of both its cases, e.g. /var/log/*.LOG becomes
+// /[vV][aA][rR]/[lL][oO][gG]/*.[lL][oO][gG]. Letters in character classes and
+// ranges of letters of the same case are extended by their other case.
+func FoldPattern(pattern string) string {
+	var b bytes.Buffer
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && runtime.GOOS != "windows" && i+1 < len(runes):
+			i++
+			b.WriteRune(r)
+			b.WriteRune(runes[i])
+		case r == '[':
+			i = foldClass(&b, runes, i)
+		case unicode.ToLower(r) != unicode.ToUpper(r):
+			b.WriteRune('[')
+			b.WriteRune(unicode.ToLower(r))
+			b.WriteRune(unicode.ToUpper(r))
+			b.WriteRune(']')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// foldClass writes the character class starting at runes[start] to b, adding
+// the other case of all letters and letter ranges. Returns the index of the
+// closing bracket. Unterminated classes are copied as is, so filepath.Glob
+// reports them.
+func foldClass(b *bytes.Buffer, runes []rune, start int) int {
+	end := -1
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '\\' && runtime.GOOS != "windows" {
+			i++
+			continue
+		}
+		if runes[i] == ']' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		b.WriteString(string(runes[start:]))
+		return len(runes) - 1
+	}
+
+	var items, folded []rune
+	i := start + 1
+	if runes[i] == '^' {
+		items = append(items, '^')
+		i++
+	}
+	for i < end {
+		lo := runes[i]
+		if lo == '\\' && runtime.GOOS != "windows" {
+			items = append(items, runes[i], runes[i+1])
+			i += 2
+			continue
+		}
+		if i+2 < end && runes[i+1] == '-' {
+			hi := runes[i+2]
+			items = append(items, lo, '-', hi)
+			if unicode.IsLower(lo) == unicode.IsLower(hi) && otherCase(lo) != lo && otherCase(hi) != hi {
+				flo, fhi := otherCase(lo), otherCase(hi)
+				folded = append(folded, flo, '-', fhi)
+			}
+			i += 3
+			continue
+		}
+		items = append(items, lo)
+		if f := otherCase(lo); f != lo {
+			folded = append(folded, f)
+		}
+		i++
+	}
+
+	b.WriteRune('[')
+	b.WriteString(string(items))
+	b.WriteString(string(folded))
+	b.WriteRune(']')
+	return end
+}
+
+// otherCase returns the upper case of lower case letters and the lower case of
+// all other runes.
+func otherCase(r rune) rune {
+	if unicode.IsLower(r) {
+		return unicode.ToUpper(r)
+	}
+	return unicode.ToLower(r)
+}
+
+// CompilePathRegexp compiles a regular expression matched against paths, e.g.
+// of exclude_files. If ignoreCase is set, the expression matches
+// case-insensitively.
+func CompilePathRegexp(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// MatchPath checks if path matches any of the regular expressions compiled by
+// CompilePathRegexp. All checks of paths against exclude_files use it, so the
+// prospector and the harvester treat paths the same.
+func MatchPath(regexps []*regexp.Regexp, path string) bool {
+	for _, r := range regexps {
+		if r.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package input
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldPattern(t *testing.T) {
+	tests := []struct {
+		pattern, folded string
+	}{
+		{"*.log", "*.[lL][oO][gG]"},
+		{"app-1?.LOG", "[aA][pP][pP]-1?.[lL][oO][gG]"},
+		{"[a-c]", "[a-cA-C]"},
+		{"[^x0-9]", "[^x0-9X]"},
+		{"[A-z]", "[A-z]"},
+		{"[a", "[a"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.folded, FoldPattern(test.pattern), test.pattern)
+	}
+}
+
+func TestGlobIgnoreCase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebeat-glob")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"App.LOG", "other.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+	}
+
+	matches, err := Glob(filepath.Join(dir, "*.log"), true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "App.LOG")}, matches)
+
+	// invalid patterns are reported as by filepath.Glob
+	_, err = Glob(filepath.Join(dir, "[a"), true)
+	assert.Equal(t, filepath.ErrBadPattern, err)
+}
+
+func TestMatchPath(t *testing.T) {
+	r, err := CompilePathRegexp(`\.gz$`, false)
+	assert.Nil(t, err)
+	assert.True(t, MatchPath([]*regexp.Regexp{r}, "/var/log/app.log.gz"))
+	assert.False(t, MatchPath([]*regexp.Regexp{r}, "/var/log/app.log.GZ"))
+
+	r, err = CompilePathRegexp(`\.gz$`, true)
+	assert.Nil(t, err)
+	assert.True(t, MatchPath([]*regexp.Regexp{r}, "/var/log/app.log.GZ"))
+	assert.False(t, MatchPath(nil, "/var/log/app.log.GZ"))
+}